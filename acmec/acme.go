@@ -0,0 +1,336 @@
+package acmec
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// DefaultRenewBefore is how long before expiry a certificate is renewed
+	DefaultRenewBefore = 30 * 24 * time.Hour
+	// how often the certificate is checked for renewal
+	checkInterval = 12 * time.Hour
+	// how long to wait before trying again after a failed issuance
+	retryInterval = 10 * time.Minute
+)
+
+var errNoCertificate = errors.New("no acme certificate issued yet")
+
+type Config struct {
+	// Domains the certificate is issued for, the first one is also its common name
+	Domains []string
+	// Email is an optional contact for the ACME account
+	Email string
+	// DirectoryURL of the ACME server, defaults to Let's Encrypt
+	DirectoryURL string
+	// Dir stores the account key, and the issued certificate and its key
+	Dir string
+	// Solver fulfills the challenges of the ACME server
+	Solver Solver
+	// HTTPClient is used to talk to the ACME server, e.g. to trust a test server
+	HTTPClient *http.Client
+	// RenewBefore defaults to DefaultRenewBefore
+	RenewBefore time.Duration
+	Logger      *slog.Logger
+}
+
+// Manager obtains and renews a certificate from an ACME server. New handshakes get the latest certificate through
+// GetCertificate, while existing connections keep working with the one they negotiated.
+type Manager struct {
+	cfg    Config
+	client *acme.Client
+	cert   atomic.Pointer[tls.Certificate]
+	logger *slog.Logger
+}
+
+func NewManager(cfg Config) (*Manager, error) {
+	if len(cfg.Domains) == 0 {
+		return nil, kleverr.New("acme requires at least one domain")
+	}
+	if cfg.Solver == nil {
+		return nil, kleverr.New("acme requires a challenge solver")
+	}
+	if cfg.DirectoryURL == "" {
+		cfg.DirectoryURL = acme.LetsEncryptURL
+	}
+	if cfg.RenewBefore == 0 {
+		cfg.RenewBefore = DefaultRenewBefore
+	}
+
+	if err := os.MkdirAll(cfg.Dir, 0700); err != nil {
+		return nil, kleverr.Newf("cannot create acme dir: %w", err)
+	}
+
+	accountKey, err := loadOrCreateKey(filepath.Join(cfg.Dir, "account.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manager{
+		cfg: cfg,
+		client: &acme.Client{
+			Key:          accountKey,
+			DirectoryURL: cfg.DirectoryURL,
+			HTTPClient:   cfg.HTTPClient,
+			UserAgent:    "connet",
+		},
+		logger: cfg.Logger.With("acme", cfg.Domains[0]),
+	}
+
+	switch cert, err := tls.LoadX509KeyPair(m.certFile(), m.keyFile()); {
+	case err == nil && !sameDomains(cert.Leaf.DNSNames, cfg.Domains):
+		m.logger.Info("stored acme certificate is for other domains, obtaining a new one", "stored", cert.Leaf.DNSNames)
+	case err == nil:
+		m.cert.Store(&cert)
+	case !errors.Is(err, os.ErrNotExist):
+		m.logger.Warn("cannot load acme certificate, obtaining a new one", "err", err)
+	}
+
+	return m, nil
+}
+
+// sameDomains reports if the certificate names are exactly the configured domains, in any order
+func sameDomains(names, domains []string) bool {
+	return slices.Equal(slices.Sorted(slices.Values(names)), slices.Sorted(slices.Values(domains)))
+}
+
+func (m *Manager) certFile() string { return filepath.Join(m.cfg.Dir, "cert.pem") }
+func (m *Manager) keyFile() string  { return filepath.Join(m.cfg.Dir, "key.pem") }
+
+func (m *Manager) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := m.cert.Load(); cert != nil {
+		return cert, nil
+	}
+	return nil, errNoCertificate
+}
+
+// Run obtains a certificate if there is none, and then renews it before it expires
+func (m *Manager) Run(ctx context.Context) error {
+	solverDone := make(chan error, 1)
+	if r, ok := m.cfg.Solver.(interface{ Run(context.Context) error }); ok {
+		go func() { solverDone <- r.Run(ctx) }()
+	}
+
+	for {
+		wait := checkInterval
+		if m.renewDue(time.Now()) {
+			if err := m.obtain(ctx); err != nil {
+				m.logger.Warn("cannot obtain acme certificate", "err", err)
+				wait = retryInterval
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-solverDone:
+			return err
+		case <-time.After(m.waitRenew(time.Now(), wait)):
+		}
+	}
+}
+
+func (m *Manager) renewDue(now time.Time) bool {
+	cert := m.cert.Load()
+	return cert == nil || now.After(cert.Leaf.NotAfter.Add(-m.cfg.RenewBefore))
+}
+
+// waitRenew returns how long to wait until the next check, at most limit
+func (m *Manager) waitRenew(now time.Time, limit time.Duration) time.Duration {
+	cert := m.cert.Load()
+	if cert == nil {
+		return limit
+	}
+	return min(max(0, cert.Leaf.NotAfter.Add(-m.cfg.RenewBefore).Sub(now)), limit)
+}
+
+func (m *Manager) obtain(ctx context.Context) error {
+	m.logger.Info("obtaining acme certificate", "domains", m.cfg.Domains)
+
+	acct := &acme.Account{}
+	if m.cfg.Email != "" {
+		acct.Contact = []string{"mailto:" + m.cfg.Email}
+	}
+	if _, err := m.client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return kleverr.Newf("cannot register acme account: %w", err)
+	}
+
+	order, err := m.client.AuthorizeOrder(ctx, acme.DomainIDs(m.cfg.Domains...))
+	if err != nil {
+		return kleverr.Newf("cannot create acme order: %w", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := m.authorize(ctx, authzURL); err != nil {
+			return err
+		}
+	}
+
+	order, err = m.client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return kleverr.Newf("acme order failed: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return kleverr.Ret(err)
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: m.cfg.Domains}, key)
+	if err != nil {
+		return kleverr.Ret(err)
+	}
+
+	chain, _, err := m.client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return kleverr.Newf("cannot finalize acme order: %w", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return kleverr.Newf("invalid acme certificate: %w", err)
+	}
+
+	if err := writeFile(m.keyFile(), keyPEM); err != nil {
+		return err
+	}
+	if err := writeFile(m.certFile(), certPEM); err != nil {
+		return err
+	}
+
+	m.cert.Store(&cert)
+	m.logger.Info("obtained acme certificate", "not-after", cert.Leaf.NotAfter)
+	return nil
+}
+
+func (m *Manager) authorize(ctx context.Context, authzURL string) error {
+	authz, err := m.client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return kleverr.Newf("cannot get acme authorization: %w", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	typ := m.cfg.Solver.Type()
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == typ {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return kleverr.Newf("acme server does not offer %s challenge for %s", typ, authz.Identifier.Value)
+	}
+
+	var value string
+	switch typ {
+	case ChallengeHTTP01:
+		value, err = m.client.HTTP01ChallengeResponse(chal.Token)
+	case ChallengeDNS01:
+		value, err = m.client.DNS01ChallengeRecord(chal.Token)
+	default:
+		err = kleverr.Newf("unsupported challenge type: %s", typ)
+	}
+	if err != nil {
+		return err
+	}
+
+	domain := authz.Identifier.Value
+	if err := m.cfg.Solver.Present(ctx, domain, chal.Token, value); err != nil {
+		return kleverr.Newf("cannot present %s challenge for %s: %w", typ, domain, err)
+	}
+	defer func() {
+		if err := m.cfg.Solver.CleanUp(context.WithoutCancel(ctx), domain, chal.Token, value); err != nil {
+			m.logger.Warn("cannot clean up acme challenge", "domain", domain, "err", err)
+		}
+	}()
+
+	if _, err := m.client.Accept(ctx, chal); err != nil {
+		return kleverr.Newf("cannot accept acme challenge: %w", err)
+	}
+	if _, err := m.client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return kleverr.Newf("acme authorization for %s failed: %w", domain, err)
+	}
+	return nil
+}
+
+func loadOrCreateKey(path string) (crypto.Signer, error) {
+	switch data, err := os.ReadFile(path); {
+	case err == nil:
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, kleverr.Newf("no pem block in %s", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, kleverr.Newf("cannot parse acme account key: %w", err)
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, kleverr.Newf("acme account key cannot sign: %T", key)
+		}
+		return signer, nil
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, kleverr.Newf("cannot read acme account key: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, kleverr.Ret(err)
+	}
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(path, keyPEM); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func encodeKey(key crypto.PrivateKey) ([]byte, error) {
+	data, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, kleverr.Ret(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: data}), nil
+}
+
+// writeFile replaces a file atomically, so a crash never leaves a partially written one
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return kleverr.Ret(err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return kleverr.Ret(err)
+	}
+	return nil
+}
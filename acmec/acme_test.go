@@ -0,0 +1,155 @@
+package acmec
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSolver(t *testing.T) {
+	s := NewHTTPSolver("")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func(path string) (int, string) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	require.NoError(t, s.Present(context.Background(), "example.com", "token", "token.thumbprint"))
+	code, body := get("/.well-known/acme-challenge/token")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "token.thumbprint", body)
+
+	code, _ = get("/token")
+	require.Equal(t, http.StatusNotFound, code)
+
+	require.NoError(t, s.CleanUp(context.Background(), "example.com", "token", "token.thumbprint"))
+	code, _ = get("/.well-known/acme-challenge/token")
+	require.Equal(t, http.StatusNotFound, code)
+}
+
+func TestDNSHookSolver(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	hook := filepath.Join(dir, "hook.sh")
+	require.NoError(t, os.WriteFile(hook, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n"), 0700))
+
+	s := NewDNSHookSolver(hook)
+	require.NoError(t, s.Present(context.Background(), "*.example.com", "token", "record"))
+	require.NoError(t, s.CleanUp(context.Background(), "*.example.com", "token", "record"))
+
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.Equal(t, "present _acme-challenge.example.com. record\ncleanup _acme-challenge.example.com. record\n", string(data))
+}
+
+func TestManagerStored(t *testing.T) {
+	dir := t.TempDir()
+	cfg := Config{
+		Domains: []string{"example.com"},
+		Dir:     dir,
+		Solver:  NewHTTPSolver(""),
+		Logger:  slog.Default(),
+	}
+
+	m, err := NewManager(cfg)
+	require.NoError(t, err)
+	_, err = m.GetCertificate(&tls.ClientHelloInfo{})
+	require.ErrorIs(t, err, errNoCertificate)
+	require.True(t, m.renewDue(time.Now()))
+
+	root, err := certc.NewRoot()
+	require.NoError(t, err)
+	cert, err := root.NewServer(certc.CertOpts{Domains: cfg.Domains})
+	require.NoError(t, err)
+	certPEM, keyPEM, err := cert.EncodeToMemory()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "cert.pem"), certPEM, 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "key.pem"), keyPEM, 0600))
+
+	m2, err := NewManager(cfg)
+	require.NoError(t, err)
+	require.Equal(t, m.client.Key, m2.client.Key)
+
+	tlsCert, err := m2.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, cert.Raw(), tlsCert.Leaf.Raw)
+
+	// the root (and so the cert) is valid for 90 days
+	require.False(t, m2.renewDue(time.Now()))
+	require.Equal(t, time.Hour, m2.waitRenew(time.Now(), time.Hour))
+	require.True(t, m2.renewDue(time.Now().Add(61*24*time.Hour)))
+	require.Zero(t, m2.waitRenew(time.Now().Add(61*24*time.Hour), time.Hour))
+
+	// once the domains change, the stored cert is not used anymore
+	cfg.Domains = []string{"example.com", "www.example.com"}
+	m3, err := NewManager(cfg)
+	require.NoError(t, err)
+	_, err = m3.GetCertificate(&tls.ClientHelloInfo{})
+	require.ErrorIs(t, err, errNoCertificate)
+	require.True(t, m3.renewDue(time.Now()))
+}
+
+// TestManagerPebble runs against a local ACME test server, e.g. started with
+//
+//	PEBBLE_VA_ALWAYS_VALID=1 pebble -config test/config/pebble-config.json
+//	CONNET_ACME_DIRECTORY=https://localhost:14000/dir go test ./acmec
+func TestManagerPebble(t *testing.T) {
+	directory := os.Getenv("CONNET_ACME_DIRECTORY")
+	if directory == "" {
+		t.Skip("CONNET_ACME_DIRECTORY is not set")
+	}
+	httpAddr := os.Getenv("CONNET_ACME_HTTP_ADDR")
+	if httpAddr == "" {
+		httpAddr = ":5002"
+	}
+
+	cfg := Config{
+		Domains:      []string{"connet.example.com"},
+		Email:        "admin@example.com",
+		DirectoryURL: directory,
+		Dir:          t.TempDir(),
+		Solver:       NewHTTPSolver(httpAddr),
+		HTTPClient: &http.Client{Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true}, // pebble uses its own test CA
+		}},
+		Logger: slog.Default(),
+	}
+	m, err := NewManager(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go m.Run(ctx)
+
+	require.Eventually(t, func() bool {
+		_, err := m.GetCertificate(&tls.ClientHelloInfo{})
+		return err == nil
+	}, 30*time.Second, 100*time.Millisecond)
+
+	cert, err := m.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, cfg.Domains, cert.Leaf.DNSNames)
+
+	// a restart reuses the stored certificate
+	m2, err := NewManager(cfg)
+	require.NoError(t, err)
+	cert2, err := m2.GetCertificate(&tls.ClientHelloInfo{})
+	require.NoError(t, err)
+	require.Equal(t, cert.Leaf.Raw, cert2.Leaf.Raw)
+}
@@ -0,0 +1,123 @@
+package acmec
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+const (
+	ChallengeHTTP01 = "http-01"
+	ChallengeDNS01  = "dns-01"
+)
+
+// Solver fulfills ACME challenges of a single type. The value is the key authorization for http-01 challenges,
+// and the TXT record content for dns-01 challenges.
+type Solver interface {
+	Type() string
+	Present(ctx context.Context, domain, token, value string) error
+	CleanUp(ctx context.Context, domain, token, value string) error
+}
+
+// HTTPSolver answers http-01 challenges with its own http server, which must be reachable on port 80 of the domains
+type HTTPSolver struct {
+	addr string
+
+	tokens map[string]string
+	mu     sync.RWMutex
+}
+
+func NewHTTPSolver(addr string) *HTTPSolver {
+	return &HTTPSolver{addr: addr, tokens: map[string]string{}}
+}
+
+func (s *HTTPSolver) Type() string { return ChallengeHTTP01 }
+
+func (s *HTTPSolver) Present(_ context.Context, _, token, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tokens[token] = value
+	return nil
+}
+
+func (s *HTTPSolver) CleanUp(_ context.Context, _, token, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tokens, token)
+	return nil
+}
+
+func (s *HTTPSolver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.URL.Path, "/.well-known/acme-challenge/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.RLock()
+	value, ok := s.tokens[token]
+	s.mu.RUnlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte(value))
+}
+
+func (s *HTTPSolver) Run(ctx context.Context) error {
+	l, err := net.Listen("tcp", s.addr)
+	if err != nil {
+		return kleverr.Newf("cannot listen for acme challenges: %w", err)
+	}
+
+	srv := &http.Server{Handler: s, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return kleverr.Ret(err)
+	}
+	return ctx.Err()
+}
+
+// DNSHookSolver answers dns-01 challenges by running a command, which is called with
+// "present <fqdn> <value>" to create the TXT record, and "cleanup <fqdn> <value>" to remove it
+type DNSHookSolver struct {
+	command string
+}
+
+func NewDNSHookSolver(command string) *DNSHookSolver {
+	return &DNSHookSolver{command: command}
+}
+
+func (s *DNSHookSolver) Type() string { return ChallengeDNS01 }
+
+func (s *DNSHookSolver) Present(ctx context.Context, domain, _, value string) error {
+	return s.run(ctx, "present", domain, value)
+}
+
+func (s *DNSHookSolver) CleanUp(ctx context.Context, domain, _, value string) error {
+	return s.run(ctx, "cleanup", domain, value)
+}
+
+func (s *DNSHookSolver) run(ctx context.Context, action, domain, value string) error {
+	fqdn := "_acme-challenge." + strings.TrimPrefix(domain, "*.") + "."
+	out, err := exec.CommandContext(ctx, s.command, action, fqdn, value).CombinedOutput()
+	if err != nil {
+		return kleverr.Newf("dns hook %s failed: %w: %s", action, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
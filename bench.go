@@ -0,0 +1,321 @@
+package connet
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/klev-dev/kleverr"
+	"github.com/quic-go/quic-go"
+	"golang.org/x/sync/errgroup"
+)
+
+type BenchConfig struct {
+	// Name prefixes the generated forward names, which control must allow for the client. Defaults to connet-bench.
+	Name string
+	// Routes to measure, each over its own forward. Defaults to direct and relay.
+	Routes []model.RouteOption
+	// Pings is the number of round trips to measure latency with. Defaults to 100.
+	Pings int
+	// Duration of each throughput measurement. Defaults to 3s.
+	Duration time.Duration
+	// Timeout to wait for the routes to be established. Defaults to 10s.
+	Timeout time.Duration
+}
+
+// BenchResult are the measurements over a route, throughputs are in bytes per second
+type BenchResult struct {
+	Route      string        `json:"route"`
+	Pings      int           `json:"pings"`
+	LatencyMin time.Duration `json:"latency_min"`
+	LatencyAvg time.Duration `json:"latency_avg"`
+	LatencyP50 time.Duration `json:"latency_p50"`
+	LatencyP99 time.Duration `json:"latency_p99"`
+	Download   float64       `json:"download"` // from the destination to the source
+	Upload     float64       `json:"upload"`   // from the source to the destination
+	Error      string        `json:"error,omitempty"`
+}
+
+const (
+	benchEcho     byte = 'e'
+	benchDownload byte = 'd'
+	benchUpload   byte = 'u'
+
+	benchPingSize  = 64
+	benchChunkSize = 32 * 1024
+)
+
+// Bench runs a temporary client, configured by opts, with a destination and a source for each route in cfg.
+// The destinations connect to a local traffic generator, and the source measures latency and throughput through them.
+func Bench(ctx context.Context, cfg BenchConfig, opts ...ClientOption) ([]BenchResult, error) {
+	if cfg.Name == "" {
+		cfg.Name = "connet-bench"
+	}
+	if len(cfg.Routes) == 0 {
+		cfg.Routes = []model.RouteOption{model.RouteDirect, model.RouteRelay}
+	}
+	if cfg.Pings == 0 {
+		cfg.Pings = 100
+	}
+	if cfg.Duration == 0 {
+		cfg.Duration = 3 * time.Second
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, kleverr.Newf("cannot listen for bench traffic: %w", err)
+	}
+	defer l.Close()
+
+	name := model.GenServerName(cfg.Name)
+	forwards := map[model.RouteOption]model.Forward{}
+	for _, route := range cfg.Routes {
+		fwd := model.NewForward(fmt.Sprintf("%s-%s", name, route))
+		forwards[route] = fwd
+		opts = append(opts,
+			ClientDestination(fwd.String(), l.Addr().String(), route),
+			ClientSource(fwd.String(), "", route))
+	}
+	opts = append(opts, func(cfg *clientConfig) error {
+		cfg.unbound = true
+		return nil
+	})
+
+	c, err := NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return c.Run(ctx) })
+	g.Go(func() error { return runBenchServer(ctx, l) })
+
+	var results []BenchResult
+	g.Go(func() error {
+		defer cancel()
+
+		for _, route := range cfg.Routes {
+			fwd := forwards[route]
+			result := BenchResult{Route: route.String()}
+			if err := c.benchWait(ctx, fwd, cfg.Timeout); err != nil {
+				result.Error = err.Error()
+			} else if err := c.bench(ctx, fwd, cfg, &result); err != nil {
+				result.Error = err.Error()
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			results = append(results, result)
+		}
+		return nil
+	})
+
+	err = g.Wait()
+	if len(results) < len(cfg.Routes) {
+		// the client stopped before measuring all routes, e.g. it failed to authenticate
+		return nil, err
+	}
+	return results, nil
+}
+
+// benchWait waits for the source of fwd to have a route to its destination
+func (c *Client) benchWait(ctx context.Context, fwd model.Forward, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for {
+		if status := c.Status(); len(status.Sources[fwd.String()].Routes) > 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return kleverr.Newf("no route within %s", timeout)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func (c *Client) bench(ctx context.Context, fwd model.Forward, cfg BenchConfig, result *BenchResult) error {
+	src := c.srcs[fwd]
+
+	latencies, err := benchLatency(ctx, src.Dial, cfg.Pings)
+	if err != nil {
+		return kleverr.Newf("cannot measure latency: %w", err)
+	}
+	slices.Sort(latencies)
+	var total time.Duration
+	for _, d := range latencies {
+		total += d
+	}
+	result.Pings = len(latencies)
+	result.LatencyMin = latencies[0]
+	result.LatencyAvg = total / time.Duration(len(latencies))
+	result.LatencyP50 = latencies[len(latencies)/2]
+	result.LatencyP99 = latencies[len(latencies)*99/100]
+
+	if result.Download, err = benchDownloadRate(ctx, src.Dial, cfg.Duration); err != nil {
+		return kleverr.Newf("cannot measure download: %w", err)
+	}
+	if result.Upload, err = benchUploadRate(ctx, src.Dial, cfg.Duration); err != nil {
+		return kleverr.Newf("cannot measure upload: %w", err)
+	}
+	return nil
+}
+
+type benchDialer func(ctx context.Context) (quic.Stream, error)
+
+func benchOpen(ctx context.Context, dial benchDialer, mode byte, arg uint64) (quic.Stream, error) {
+	stream, err := dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := binary.BigEndian.AppendUint64([]byte{mode}, arg)
+	if _, err := stream.Write(header); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+func benchLatency(ctx context.Context, dial benchDialer, pings int) ([]time.Duration, error) {
+	stream, err := benchOpen(ctx, dial, benchEcho, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	buf := make([]byte, benchPingSize)
+	latencies := make([]time.Duration, 0, pings)
+	for range pings {
+		start := time.Now()
+		if _, err := stream.Write(buf); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(stream, buf); err != nil {
+			return nil, err
+		}
+		latencies = append(latencies, time.Since(start))
+	}
+	return latencies, nil
+}
+
+func benchDownloadRate(ctx context.Context, dial benchDialer, duration time.Duration) (float64, error) {
+	stream, err := benchOpen(ctx, dial, benchDownload, uint64(duration))
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+
+	start := time.Now()
+	n, err := io.Copy(io.Discard, stream)
+	if err != nil {
+		return 0, err
+	}
+	return float64(n) / time.Since(start).Seconds(), nil
+}
+
+func benchUploadRate(ctx context.Context, dial benchDialer, duration time.Duration) (float64, error) {
+	stream, err := benchOpen(ctx, dial, benchUpload, uint64(duration))
+	if err != nil {
+		return 0, err
+	}
+	defer stream.Close()
+
+	// writes until the destination reports how much it received
+	defer stream.CancelWrite(0)
+	go func() {
+		buf := make([]byte, benchChunkSize)
+		for {
+			if _, err := stream.Write(buf); err != nil {
+				return
+			}
+		}
+	}()
+
+	var received [8]byte
+	if _, err := io.ReadFull(stream, received[:]); err != nil {
+		return 0, err
+	}
+	return float64(binary.BigEndian.Uint64(received[:])) / duration.Seconds(), nil
+}
+
+func runBenchServer(ctx context.Context, l net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return kleverr.Ret(err)
+		}
+		go func() {
+			defer conn.Close()
+			serveBench(conn)
+		}()
+	}
+}
+
+// serveBench answers a single bench request, see benchOpen
+func serveBench(conn net.Conn) error {
+	var header [9]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return err
+	}
+	arg := binary.BigEndian.Uint64(header[1:])
+
+	switch header[0] {
+	case benchEcho:
+		_, err := io.Copy(conn, conn)
+		return err
+	case benchDownload:
+		buf := make([]byte, benchChunkSize)
+		deadline := time.Now().Add(time.Duration(arg))
+		for time.Now().Before(deadline) {
+			if _, err := conn.Write(buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	case benchUpload:
+		if err := conn.SetReadDeadline(time.Now().Add(time.Duration(arg))); err != nil {
+			return err
+		}
+		n, err := io.Copy(io.Discard, conn)
+		if err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			return err
+		}
+		if _, err := conn.Write(binary.BigEndian.AppendUint64(nil, uint64(n))); err != nil {
+			return err
+		}
+		// keep reading until the source stops writing, closing with unread data resets the conn and loses the count
+		if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+			return err
+		}
+		if err := conn.SetReadDeadline(time.Time{}); err != nil {
+			return err
+		}
+		_, err = io.Copy(io.Discard, conn)
+		return err
+	default:
+		return fmt.Errorf("unknown bench mode %q", header[0])
+	}
+}
@@ -39,6 +39,8 @@ func FromTLS(tlsCert tls.Certificate) *Cert {
 type CertOpts struct {
 	Domains []string
 	IPs     []net.IP
+	// Validity defaults to 90 days
+	Validity time.Duration
 }
 
 type certType struct{ string }
@@ -49,8 +51,29 @@ var (
 	clientCert       = certType{"client"}
 )
 
+// default validity of new certificates
+const defaultValidity = 90 * 24 * time.Hour
+
+type RootOpts struct {
+	// Algorithm of the root key, which its certificates also use. Defaults to Ed25519.
+	Algorithm x509.PublicKeyAlgorithm
+	// Validity defaults to 90 days
+	Validity time.Duration
+}
+
 func NewRoot() (*Cert, error) {
-	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	return NewRootOpts(RootOpts{})
+}
+
+func NewRootOpts(opts RootOpts) (*Cert, error) {
+	if opts.Algorithm == x509.UnknownPublicKeyAlgorithm {
+		opts.Algorithm = x509.Ed25519
+	}
+	if opts.Validity == 0 {
+		opts.Validity = defaultValidity
+	}
+
+	priv, err := generateKey(opts.Algorithm)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +82,7 @@ func NewRoot() (*Cert, error) {
 		SerialNumber: big.NewInt(time.Now().UnixMicro()),
 
 		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(90 * 24 * time.Hour),
+		NotAfter:  time.Now().Add(opts.Validity),
 
 		Subject: SharedSubject,
 
@@ -70,32 +93,43 @@ func NewRoot() (*Cert, error) {
 		ExtKeyUsage: []x509.ExtKeyUsage{},
 	}
 
-	der, err := x509.CreateCertificate(rand.Reader, template, template, pub, priv)
+	der, err := x509.CreateCertificate(rand.Reader, template, template, priv.Public(), priv)
 	if err != nil {
 		return nil, err
 	}
 	return &Cert{der, priv}, nil
 }
 
+func generateKey(alg x509.PublicKeyAlgorithm) (crypto.Signer, error) {
+	switch alg {
+	case x509.RSA:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case x509.ECDSA:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case x509.Ed25519:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	default:
+		return nil, kleverr.Newf("unsupported key algorithm: %s", alg)
+	}
+}
+
 func (c *Cert) new(opts CertOpts, typ certType) (*Cert, error) {
 	parent, err := x509.ParseCertificate(c.der)
 	if err != nil {
 		return nil, err
 	}
 
-	var priv crypto.PrivateKey
-	switch parent.PublicKeyAlgorithm {
-	case x509.RSA:
-		priv, err = rsa.GenerateKey(rand.Reader, 4096)
-	case x509.ECDSA:
-		priv, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
-	case x509.Ed25519:
-		_, priv, err = ed25519.GenerateKey(rand.Reader)
-	}
+	priv, err := generateKey(parent.PublicKeyAlgorithm)
 	if err != nil {
 		return nil, err
 	}
 
+	validity := opts.Validity
+	if validity == 0 {
+		validity = defaultValidity
+	}
+
 	csrTemplate := &x509.CertificateRequest{
 		Subject: SharedSubject,
 
@@ -123,7 +157,7 @@ func (c *Cert) new(opts CertOpts, typ certType) (*Cert, error) {
 		SerialNumber: big.NewInt(time.Now().UnixMicro()),
 
 		NotBefore: time.Now(),
-		NotAfter:  time.Now().Add(90 * 24 * time.Hour),
+		NotAfter:  time.Now().Add(validity),
 
 		Issuer:  parent.Subject,
 		Subject: csr.Subject,
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"testing"
+	"time"
 
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
@@ -76,6 +77,35 @@ func TestChainRoot(t *testing.T) {
 	testConnectivityDyn(t, serverCert, caPool, clientCert, caPool)
 }
 
+func TestRootAlgorithms(t *testing.T) {
+	for _, alg := range []x509.PublicKeyAlgorithm{x509.Ed25519, x509.ECDSA, x509.RSA} {
+		t.Run(alg.String(), func(t *testing.T) {
+			root, err := NewRootOpts(RootOpts{Algorithm: alg, Validity: 365 * 24 * time.Hour})
+			require.NoError(t, err)
+			rootCert, err := root.Cert()
+			require.NoError(t, err)
+			require.Equal(t, alg, rootCert.PublicKeyAlgorithm)
+			require.WithinDuration(t, time.Now().Add(365*24*time.Hour), rootCert.NotAfter, time.Minute)
+			caPool, err := root.CertPool()
+			require.NoError(t, err)
+
+			server, err := root.NewServer(CertOpts{Domains: []string{"zzz"}, Validity: time.Hour})
+			require.NoError(t, err)
+			serverCert, err := server.TLSCert()
+			require.NoError(t, err)
+			require.Equal(t, alg, serverCert.Leaf.PublicKeyAlgorithm)
+			require.WithinDuration(t, time.Now().Add(time.Hour), serverCert.Leaf.NotAfter, time.Minute)
+
+			client, err := root.NewClient(CertOpts{Domains: []string{"zzz"}})
+			require.NoError(t, err)
+			clientCert, err := client.TLSCert()
+			require.NoError(t, err)
+
+			testConnectivity(t, serverCert, caPool, clientCert, caPool)
+		})
+	}
+}
+
 func TestExchange(t *testing.T) {
 	serverRoot, err := NewRoot()
 	require.NoError(t, err)
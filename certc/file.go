@@ -0,0 +1,100 @@
+package certc
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+// how often to check certificate files for changes
+const certFileCheckInterval = 5 * time.Second
+
+// CertFile is a certificate loaded from a pair of pem files, reloaded when they change. New handshakes get the latest
+// certificate through GetCertificate, while existing connections keep the one they negotiated.
+type CertFile struct {
+	certFile string
+	keyFile  string
+	logger   *slog.Logger
+
+	cert  atomic.Pointer[tls.Certificate]
+	stats [2]os.FileInfo
+}
+
+func NewCertFile(certFile, keyFile string, logger *slog.Logger) (*CertFile, error) {
+	f := &CertFile{
+		certFile: certFile,
+		keyFile:  keyFile,
+		logger:   logger.With("cert-file", certFile),
+	}
+	if _, err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *CertFile) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return f.cert.Load(), nil
+}
+
+// Certificate returns the currently loaded certificate
+func (f *CertFile) Certificate() tls.Certificate {
+	return *f.cert.Load()
+}
+
+func (f *CertFile) Run(ctx context.Context) error {
+	t := time.NewTicker(certFileCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		switch changed, err := f.reload(); {
+		case err != nil:
+			// the files might be in the middle of being replaced, which is retried on the next check
+			f.logger.Warn("cannot reload certificate, keeping previous", "err", err)
+		case changed:
+			f.logger.Info("reloaded certificate", "not-after", f.cert.Load().Leaf.NotAfter)
+		}
+	}
+}
+
+// reload loads the certificate again if the modification time or size of either file changed
+func (f *CertFile) reload() (bool, error) {
+	var stats [2]os.FileInfo
+	for i, path := range []string{f.certFile, f.keyFile} {
+		stat, err := os.Stat(path)
+		if err != nil {
+			return false, kleverr.Newf("cannot stat certificate file: %w", err)
+		}
+		stats[i] = stat
+	}
+	if f.unchanged(stats) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.certFile, f.keyFile)
+	if err != nil {
+		return false, kleverr.Newf("cannot load certificate: %w", err)
+	}
+	f.cert.Store(&cert)
+	f.stats = stats
+	return true, nil
+}
+
+func (f *CertFile) unchanged(stats [2]os.FileInfo) bool {
+	for i, stat := range stats {
+		if f.stats[i] == nil || !stat.ModTime().Equal(f.stats[i].ModTime()) || stat.Size() != f.stats[i].Size() {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package certc
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertFile(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+
+	root, err := NewRoot()
+	require.NoError(t, err)
+
+	mtime := time.Now()
+	write := func(cert *Cert) {
+		certPEM, keyPEM, err := cert.EncodeToMemory()
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(certPath, certPEM, 0600))
+		require.NoError(t, os.WriteFile(keyPath, keyPEM, 0600))
+		mtime = mtime.Add(time.Second)
+		require.NoError(t, os.Chtimes(certPath, mtime, mtime))
+		require.NoError(t, os.Chtimes(keyPath, mtime, mtime))
+	}
+
+	first, err := root.NewServer(CertOpts{Domains: []string{"localhost"}})
+	require.NoError(t, err)
+	write(first)
+
+	f, err := NewCertFile(certPath, keyPath, slog.Default())
+	require.NoError(t, err)
+	require.Equal(t, first.Raw(), f.Certificate().Leaf.Raw)
+
+	changed, err := f.reload()
+	require.NoError(t, err)
+	require.False(t, changed)
+
+	second, err := root.NewServer(CertOpts{Domains: []string{"localhost"}})
+	require.NoError(t, err)
+	write(second)
+
+	changed, err = f.reload()
+	require.NoError(t, err)
+	require.True(t, changed)
+	cert, err := f.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, second.Raw(), cert.Leaf.Raw)
+
+	// a cert without its key yet (e.g. while being replaced) keeps the previous one
+	third, err := root.NewServer(CertOpts{Domains: []string{"localhost"}})
+	require.NoError(t, err)
+	certPEM, _, err := third.EncodeToMemory()
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(certPath, certPEM, 0600))
+	require.NoError(t, os.Chtimes(certPath, mtime.Add(time.Second), mtime.Add(time.Second)))
+
+	_, err = f.reload()
+	require.Error(t, err)
+	require.Equal(t, second.Raw(), f.Certificate().Leaf.Raw)
+}
@@ -11,6 +11,7 @@ import (
 	"net/netip"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/connet-dev/connet/certc"
@@ -19,6 +20,8 @@ import (
 	"github.com/connet-dev/connet/netc"
 	"github.com/connet-dev/connet/pb"
 	"github.com/connet-dev/connet/pbs"
+	"github.com/connet-dev/connet/portmap"
+	"github.com/connet-dev/connet/quicc"
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
@@ -30,6 +33,29 @@ type Client struct {
 	rootCert *certc.Cert
 	dsts     map[model.Forward]*client.Destination
 	srcs     map[model.Forward]*client.Source
+
+	directAddrs   clientDirectAddrs
+	directAddrsMu sync.Mutex
+
+	controlStatus ClientControlStatus
+	statusMu      sync.Mutex
+}
+
+type clientDirectAddrs struct {
+	local  []netip.AddrPort
+	public netip.AddrPort
+	mapped netip.AddrPort
+}
+
+func (a clientDirectAddrs) all() []netip.AddrPort {
+	addrs := append([]netip.AddrPort{}, a.local...)
+	if a.public.IsValid() {
+		addrs = append(addrs, a.public)
+	}
+	if a.mapped.IsValid() && a.mapped != a.public {
+		addrs = append(addrs, a.mapped)
+	}
+	return addrs
 }
 
 func NewClient(opts ...ClientOption) (*Client, error) {
@@ -42,7 +68,7 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 		}
 	}
 
-	if cfg.controlAddr == nil {
+	if cfg.controlAddr == "" {
 		if err := ClientControlAddress("127.0.0.1:19190")(cfg); err != nil {
 			return nil, kleverr.Ret(err)
 		}
@@ -67,76 +93,174 @@ func NewClient(opts ...ClientOption) (*Client, error) {
 	return &Client{
 		clientConfig: *cfg,
 
-		rootCert: rootCert,
+		rootCert:      rootCert,
+		controlStatus: ClientControlStatus{State: ClientControlConnecting, Since: time.Now()},
 	}, nil
 }
 
 func (c *Client) Run(ctx context.Context) error {
 	c.logger.Debug("start udp listener")
-	udpConn, err := net.ListenUDP("udp", c.directAddr)
+	udpConn, err := c.quicConf.ListenUDP(c.directAddr)
 	if err != nil {
-		return kleverr.Ret(err)
+		return err
 	}
 	defer udpConn.Close()
+	if c.directAddr.Port == 0 {
+		// advertise the port picked by the system
+		c.directAddr = udpConn.LocalAddr().(*net.UDPAddr)
+	}
 
 	c.logger.Debug("start quic listener")
 	transport := &quic.Transport{
 		Conn: udpConn,
-		// TODO review other options
 	}
 	defer transport.Close()
 
-	ds, err := client.NewDirectServer(transport, c.logger)
+	ds, err := client.NewDirectServer(transport, c.quicConf, c.logger)
 	if err != nil {
 		return kleverr.Ret(err)
 	}
 
-	c.dsts = map[model.Forward]*client.Destination{}
+	dsts := map[model.Forward]*client.Destination{}
 	for fwd, cfg := range c.destinations {
-		c.dsts[fwd], err = client.NewDestination(fwd, cfg.addr, cfg.route, ds, c.rootCert, c.logger)
+		dsts[fwd], err = client.NewDestination(fwd, cfg.addr, cfg.route, cfg.timeouts, ds, c.rootCert, c.logger)
 		if err != nil {
 			return kleverr.Ret(err)
 		}
 	}
 
-	c.srcs = map[model.Forward]*client.Source{}
+	srcs := map[model.Forward]*client.Source{}
 	for fwd, cfg := range c.sources {
-		c.srcs[fwd], err = client.NewSource(fwd, cfg.addr, cfg.route, ds, c.rootCert, c.logger)
+		srcs[fwd], err = client.NewSource(fwd, cfg.addr, cfg.route, cfg.timeouts, ds, c.rootCert, c.logger)
 		if err != nil {
 			return kleverr.Ret(err)
 		}
 	}
 
-	g, ctx := errgroup.WithContext(ctx)
+	c.statusMu.Lock()
+	c.dsts, c.srcs = dsts, srcs
+	c.statusMu.Unlock()
+
+	// connections to peers outlive ctx while draining, only the control connection and listening stop with it
+	runCtx := ctx
+	g, ctx := errgroup.WithContext(context.WithoutCancel(ctx))
+	g.Go(func() error {
+		select {
+		case <-runCtx.Done():
+		case <-ctx.Done():
+			return nil
+		}
+		if c.drainTimeout > 0 {
+			c.drain(ctx)
+		}
+		return context.Cause(runCtx)
+	})
 
 	g.Go(func() error { return ds.Run(ctx) })
 
 	for _, dst := range c.dsts {
-		g.Go(func() error { return dst.Run(ctx) })
+		if c.refusing {
+			g.Go(func() error { return dst.RunPeer(ctx) })
+		} else {
+			g.Go(func() error { return dst.Run(ctx) })
+		}
 	}
 
 	for _, src := range c.srcs {
-		g.Go(func() error { return src.Run(ctx) })
+		if c.unbound {
+			g.Go(func() error { return src.RunPeer(ctx) })
+		} else {
+			g.Go(func() error { return src.Run(ctx) })
+		}
 	}
 
-	g.Go(func() error { return c.run(ctx, transport) })
+	if c.events != nil {
+		for fwd, dst := range c.dsts {
+			g.Go(func() error { return c.runRoutes(ctx, fwd, model.Destination, dst.RoutesListen) })
+		}
+		for fwd, src := range c.srcs {
+			g.Go(func() error { return c.runRoutes(ctx, fwd, model.Source, src.RoutesListen) })
+		}
+	}
 
-	return g.Wait()
+	if c.statusAddr != "" {
+		g.Go(func() error { return c.runStatus(ctx) })
+	}
+
+	if c.portMapping {
+		mapper, err := portmap.New(portmap.Config{
+			Port:    c.directAddr.AddrPort().Port(),
+			Gateway: c.portMappingGateway,
+			Logger:  c.logger,
+		})
+		if err != nil {
+			return kleverr.Ret(err)
+		}
+		g.Go(func() error { return mapper.Run(ctx) })
+		g.Go(func() error {
+			return mapper.Listen(ctx, func(addr netip.AddrPort) error {
+				c.updateDirectAddrs(func(addrs *clientDirectAddrs) {
+					addrs.mapped = addr
+				})
+				return nil
+			})
+		})
+	}
+
+	g.Go(func() error {
+		err := c.run(runCtx, transport)
+		if runCtx.Err() != nil {
+			return nil // closing the control connection revokes the announcements, the drain continues without it
+		}
+		return err
+	})
+
+	err = g.Wait()
+	if err != nil && !errors.Is(err, context.Canceled) {
+		c.emit(ClientEvent{Type: ClientTerminated, Err: err})
+	}
+	return err
+}
+
+// drain stops sources from accepting new conns and waits, up to the drain timeout, for the ones in flight to finish
+func (c *Client) drain(ctx context.Context) {
+	c.logger.Info("draining", "timeout", c.drainTimeout)
+	ctx, cancel := context.WithTimeout(ctx, c.drainTimeout)
+	defer cancel()
+
+	g, ctx := errgroup.WithContext(ctx)
+	for _, src := range c.srcs {
+		g.Go(func() error { return src.Drain(ctx) })
+	}
+	for _, dst := range c.dsts {
+		g.Go(func() error { return dst.Drain(ctx) })
+	}
+	if err := g.Wait(); err != nil {
+		c.logger.Warn("drain timed out, closing conns in flight", "timeout", c.drainTimeout)
+		return
+	}
+	c.logger.Info("drained")
 }
 
 func (c *Client) run(ctx context.Context, transport *quic.Transport) error {
 	conn, retoken, err := c.connect(ctx, transport, nil)
 	if err != nil {
+		if terr := terminalError(err); terr != nil {
+			return terr
+		}
 		return err
 	}
 
 	for {
 		if err := c.runConnection(ctx, conn); err != nil {
+			c.setControlStatus(ClientControlDisconnected, nil, err)
+			c.emit(ClientEvent{Type: ClientDisconnected, Err: err})
 			switch {
 			case errors.Is(err, context.Canceled):
 				return err
-				// TODO other terminal errors
 			}
+			// not checking terminalError, the session might have been closed because of the token,
+			// but reconnecting tells if the current one is still rejected
 			c.logger.Error("session ended", "err", err)
 		}
 
@@ -149,20 +273,12 @@ func (c *Client) run(ctx context.Context, transport *quic.Transport) error {
 var retConnect = kleverr.Ret2[quic.Connection, []byte]
 
 func (c *Client) connect(ctx context.Context, transport *quic.Transport, retoken []byte) (quic.Connection, []byte, error) {
-	c.logger.Debug("dialing target", "addr", c.controlAddr)
-	// TODO dial timeout if server is not accessible?
-	conn, err := transport.Dial(ctx, c.controlAddr, &tls.Config{
-		ServerName: c.controlHost,
-		RootCAs:    c.controlCAs,
-		NextProtos: []string{"connet"},
-	}, &quic.Config{
-		KeepAlivePeriod: 25 * time.Second,
-	})
+	conn, err := c.dial(ctx, transport)
 	if err != nil {
 		return retConnect(err)
 	}
 
-	c.logger.Debug("authenticating", "addr", c.controlAddr)
+	c.logger.Debug("authenticating", "addr", conn.RemoteAddr())
 
 	authStream, err := conn.OpenStreamSync(ctx)
 	if err != nil {
@@ -170,8 +286,15 @@ func (c *Client) connect(ctx context.Context, transport *quic.Transport, retoken
 	}
 	defer authStream.Close()
 
+	token := c.token
+	if c.tokenFile != "" {
+		if token, err = readTokenFile(c.tokenFile); err != nil {
+			return retConnect(err)
+		}
+	}
+
 	if err := pb.Write(authStream, &pbs.Authenticate{
-		Token:          c.token,
+		Token:          token,
 		ReconnectToken: retoken,
 	}); err != nil {
 		return retConnect(err)
@@ -179,6 +302,11 @@ func (c *Client) connect(ctx context.Context, transport *quic.Transport, retoken
 
 	resp := &pbs.AuthenticateResp{}
 	if err := pb.Read(authStream, resp); err != nil {
+		if aerr := pb.GetAppError(err); aerr != nil && aerr.Remote &&
+			aerr.ErrorCode == quic.ApplicationErrorCode(pb.Error_AuthenticationFailed) {
+			// the server closed the connection right after rejecting the token, before the response was read
+			return retConnect(pb.NewError(pb.Error_AuthenticationFailed, "%s", aerr.ErrorMessage))
+		}
 		return retConnect(err)
 	}
 	if resp.Error != nil {
@@ -194,16 +322,56 @@ func (c *Client) connect(ctx context.Context, transport *quic.Transport, retoken
 		localAddrPorts[i] = netip.AddrPortFrom(addr, c.clientConfig.directAddr.AddrPort().Port())
 	}
 
-	directAddrs := append(localAddrPorts, resp.Public.AsNetip())
+	directAddrs := c.updateDirectAddrs(func(addrs *clientDirectAddrs) {
+		addrs.local = localAddrPorts
+		addrs.public = resp.Public.AsNetip()
+	})
+
+	c.logger.Info("authenticated to server", "addr", c.controlAddr, "direct", directAddrs)
+	c.setControlStatus(ClientControlConnected, conn.RemoteAddr(), nil)
+	c.emit(ClientEvent{Type: ClientAuthenticated})
+	return conn, resp.ReconnectToken, nil
+}
+
+// dial resolves the control server address again on each call, connecting to the first of its addresses to respond
+func (c *Client) dial(ctx context.Context, transport *quic.Transport) (quic.Connection, error) {
+	ctx, cancel := context.WithTimeout(ctx, netc.DialTimeout)
+	defer cancel()
+
+	addrs, err := netc.ResolveUDPAddrs(ctx, c.controlAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Debug("dialing target", "addr", c.controlAddr, "resolved", addrs)
+	conn, _, err := netc.DialHappyEyeballs(ctx, addrs, netc.HappyEyeballsDelay,
+		func(ctx context.Context, addr *net.UDPAddr) (quic.Connection, error) {
+			return transport.Dial(ctx, addr, &tls.Config{
+				ServerName:   c.controlHost,
+				RootCAs:      c.controlCAs,
+				Certificates: c.controlCerts,
+				NextProtos:   []string{"connet"},
+			}, c.quicConf.QUIC())
+		}, func(conn quic.Connection) {
+			conn.CloseWithError(0, "connected through another address")
+		})
+	return conn, err
+}
+
+// updateDirectAddrs applies f and sends the resulting direct addresses to all destinations and sources
+func (c *Client) updateDirectAddrs(f func(addrs *clientDirectAddrs)) []netip.AddrPort {
+	c.directAddrsMu.Lock()
+	defer c.directAddrsMu.Unlock()
+
+	f(&c.directAddrs)
+	directAddrs := c.directAddrs.all()
 	for _, d := range c.dsts {
 		d.SetDirectAddrs(directAddrs)
 	}
 	for _, s := range c.srcs {
 		s.SetDirectAddrs(directAddrs)
 	}
-
-	c.logger.Info("authenticated to server", "addr", c.controlAddr, "direct", directAddrs)
-	return conn, resp.ReconnectToken, nil
+	return directAddrs
 }
 
 func (c *Client) reconnect(ctx context.Context, transport *quic.Transport, retoken []byte) (quic.Connection, []byte, error) {
@@ -219,6 +387,10 @@ func (c *Client) reconnect(ctx context.Context, transport *quic.Transport, retok
 		}
 
 		if sess, retoken, err := c.connect(ctx, transport, retoken); err != nil {
+			if terr := terminalError(err); terr != nil {
+				return nil, nil, terr
+			}
+			c.setControlStatus(ClientControlDisconnected, nil, err)
 			c.logger.Debug("reconnect failed, retrying", "err", err)
 		} else {
 			return sess, retoken, nil
@@ -242,27 +414,53 @@ func (c *Client) runConnection(ctx context.Context, conn quic.Connection) error
 		g.Go(func() error { return srcServer.RunControl(ctx, conn) })
 	}
 
+	if len(c.dsts) == 0 && len(c.srcs) == 0 {
+		// nothing to announce, keep the connection until it is closed
+		g.Go(func() error {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-conn.Context().Done():
+				return context.Cause(conn.Context())
+			}
+		})
+	}
+
 	return g.Wait()
 }
 
 type clientConfig struct {
-	token string
+	token     string
+	tokenFile string
 
-	controlAddr *net.UDPAddr
-	controlHost string
-	controlCAs  *x509.CertPool
+	controlAddr  string
+	controlHost  string
+	controlCAs   *x509.CertPool
+	controlCerts []tls.Certificate
 
 	directAddr *net.UDPAddr
 
+	portMapping        bool
+	portMappingGateway string
+
+	quicConf quicc.Config
+
 	destinations map[model.Forward]clientForwardConfig
 	sources      map[model.Forward]clientForwardConfig
 
+	statusAddr   string
+	drainTimeout time.Duration
+	unbound      bool // sources do not listen at their addresses, see Diagnose and Bench
+	refusing     bool // destinations refuse all connections, see Diagnose
+
+	events func(ClientEvent)
 	logger *slog.Logger
 }
 
 type clientForwardConfig struct {
-	addr  string
-	route model.RouteOption
+	addr     string
+	route    model.RouteOption
+	timeouts netc.JoinTimeouts
 }
 
 type ClientOption func(cfg *clientConfig) error
@@ -274,22 +472,44 @@ func ClientToken(token string) ClientOption {
 	}
 }
 
+// ClientTokenFile reads the token from the first line of a file, each time the client connects.
+// This allows for short-lived tokens, which are refreshed in the file by an external process.
+func ClientTokenFile(path string) ClientOption {
+	return func(cfg *clientConfig) error {
+		if _, err := readTokenFile(path); err != nil {
+			return err
+		}
+		cfg.tokenFile = path
+		return nil
+	}
+}
+
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", kleverr.Newf("cannot read token file: %w", err)
+	}
+	token, _, _ := strings.Cut(string(data), "\n")
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", kleverr.Newf("no token found in %s", path)
+	}
+	return token, nil
+}
+
+// ClientControlAddress sets the control server host:port, which is resolved again each time the client connects
 func ClientControlAddress(address string) ClientOption {
 	return func(cfg *clientConfig) error {
 		if i := strings.LastIndex(address, ":"); i < 0 {
 			// missing :port, lets give it the default
 			address = fmt.Sprintf("%s:%d", address, 19190)
 		}
-		addr, err := net.ResolveUDPAddr("udp", address)
-		if err != nil {
-			return err
-		}
 		host, _, err := net.SplitHostPort(address)
 		if err != nil {
 			return err
 		}
 
-		cfg.controlAddr = addr
+		cfg.controlAddr = address
 		cfg.controlHost = host
 
 		return nil
@@ -322,6 +542,46 @@ func clientControlCAs(cas *x509.CertPool) ClientOption {
 	}
 }
 
+// ClientControlCertificate authenticates the client with a certificate, for control servers requiring one
+func ClientControlCertificate(certFile, keyFile string) ClientOption {
+	return func(cfg *clientConfig) error {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return kleverr.Newf("client cert cannot be loaded: %w", err)
+		}
+
+		cfg.controlCerts = []tls.Certificate{cert}
+
+		return nil
+	}
+}
+
+func clientControlCertificate(cert tls.Certificate) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.controlCerts = []tls.Certificate{cert}
+
+		return nil
+	}
+}
+
+// ClientStatusAddress serves the client status as json on GET /status, at a tcp address or a unix socket
+// (as unix:<path>). It should only be reachable locally, as it reveals the peers and routes of the client.
+func ClientStatusAddress(address string) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.statusAddr = address
+		return nil
+	}
+}
+
+// ClientDrainTimeout enables a graceful shutdown. When the client is stopped, it disconnects from control
+// (revoking its destinations and sources) and stops accepting conns, but waits up to timeout for the ones in flight.
+func ClientDrainTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.drainTimeout = timeout
+		return nil
+	}
+}
+
 func ClientDirectAddress(address string) ClientOption {
 	return func(cfg *clientConfig) error {
 		addr, err := net.ResolveUDPAddr("udp", address)
@@ -335,12 +595,30 @@ func ClientDirectAddress(address string) ClientOption {
 	}
 }
 
+// ClientPortMapping asks the local gateway (via PCP, NAT-PMP or UPnP-IGD) to forward the direct address port.
+// When gateway is empty, it is discovered from the routing table.
+func ClientPortMapping(gateway string) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.portMapping = true
+		cfg.portMappingGateway = gateway
+		return nil
+	}
+}
+
+// ClientQUICConfig tunes the quic connections to control, relays and peers, and the udp socket of the client
+func ClientQUICConfig(cfg quicc.Config) ClientOption {
+	return func(c *clientConfig) error {
+		c.quicConf = cfg
+		return nil
+	}
+}
+
 func ClientDestination(name, addr string, route model.RouteOption) ClientOption {
 	return func(cfg *clientConfig) error {
 		if cfg.destinations == nil {
 			cfg.destinations = map[model.Forward]clientForwardConfig{}
 		}
-		cfg.destinations[model.NewForward(name)] = clientForwardConfig{addr, route}
+		cfg.destinations[model.NewForward(name)] = clientForwardConfig{addr: addr, route: route}
 		return nil
 	}
 }
@@ -350,7 +628,46 @@ func ClientSource(name, addr string, route model.RouteOption) ClientOption {
 		if cfg.sources == nil {
 			cfg.sources = map[model.Forward]clientForwardConfig{}
 		}
-		cfg.sources[model.NewForward(name)] = clientForwardConfig{addr, route}
+		cfg.sources[model.NewForward(name)] = clientForwardConfig{addr: addr, route: route}
+		return nil
+	}
+}
+
+// ClientDestinationTimeouts closes conns to the destination name when they are idle or reach their max lifetime.
+// The destination must be added before, with ClientDestination.
+func ClientDestinationTimeouts(name string, timeouts netc.JoinTimeouts) ClientOption {
+	return func(cfg *clientConfig) error {
+		fwd := model.NewForward(name)
+		dst, ok := cfg.destinations[fwd]
+		if !ok {
+			return kleverr.Newf("destination %s is not defined", name)
+		}
+		dst.timeouts = timeouts
+		cfg.destinations[fwd] = dst
+		return nil
+	}
+}
+
+// ClientSourceTimeouts closes conns accepted by the source name when they are idle or reach their max lifetime.
+// The source must be added before, with ClientSource.
+func ClientSourceTimeouts(name string, timeouts netc.JoinTimeouts) ClientOption {
+	return func(cfg *clientConfig) error {
+		fwd := model.NewForward(name)
+		src, ok := cfg.sources[fwd]
+		if !ok {
+			return kleverr.Newf("source %s is not defined", name)
+		}
+		src.timeouts = timeouts
+		cfg.sources[fwd] = src
+		return nil
+	}
+}
+
+// ClientEvents calls fn on lifecycle changes, like (re)connecting to the control server or peers being added.
+// fn is called synchronously, possibly concurrently, from the client goroutines and should not block.
+func ClientEvents(fn func(ClientEvent)) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.events = fn
 		return nil
 	}
 }
@@ -17,16 +17,18 @@ import (
 )
 
 type Destination struct {
-	fwd    model.Forward
-	addr   string
-	opt    model.RouteOption
-	logger *slog.Logger
-
-	peer  *peer
-	conns map[peerConnKey]*destinationConn
+	fwd      model.Forward
+	addr     string
+	opt      model.RouteOption
+	timeouts netc.JoinTimeouts
+	logger   *slog.Logger
+
+	peer    *peer
+	conns   map[peerConnKey]*destinationConn
+	refuses bool
 }
 
-func NewDestination(fwd model.Forward, addr string, opt model.RouteOption, direct *DirectServer, root *certc.Cert, logger *slog.Logger) (*Destination, error) {
+func NewDestination(fwd model.Forward, addr string, opt model.RouteOption, timeouts netc.JoinTimeouts, direct *DirectServer, root *certc.Cert, logger *slog.Logger) (*Destination, error) {
 	logger = logger.With("destination", fwd)
 	p, err := newPeer(direct, root, logger)
 	if err != nil {
@@ -37,10 +39,11 @@ func NewDestination(fwd model.Forward, addr string, opt model.RouteOption, direc
 	}
 
 	return &Destination{
-		fwd:    fwd,
-		addr:   addr,
-		opt:    opt,
-		logger: logger,
+		fwd:      fwd,
+		addr:     addr,
+		opt:      opt,
+		timeouts: timeouts,
+		logger:   logger,
 
 		peer:  p,
 		conns: map[peerConnKey]*destinationConn{},
@@ -55,6 +58,18 @@ func (d *Destination) SetDirectAddrs(addrs []netip.AddrPort) {
 	d.peer.setDirectAddrs(addrs)
 }
 
+// RoutesListen calls f with the active routes to peers, each time they change
+func (d *Destination) RoutesListen(ctx context.Context, f func([]Route) error) error {
+	return d.peer.routesListen(ctx, f)
+}
+
+// RunPeer runs the destination refusing every connect request, e.g. to only check its routes. Sources and relays
+// move on to the other destinations of the forward when refused.
+func (d *Destination) RunPeer(ctx context.Context) error {
+	d.refuses = true
+	return d.Run(ctx)
+}
+
 func (d *Destination) Run(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -65,7 +80,7 @@ func (d *Destination) Run(ctx context.Context) error {
 }
 
 func (d *Destination) runActive(ctx context.Context) error {
-	return d.peer.activeConnsListen(ctx, func(active map[peerConnKey]quic.Connection) error {
+	return d.peer.activeConnsListen(ctx, func(active map[peerConnKey]*peerConn) error {
 		d.logger.Debug("active conns", "len", len(active))
 		for peer, conn := range active {
 			if dc := d.conns[peer]; dc != nil {
@@ -94,12 +109,12 @@ func (d *Destination) runActive(ctx context.Context) error {
 type destinationConn struct {
 	dst  *Destination
 	peer peerConnKey
-	conn quic.Connection
+	conn *peerConn
 
 	closer chan struct{}
 }
 
-func newDestinationConn(dst *Destination, peer peerConnKey, conn quic.Connection) *destinationConn {
+func newDestinationConn(dst *Destination, peer peerConnKey, conn *peerConn) *destinationConn {
 	return &destinationConn{dst, peer, conn, make(chan struct{})}
 }
 
@@ -108,13 +123,13 @@ func (d *destinationConn) run(ctx context.Context) {
 
 	g.Go(func() error {
 		for {
-			stream, err := d.conn.AcceptStream(ctx)
+			stream, err := d.conn.conn.AcceptStream(ctx)
 			if err != nil {
 				d.dst.logger.Debug("accept failed", "peer", d.peer.id, "style", d.peer.style, "err", err)
 				return err
 			}
 			d.dst.logger.Debug("accepted stream from", "peer", d.peer.id, "style", d.peer.style)
-			go d.dst.runDestination(ctx, stream)
+			go d.dst.runDestination(ctx, countingStream{stream, d.conn.stats}, d.conn)
 		}
 	})
 	g.Go(func() error {
@@ -131,15 +146,15 @@ func (d *destinationConn) close() {
 	close(d.closer)
 }
 
-func (d *Destination) runDestination(ctx context.Context, stream quic.Stream) {
+func (d *Destination) runDestination(ctx context.Context, stream quic.Stream, conn *peerConn) {
 	defer stream.Close()
 
-	if err := d.runDestinationErr(ctx, stream); err != nil {
+	if err := d.runDestinationErr(ctx, stream, conn); err != nil {
 		d.logger.Debug("done destination")
 	}
 }
 
-func (d *Destination) runDestinationErr(ctx context.Context, stream quic.Stream) error {
+func (d *Destination) runDestinationErr(ctx context.Context, stream quic.Stream, conn *peerConn) error {
 	req, err := pbc.ReadRequest(stream)
 	if err != nil {
 		return err
@@ -147,7 +162,7 @@ func (d *Destination) runDestinationErr(ctx context.Context, stream quic.Stream)
 
 	switch {
 	case req.Connect != nil:
-		return d.runConnect(ctx, stream)
+		return d.runConnect(ctx, stream, conn)
 	case req.Heartbeat != nil:
 		return d.heartbeat(ctx, stream, req.Heartbeat)
 	default:
@@ -159,8 +174,18 @@ func (d *Destination) runDestinationErr(ctx context.Context, stream quic.Stream)
 	}
 }
 
-func (d *Destination) runConnect(ctx context.Context, stream quic.Stream) error {
+func (d *Destination) runConnect(ctx context.Context, stream quic.Stream, pc *peerConn) error {
 	// TODO check allow from?
+	if d.refuses {
+		err := pb.NewError(pb.Error_DestinationNotFound, "%s does not accept connections", d.fwd)
+		if err := pb.Write(stream, &pbc.Response{Error: err}); err != nil {
+			return kleverr.Newf("could not write error response: %w", err)
+		}
+		return err
+	}
+
+	defer d.peer.streams.add()()
+	defer pc.streams.add()()
 
 	conn, err := net.Dial("tcp", d.addr)
 	if err != nil {
@@ -177,8 +202,9 @@ func (d *Destination) runConnect(ctx context.Context, stream quic.Stream) error
 	}
 
 	d.logger.Debug("joining from server")
-	err = netc.Join(ctx, stream, conn)
+	err = netc.Join(ctx, stream, conn, d.timeouts)
 	d.logger.Debug("disconnected from server", "err", err)
+	d.peer.joined(err, d.timeouts)
 
 	return nil
 }
@@ -219,6 +245,12 @@ func (d *Destination) heartbeat(ctx context.Context, stream quic.Stream, hbt *pb
 	return g.Wait()
 }
 
+// Drain waits for the streams in flight to finish, or for ctx to be done. New streams are still accepted,
+// but peers stop opening them once the destination is no longer announced.
+func (d *Destination) Drain(ctx context.Context) error {
+	return d.peer.streams.wait(ctx)
+}
+
 func (d *Destination) RunControl(ctx context.Context, conn quic.Connection) error {
 	return (&peerControl{
 		local: d.peer,
@@ -7,9 +7,9 @@ import (
 	"log/slog"
 	"sync"
 	"sync/atomic"
-	"time"
 
 	"github.com/connet-dev/connet/certc"
+	"github.com/connet-dev/connet/quicc"
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
@@ -17,15 +17,17 @@ import (
 
 type DirectServer struct {
 	transport *quic.Transport
+	quicConf  quicc.Config
 	logger    *slog.Logger
 
 	servers   map[string]*vServer
 	serversMu sync.RWMutex
 }
 
-func NewDirectServer(transport *quic.Transport, logger *slog.Logger) (*DirectServer, error) {
+func NewDirectServer(transport *quic.Transport, quicConf quicc.Config, logger *slog.Logger) (*DirectServer, error) {
 	return &DirectServer{
 		transport: transport,
+		quicConf:  quicConf,
 		logger:    logger.With("component", "direct-server"),
 
 		servers: map[string]*vServer{},
@@ -137,9 +139,7 @@ func (s *DirectServer) runServer(ctx context.Context) error {
 		return conf, nil
 	}
 
-	l, err := s.transport.Listen(tlsConf, &quic.Config{
-		KeepAlivePeriod: 25 * time.Second,
-	})
+	l, err := s.transport.Listen(tlsConf, s.quicConf.QUIC())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,57 @@
+package client
+
+import (
+	"context"
+	"errors"
+
+	"github.com/connet-dev/connet/notify"
+	"github.com/quic-go/quic-go"
+)
+
+// inflight counts the forwarded streams which are still joined, so closing can wait for them
+type inflight struct {
+	count *notify.V[int]
+}
+
+func newInflight() inflight {
+	return inflight{notify.New(0)}
+}
+
+// add counts a stream until the returned func is called
+func (f inflight) add() func() {
+	f.count.Update(func(n int) int { return n + 1 })
+	return func() {
+		f.count.Update(func(n int) int { return n - 1 })
+	}
+}
+
+var errDrained = errors.New("drained")
+
+// wait blocks until there are no streams in flight, or ctx is done
+func (f inflight) wait(ctx context.Context) error {
+	err := f.count.Listen(ctx, func(n int) error {
+		if n == 0 {
+			return errDrained
+		}
+		return nil
+	})
+	if errors.Is(err, errDrained) {
+		return nil
+	}
+	return err
+}
+
+// closeAfter closes the connection. When the peering was stopped (e.g. the remote revoked its announcement
+// while draining) it is closed only after the streams in flight over it are done, so they are not cut off.
+func (c *peerConn) closeAfter(ctx context.Context, code quic.ApplicationErrorCode, reason string) {
+	if !errors.Is(context.Cause(ctx), errPeeringStop) {
+		c.conn.CloseWithError(code, reason)
+		return
+	}
+
+	go func() {
+		// the remote closes the connection when its drain times out
+		c.streams.wait(c.conn.Context())
+		c.conn.CloseWithError(code, reason)
+	}()
+}
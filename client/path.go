@@ -0,0 +1,159 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+const (
+	// a heartbeat taking longer than this is counted as late
+	pathLateThreshold = time.Second
+	// how much slower a path with only late heartbeats is considered
+	pathLatePenalty = 4
+)
+
+// peerConn is an active connection to a peer, together with the quality estimates of its path
+type peerConn struct {
+	conn    quic.Connection
+	stats   *pathStats
+	streams inflight
+}
+
+func newPeerConn(conn quic.Connection, stats *pathStats) *peerConn {
+	return &peerConn{conn, stats, newInflight()}
+}
+
+// pathStats keeps smoothed estimates of RTT, late heartbeats and traffic, updated on each heartbeat.
+// Heartbeats go over a reliable stream, so packet loss shows up as late heartbeats (retransmits) instead.
+type pathStats struct {
+	bytes atomic.Int64
+
+	mu         sync.Mutex
+	quality    pathQuality
+	lastBytes  int64
+	lastSample time.Time
+}
+
+type pathQuality struct {
+	samples int
+	rtt     time.Duration
+	late    float64 // ratio of heartbeats slower than pathLateThreshold
+	traffic float64 // bytes per second forwarded through the path, not its capacity
+}
+
+func newPathStats() *pathStats {
+	return &pathStats{lastSample: time.Now()}
+}
+
+// observe records a heartbeat measured on this side of the path
+func (s *pathStats) observe(rtt time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var late float64
+	if rtt > pathLateThreshold {
+		late = 1
+	}
+	if s.quality.samples == 0 {
+		s.quality.rtt = rtt
+	} else {
+		s.quality.rtt = (7*s.quality.rtt + rtt) / 8
+	}
+	s.quality.late = ewma(s.quality.late, late, s.quality.samples)
+	s.sampleLocked()
+}
+
+// report records the estimates measured by the other side of the path
+func (s *pathStats) report(rtt time.Duration, late float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.quality.rtt = rtt
+	s.quality.late = late
+	s.sampleLocked()
+}
+
+func (s *pathStats) sampleLocked() {
+	now := time.Now()
+	bytes := s.bytes.Load()
+	if elapsed := now.Sub(s.lastSample).Seconds(); elapsed > 0 {
+		rate := float64(bytes-s.lastBytes) / elapsed
+		s.quality.traffic = ewma(s.quality.traffic, rate, s.quality.samples)
+	}
+	s.lastBytes = bytes
+	s.lastSample = now
+	s.quality.samples++
+}
+
+// count adds transferred bytes, to be taken into account on the next sample
+func (s *pathStats) count(n int64) {
+	s.bytes.Add(n)
+}
+
+func (s *pathStats) get() pathQuality {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.quality
+}
+
+func ewma(current, sample float64, samples int) float64 {
+	if samples == 0 {
+		return sample
+	}
+	return 0.75*current + 0.25*sample
+}
+
+// score is the effective latency of the path, lower is better. Traffic is left out on purpose,
+// it measures how much the path is used, which would only keep the current path preferred.
+func (q pathQuality) score() time.Duration {
+	return time.Duration(float64(q.rtt) * (1 + pathLatePenalty*q.late))
+}
+
+// score adjusts the path score for the style of the connection. Relay heartbeats
+// only measure our half of the path, so we assume the other half is similar.
+func (s peerStyle) score(q pathQuality) time.Duration {
+	if s == peerRelay {
+		return 2 * q.score()
+	}
+	return q.score()
+}
+
+// comparePaths orders paths by their score, unmeasured paths go last. Equal paths keep the style order.
+func comparePaths(l peerConnKey, lq pathQuality, r peerConnKey, rq pathQuality) int {
+	switch {
+	case lq.samples > 0 && rq.samples == 0:
+		return -1
+	case lq.samples == 0 && rq.samples > 0:
+		return 1
+	case lq.samples > 0 && rq.samples > 0:
+		if ls, rs := l.style.score(lq), r.style.score(rq); ls != rs {
+			if ls < rs {
+				return -1
+			}
+			return 1
+		}
+	}
+	return int(l.style - r.style)
+}
+
+// countingStream counts bytes read and written through the stream into stats
+type countingStream struct {
+	quic.Stream
+	stats *pathStats
+}
+
+func (s countingStream) Read(p []byte) (int, error) {
+	n, err := s.Stream.Read(p)
+	s.stats.count(int64(n))
+	return n, err
+}
+
+func (s countingStream) Write(p []byte) (int, error) {
+	n, err := s.Stream.Write(p)
+	s.stats.count(int64(n))
+	return n, err
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathStats(t *testing.T) {
+	stats := newPathStats()
+	require.Equal(t, 0, stats.get().samples)
+
+	stats.observe(10 * time.Millisecond)
+	q := stats.get()
+	require.Equal(t, 1, q.samples)
+	require.Equal(t, 10*time.Millisecond, q.rtt)
+	require.Zero(t, q.late)
+
+	stats.observe(2 * time.Second)
+	q = stats.get()
+	require.Greater(t, q.rtt, 10*time.Millisecond)
+	require.InDelta(t, 0.25, q.late, 0.001)
+
+	stats.count(1000)
+	stats.report(20*time.Millisecond, 0.5)
+	q = stats.get()
+	require.Equal(t, 20*time.Millisecond, q.rtt)
+	require.InDelta(t, 0.5, q.late, 0.001)
+	require.Positive(t, q.traffic)
+}
+
+func TestComparePaths(t *testing.T) {
+	type path struct {
+		key     peerConnKey
+		quality pathQuality
+	}
+	sorted := func(paths ...path) []peerStyle {
+		slices.SortFunc(paths, func(l, r path) int {
+			return comparePaths(l.key, l.quality, r.key, r.quality)
+		})
+		var styles []peerStyle
+		for _, p := range paths {
+			styles = append(styles, p.key.style)
+		}
+		return styles
+	}
+
+	outgoing := peerConnKey{id: "a", style: peerOutgoing}
+	incoming := peerConnKey{id: "a", style: peerIncoming}
+	relay := peerConnKey{id: "a", style: peerRelay, key: "relay:19191"}
+
+	t.Run("unmeasured", func(t *testing.T) {
+		require.Equal(t, []peerStyle{peerOutgoing, peerIncoming, peerRelay}, sorted(
+			path{relay, pathQuality{}},
+			path{incoming, pathQuality{}},
+			path{outgoing, pathQuality{}},
+		))
+	})
+
+	t.Run("measured first", func(t *testing.T) {
+		require.Equal(t, []peerStyle{peerRelay, peerOutgoing}, sorted(
+			path{outgoing, pathQuality{}},
+			path{relay, pathQuality{samples: 1, rtt: 10 * time.Millisecond}},
+		))
+	})
+
+	t.Run("direct preferred", func(t *testing.T) {
+		require.Equal(t, []peerStyle{peerOutgoing, peerRelay}, sorted(
+			path{relay, pathQuality{samples: 1, rtt: 20 * time.Millisecond}},
+			path{outgoing, pathQuality{samples: 1, rtt: 30 * time.Millisecond}},
+		))
+	})
+
+	t.Run("direct degraded", func(t *testing.T) {
+		require.Equal(t, []peerStyle{peerRelay, peerOutgoing}, sorted(
+			path{relay, pathQuality{samples: 1, rtt: 20 * time.Millisecond}},
+			path{outgoing, pathQuality{samples: 1, rtt: 30 * time.Millisecond, late: 0.5}},
+		))
+	})
+
+	t.Run("direct degraded by late heartbeats", func(t *testing.T) {
+		direct, relayed := newPathStats(), newPathStats()
+		for range 4 {
+			direct.observe(5 * time.Millisecond)
+			relayed.observe(10 * time.Millisecond)
+		}
+		require.Equal(t, []peerStyle{peerOutgoing, peerRelay}, sorted(
+			path{relay, relayed.get()},
+			path{outgoing, direct.get()},
+		))
+
+		// retransmits on the direct path make some heartbeats late, without changing the relay path
+		direct.observe(1500 * time.Millisecond)
+		direct.observe(5 * time.Millisecond)
+		require.Equal(t, []peerStyle{peerRelay, peerOutgoing}, sorted(
+			path{relay, relayed.get()},
+			path{outgoing, direct.get()},
+		))
+	})
+}
@@ -1,28 +1,40 @@
 package client
 
 import (
+	"cmp"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"log/slog"
 	"maps"
+	"net"
 	"net/netip"
+	"slices"
+	"sync"
+	"sync/atomic"
 
 	"github.com/connet-dev/connet/certc"
 	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/netc"
 	"github.com/connet-dev/connet/notify"
 	"github.com/connet-dev/connet/pb"
 	"github.com/connet-dev/connet/pbs"
-	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
 )
 
 type peer struct {
 	self       *notify.V[*pbs.ClientPeer]
 	relays     *notify.V[[]*pbs.Relay]
-	relayConns *notify.C[map[model.HostPort]quic.Connection]
+	relayConns *notify.C[map[model.HostPort]*peerConn]
 	peers      *notify.V[[]*pbs.ServerPeer]
-	peerConns  *notify.C[map[peerConnKey]quic.Connection]
+	peerConns  *notify.C[map[peerConnKey]*peerConn]
+	control    atomic.Pointer[peerControl]
+
+	relayErrs   map[model.HostPort]error // why connecting to a relay last failed
+	relayErrsMu sync.Mutex
+
+	streams inflight // forwarded streams over all conns, see Drain
+	reaped  netc.JoinReaped
 
 	direct     *DirectServer
 	serverCert tls.Certificate
@@ -80,9 +92,11 @@ func newPeer(direct *DirectServer, root *certc.Cert, logger *slog.Logger) (*peer
 	return &peer{
 		self:       notify.New(&pbs.ClientPeer{}),
 		relays:     notify.NewEmpty[[]*pbs.Relay](),
-		relayConns: notify.New(map[model.HostPort]quic.Connection{}).Copying(maps.Clone),
+		relayConns: notify.New(map[model.HostPort]*peerConn{}).Copying(maps.Clone),
 		peers:      notify.NewEmpty[[]*pbs.ServerPeer](),
-		peerConns:  notify.New(map[peerConnKey]quic.Connection{}).Copying(maps.Clone),
+		peerConns:  notify.New(map[peerConnKey]*peerConn{}).Copying(maps.Clone),
+		relayErrs:  map[model.HostPort]error{},
+		streams:    newInflight(),
 
 		direct:     direct,
 		serverCert: serverTLSCert,
@@ -124,6 +138,19 @@ func (p *peer) setPeers(peers []*pbs.ServerPeer) {
 	p.peers.Set(peers)
 }
 
+// mergePeers updates and adds peers, but keeps known peers missing from the list
+func (p *peer) mergePeers(peers []*pbs.ServerPeer) {
+	p.peers.Update(func(current []*pbs.ServerPeer) []*pbs.ServerPeer {
+		merged := slices.Clone(peers)
+		for _, cp := range current {
+			if !slices.ContainsFunc(peers, func(sp *pbs.ServerPeer) bool { return sp.Id == cp.Id }) {
+				merged = append(merged, cp)
+			}
+		}
+		return merged
+	})
+}
+
 func (p *peer) run(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -170,7 +197,7 @@ func (p *peer) runRelays(ctx context.Context) error {
 }
 
 func (p *peer) runShareRelays(ctx context.Context) error {
-	return p.relayConns.Listen(ctx, func(conns map[model.HostPort]quic.Connection) error {
+	return p.relayConns.Listen(ctx, func(conns map[model.HostPort]*peerConn) error {
 		p.logger.Debug("relays conns updated", "len", len(conns))
 		var hps []*pb.HostPort
 		for hp := range conns {
@@ -215,36 +242,54 @@ func (p *peer) runPeers(ctx context.Context) error {
 	})
 }
 
-func (p *peer) addRelayConn(hostport model.HostPort, conn quic.Connection) {
-	p.relayConns.Update(func(conns map[model.HostPort]quic.Connection) {
+func (p *peer) addRelayConn(hostport model.HostPort, conn *peerConn) {
+	p.relayConns.Update(func(conns map[model.HostPort]*peerConn) {
 		conns[hostport] = conn
 	})
 }
 
 func (p *peer) removeRelayConn(hostport model.HostPort) {
-	p.relayConns.Update(func(conns map[model.HostPort]quic.Connection) {
+	p.relayConns.Update(func(conns map[model.HostPort]*peerConn) {
 		delete(conns, hostport)
 	})
 }
 
-func (p *peer) addActiveConn(id string, style peerStyle, key string, conn quic.Connection) {
-	p.logger.Debug("add active connection", "peer", id, "style", style, "addr", conn.RemoteAddr())
-	p.peerConns.Update(func(active map[peerConnKey]quic.Connection) {
+func (p *peer) setRelayErr(hostport model.HostPort, err error) {
+	p.relayErrsMu.Lock()
+	defer p.relayErrsMu.Unlock()
+
+	if err == nil {
+		delete(p.relayErrs, hostport)
+	} else {
+		p.relayErrs[hostport] = err
+	}
+}
+
+func (p *peer) getRelayErr(hostport model.HostPort) error {
+	p.relayErrsMu.Lock()
+	defer p.relayErrsMu.Unlock()
+
+	return p.relayErrs[hostport]
+}
+
+func (p *peer) addActiveConn(id string, style peerStyle, key string, conn *peerConn) {
+	p.logger.Debug("add active connection", "peer", id, "style", style, "addr", conn.conn.RemoteAddr())
+	p.peerConns.Update(func(active map[peerConnKey]*peerConn) {
 		active[peerConnKey{id, style, key}] = conn
 	})
 }
 
 func (p *peer) removeActiveConn(id string, style peerStyle, key string) {
 	p.logger.Debug("remove active connection", "peer", id, "style", style)
-	p.peerConns.Update(func(active map[peerConnKey]quic.Connection) {
+	p.peerConns.Update(func(active map[peerConnKey]*peerConn) {
 		delete(active, peerConnKey{id, style, key})
 	})
 }
 
-func (p *peer) removeActiveConns(id string) map[peerConnKey]quic.Connection {
+func (p *peer) removeActiveConns(id string) map[peerConnKey]*peerConn {
 	p.logger.Debug("remove active peer", "peer", id)
-	removed := map[peerConnKey]quic.Connection{}
-	p.peerConns.Update(func(active map[peerConnKey]quic.Connection) {
+	removed := map[peerConnKey]*peerConn{}
+	p.peerConns.Update(func(active map[peerConnKey]*peerConn) {
 		for k, conn := range active {
 			if k.id == id {
 				removed[k] = conn
@@ -255,10 +300,45 @@ func (p *peer) removeActiveConns(id string) map[peerConnKey]quic.Connection {
 	return removed
 }
 
-func (p *peer) activeConnsListen(ctx context.Context, f func(map[peerConnKey]quic.Connection) error) error {
+// joined logs and counts the conns closed by the join timeouts
+func (p *peer) joined(err error, timeouts netc.JoinTimeouts) {
+	if p.reaped.Record(err) {
+		p.logger.Info("reaped conn", "reason", err, "idle-timeout", timeouts.Idle, "max-lifetime", timeouts.MaxLifetime)
+	}
+}
+
+func (p *peer) activeConnsListen(ctx context.Context, f func(map[peerConnKey]*peerConn) error) error {
 	return p.peerConns.Listen(ctx, f)
 }
 
+// Route is an active connection to a peer, through which streams flow
+type Route struct {
+	Peer  string
+	Style string // outgoing, incoming or relay
+	Addr  netip.AddrPort
+}
+
+func (p *peer) routesListen(ctx context.Context, f func([]Route) error) error {
+	return p.peerConns.Listen(ctx, func(active map[peerConnKey]*peerConn) error {
+		routes := make([]Route, 0, len(active))
+		for k, conn := range active {
+			route := Route{Peer: k.id, Style: k.style.String()}
+			if addr, ok := conn.conn.RemoteAddr().(*net.UDPAddr); ok {
+				route.Addr = addr.AddrPort()
+			}
+			routes = append(routes, route)
+		}
+		slices.SortFunc(routes, func(l, r Route) int {
+			return cmp.Or(
+				cmp.Compare(l.Peer, r.Peer),
+				cmp.Compare(l.Style, r.Style),
+				l.Addr.Compare(r.Addr),
+			)
+		})
+		return f(routes)
+	})
+}
+
 type serverTLSConfig struct {
 	key  certc.Key
 	name string
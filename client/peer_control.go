@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/connet-dev/connet/model"
 	"github.com/connet-dev/connet/pb"
@@ -11,6 +13,9 @@ import (
 	"golang.org/x/sync/errgroup"
 )
 
+// how long after announcing, peers missing from the control server list are kept
+const peersReconnectGrace = 30 * time.Second
+
 type peerControl struct {
 	local *peer
 	fwd   model.Forward
@@ -20,6 +25,9 @@ type peerControl struct {
 }
 
 func (d *peerControl) run(ctx context.Context) error {
+	d.local.control.Store(d)
+	defer d.local.control.CompareAndSwap(d, nil)
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error { return d.runAnnounce(ctx) })
@@ -63,6 +71,32 @@ func (d *peerControl) runAnnounce(ctx context.Context) error {
 		})
 	})
 
+	// after a (re)connect, other peers might not have announced themselves again. Until the grace period passes
+	// peers are only added, keeping the existing ones (and their connections), and then reconciled with the latest list
+	var latest []*pbs.ServerPeer
+	var received, reconciled bool
+	var mu sync.Mutex
+
+	g.Go(func() error {
+		t := time.NewTimer(peersReconnectGrace)
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-t.C:
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		reconciled = true
+		if received {
+			d.local.setPeers(latest)
+		}
+		return nil
+	})
+
 	g.Go(func() error {
 		for {
 			resp, err := pbs.ReadResponse(stream)
@@ -73,9 +107,14 @@ func (d *peerControl) runAnnounce(ctx context.Context) error {
 				return kleverr.Newf("unexpected response")
 			}
 
-			// TODO on server restart peers is reset and client loses active peers
-			// only for them to come back at the next tick, with different ID
-			d.local.setPeers(resp.Announce.Peers)
+			mu.Lock()
+			latest, received = resp.Announce.Peers, true
+			if reconciled {
+				d.local.setPeers(latest)
+			} else {
+				d.local.mergePeers(latest)
+			}
+			mu.Unlock()
 		}
 	})
 
@@ -6,8 +6,10 @@ import (
 	"crypto/x509"
 	"errors"
 	"log/slog"
+	"maps"
 	"net"
 	"net/netip"
+	"slices"
 	"time"
 
 	"github.com/connet-dev/connet/model"
@@ -19,6 +21,7 @@ import (
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
+	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -54,8 +57,11 @@ var errPeeringStop = errors.New("peering stopped")
 func (p *directPeer) run(ctx context.Context) {
 	defer func() {
 		active := p.local.removeActiveConns(p.remoteId)
-		for _, conn := range active {
-			conn.CloseWithError(1, "depeered")
+		for key, conn := range active {
+			if key.style == peerRelay {
+				continue // shared with other peers, its relayPeer closes it
+			}
+			conn.closeAfter(ctx, 1, "depeered")
 		}
 	}()
 
@@ -183,6 +189,12 @@ func (p *directPeerIncoming) run(ctx context.Context) {
 
 func (p *directPeerIncoming) connect(ctx context.Context) (quic.Connection, quic.Stream, error) {
 	ch, cancel := p.parent.local.direct.expect(p.parent.local.serverCert, p.clientCert)
+
+	punchCtx, punchCancel := context.WithCancel(ctx)
+	defer punchCancel()
+	punched := make(chan quic.Connection, 1)
+	go p.punch(punchCtx, punched)
+
 	select {
 	case <-ctx.Done():
 		cancel()
@@ -191,22 +203,81 @@ func (p *directPeerIncoming) connect(ctx context.Context) (quic.Connection, quic
 		cancel()
 		return nil, nil, errClosed
 	case conn := <-ch:
+		punched <- conn
 		stream, err := conn.AcceptStream(ctx)
 		if err != nil {
 			return nil, nil, err
 		}
-		if err := p.heartbeat(stream); err != nil {
+		if err := p.heartbeat(stream, nil); err != nil {
 			return nil, nil, err
 		}
 		return conn, stream, nil
 	}
 }
 
+// punch takes part in the remote's punches while waiting for it to connect, sending a few packets
+// towards its public address so our side of the path is open when the remote dials
+func (p *directPeerIncoming) punch(ctx context.Context, punched <-chan quic.Connection) {
+	ctl := p.parent.local.control.Load()
+	if ctl == nil {
+		return
+	}
+
+	var pch *punch
+	for {
+		var err error
+		pch, err = ctl.punch(ctx, p.parent.remoteId)
+		if err != nil {
+			p.parent.logger.Debug("could not coordinate incoming punch", "err", err)
+			return
+		}
+		if pch.matched {
+			break
+		}
+		// the remote is not dialing at the moment, keep waiting without recording an attempt
+		pch.cancel()
+	}
+
+	if err := pch.wait(ctx); err != nil {
+		pch.report(nil, err)
+		return
+	}
+
+	if pch.remotePublic.IsValid() {
+		addrs := netc.PredictAddrs(nil, pch.remotePublic, punchPredictPorts)
+		p.parent.logger.Debug("punching incoming", "matched", pch.matched, "addrs", len(addrs))
+		for _, addr := range addrs {
+			if _, err := p.parent.local.direct.transport.WriteTo([]byte{0}, net.UDPAddrFromAddrPort(addr)); err != nil {
+				p.parent.logger.Debug("could not send punch packet", "addr", addr, "err", err)
+			}
+		}
+	}
+
+	var rerr error
+	select {
+	case conn := <-punched:
+		rerr = pch.report(conn, nil)
+	case <-time.After(punchAcceptTimeout):
+		rerr = pch.report(nil, kleverr.New("remote did not connect"))
+	case <-ctx.Done():
+		select {
+		case conn := <-punched:
+			rerr = pch.report(conn, nil)
+		default:
+			rerr = pch.report(nil, ctx.Err())
+		}
+	}
+	if rerr != nil {
+		p.parent.logger.Debug("could not report punch", "err", rerr)
+	}
+}
+
 func (p *directPeerIncoming) keepalive(ctx context.Context, conn quic.Connection, stream quic.Stream) error {
-	defer conn.CloseWithError(1, "disconnected")
+	pc := newPeerConn(conn, newPathStats())
+	defer pc.closeAfter(ctx, 1, "disconnected")
 	defer stream.Close()
 
-	p.parent.local.addActiveConn(p.parent.remoteId, peerIncoming, "", conn)
+	p.parent.local.addActiveConn(p.parent.remoteId, peerIncoming, "", pc)
 	defer p.parent.local.removeActiveConn(p.parent.remoteId, peerIncoming, "")
 
 	g, ctx := errgroup.WithContext(ctx)
@@ -222,7 +293,7 @@ func (p *directPeerIncoming) keepalive(ctx context.Context, conn quic.Connection
 
 	g.Go(func() error {
 		for {
-			if err := p.heartbeat(stream); err != nil {
+			if err := p.heartbeat(stream, pc.stats); err != nil {
 				return err
 			}
 		}
@@ -231,7 +302,8 @@ func (p *directPeerIncoming) keepalive(ctx context.Context, conn quic.Connection
 	return g.Wait()
 }
 
-func (p *directPeerIncoming) heartbeat(stream quic.Stream) error {
+// heartbeat answers the remote heartbeat, updating stats with the estimates it carries
+func (p *directPeerIncoming) heartbeat(stream quic.Stream, stats *pathStats) error {
 	req, err := pbc.ReadRequest(stream)
 	switch {
 	case err != nil:
@@ -244,7 +316,10 @@ func (p *directPeerIncoming) heartbeat(stream quic.Stream) error {
 		return respErr
 	}
 
-	return pb.Write(stream, &pbc.Response{Heartbeat: req.Heartbeat})
+	if stats != nil && req.Heartbeat.Rtt != nil {
+		stats.report(req.Heartbeat.Rtt.AsDuration(), req.Heartbeat.Loss)
+	}
+	return pb.Write(stream, &pbc.Response{Heartbeat: &pbc.Heartbeat{Time: req.Heartbeat.Time}})
 }
 
 type directPeerOutgoing struct {
@@ -300,43 +375,116 @@ func (p *directPeerOutgoing) run(ctx context.Context) {
 }
 
 func (p *directPeerOutgoing) connect(ctx context.Context) (quic.Connection, quic.Stream, error) {
+	addrs := slices.Collect(maps.Keys(p.addrs))
+
+	ctl := p.parent.local.control.Load()
+	if ctl == nil {
+		return p.dial(ctx, addrs)
+	}
+
+	pch, err := ctl.punch(ctx, p.parent.remoteId)
+	if err != nil {
+		p.parent.logger.Debug("could not coordinate punch, dialing directly", "err", err)
+		return p.dial(ctx, addrs)
+	}
+
+	if err := pch.wait(ctx); err != nil {
+		pch.report(nil, err)
+		return nil, nil, err
+	}
+
+	addrs = netc.PredictAddrs(addrs, pch.remotePublic, punchPredictPorts)
+	p.parent.logger.Debug("punching direct", "matched", pch.matched, "addrs", len(addrs))
+	conn, stream, err := p.dial(ctx, addrs)
+	if rerr := pch.report(conn, err); rerr != nil {
+		p.parent.logger.Debug("could not report punch", "err", rerr)
+	}
+	return conn, stream, err
+}
+
+type directDialResult struct {
+	conn   quic.Connection
+	stream quic.Stream
+	err    error
+}
+
+// dial tries all addrs at the same time, returning the first connection to complete a heartbeat
+func (p *directPeerOutgoing) dial(ctx context.Context, addrs []netip.AddrPort) (quic.Connection, quic.Stream, error) {
+	if len(addrs) == 0 {
+		return nil, nil, kleverr.New("no direct addresses")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan directDialResult, len(addrs))
+	for _, addr := range addrs {
+		go func() {
+			conn, stream, err := p.dialAddr(ctx, addr)
+			results <- directDialResult{conn, stream, err}
+		}()
+	}
+
+	var found *directDialResult
 	var errs []error
-	for paddr := range p.addrs {
-		addr := net.UDPAddrFromAddrPort(paddr)
-
-		p.parent.logger.Debug("dialing direct", "addr", addr, "server", p.serverConf.name, "cert", p.serverConf.key)
-		conn, err := p.parent.local.direct.transport.Dial(ctx, addr, &tls.Config{
-			Certificates: []tls.Certificate{p.parent.local.clientCert},
-			RootCAs:      p.serverConf.cas,
-			ServerName:   p.serverConf.name,
-			NextProtos:   []string{"connet-direct"},
-		}, &quic.Config{
-			KeepAlivePeriod: 25 * time.Second,
-		})
-		if err != nil {
-			errs = append(errs, err)
-			continue
+	for range addrs {
+		result := <-results
+		switch {
+		case result.err != nil:
+			errs = append(errs, result.err)
+		case found == nil:
+			found = &result
+			cancel()
+		default:
+			result.conn.CloseWithError(0, "duplicate")
 		}
+	}
 
-		stream, err := conn.OpenStreamSync(ctx)
-		if err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		if err := p.heartbeat(ctx, stream); err != nil {
-			errs = append(errs, err)
-			continue
-		}
-		return conn, stream, nil
+	if found == nil {
+		return nil, nil, errors.Join(errs...)
+	}
+	return found.conn, found.stream, nil
+}
+
+func (p *directPeerOutgoing) dialAddr(ctx context.Context, paddr netip.AddrPort) (quic.Connection, quic.Stream, error) {
+	addr := net.UDPAddrFromAddrPort(paddr)
+
+	p.parent.logger.Debug("dialing direct", "addr", addr, "server", p.serverConf.name, "cert", p.serverConf.key)
+	conn, err := p.parent.local.direct.transport.Dial(ctx, addr, &tls.Config{
+		Certificates: []tls.Certificate{p.parent.local.clientCert},
+		RootCAs:      p.serverConf.cas,
+		ServerName:   p.serverConf.name,
+		NextProtos:   []string{"connet-direct"},
+	}, p.parent.local.direct.quicConf.QUIC())
+	if err != nil {
+		return nil, nil, err
 	}
-	return nil, nil, errors.Join(errs...)
+
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		conn.CloseWithError(1, "open stream failed")
+		return nil, nil, err
+	}
+	if err := p.heartbeat(ctx, stream, newPathStats()); err != nil {
+		conn.CloseWithError(1, "heartbeat failed")
+		return nil, nil, err
+	}
+	return conn, stream, nil
 }
 
 func (p *directPeerOutgoing) keepalive(ctx context.Context, conn quic.Connection, stream quic.Stream) error {
-	defer conn.CloseWithError(1, "disconnected")
+	pc := newPeerConn(conn, newPathStats())
+	defer pc.closeAfter(ctx, 1, "disconnected")
 	defer stream.Close()
 
-	p.parent.local.addActiveConn(p.parent.remoteId, peerOutgoing, "", conn)
+	// the first heartbeat measures the path, the second shares the measurement with the other side
+	for range 2 {
+		if err := p.heartbeat(ctx, stream, pc.stats); err != nil {
+			return err
+		}
+	}
+
+	p.parent.local.addActiveConn(p.parent.remoteId, peerOutgoing, "", pc)
 	defer p.parent.local.removeActiveConn(p.parent.remoteId, peerOutgoing, "")
 
 	for {
@@ -347,15 +495,19 @@ func (p *directPeerOutgoing) keepalive(ctx context.Context, conn quic.Connection
 			return errClosed
 		case <-time.After(10 * time.Second):
 		}
-		if err := p.heartbeat(ctx, stream); err != nil {
+		if err := p.heartbeat(ctx, stream, pc.stats); err != nil {
 			return err
 		}
 	}
 }
 
-func (p *directPeerOutgoing) heartbeat(ctx context.Context, stream quic.Stream) error {
+func (p *directPeerOutgoing) heartbeat(ctx context.Context, stream quic.Stream, stats *pathStats) error {
 	// TODO setDeadline as additional assurance we are not blocked
 	req := &pbc.Heartbeat{Time: timestamppb.Now()}
+	if q := stats.get(); q.samples > 0 {
+		req.Rtt = durationpb.New(q.rtt)
+		req.Loss = q.late
+	}
 	if err := pb.Write(stream, &pbc.Request{Heartbeat: req}); err != nil {
 		return err
 	}
@@ -363,7 +515,9 @@ func (p *directPeerOutgoing) heartbeat(ctx context.Context, stream quic.Stream)
 		return err
 	} else {
 		dur := time.Since(resp.Heartbeat.Time.AsTime())
-		p.parent.logger.Debug("direct heartbeat", "dur", dur)
+		stats.observe(dur)
+		q := stats.get()
+		p.parent.logger.Debug("direct heartbeat", "dur", dur, "rtt", q.rtt, "late", q.late, "traffic", q.traffic)
 		return nil
 	}
 }
@@ -389,7 +543,7 @@ func newDirectPeerRelays(ctx context.Context, parent *directPeer, remotes map[mo
 
 func (p *directPeerRelays) run(ctx context.Context) {
 	var (
-		relays map[model.HostPort]quic.Connection
+		relays map[model.HostPort]*peerConn
 		remote map[model.HostPort]struct{}
 	)
 
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"net/netip"
+	"time"
+
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/pbs"
+	"github.com/klev-dev/kleverr"
+	"github.com/quic-go/quic-go"
+)
+
+// how many ports after the remote public port to try, in case of sequential allocation NATs
+const punchPredictPorts = 4
+
+// how long the accepting side of a punch waits for the remote to connect
+const punchAcceptTimeout = 5 * time.Second
+
+type punch struct {
+	stream       quic.Stream
+	stop         func() bool
+	rtt          time.Duration
+	matched      bool
+	delay        time.Duration
+	remotePublic netip.AddrPort
+}
+
+// punch asks the control server to coordinate a simultaneous open with peerID. It returns once both
+// peers have requested it (or the server gave up waiting for the other side).
+func (d *peerControl) punch(ctx context.Context, peerID string) (*punch, error) {
+	stream, err := d.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, kleverr.Ret(err)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		stream.CancelRead(0)
+	})
+
+	p, err := d.punchRequest(stream, peerID)
+	if err != nil {
+		stop()
+		stream.Close()
+		return nil, err
+	}
+	p.stop = stop
+	return p, nil
+}
+
+func (d *peerControl) punchRequest(stream quic.Stream, peerID string) (*punch, error) {
+	start := time.Now()
+	if err := pb.Write(stream, &pbs.Request{
+		Punch: &pbs.Request_Punch{
+			Forward: d.fwd.PB(),
+			Role:    d.role.PB(),
+			PeerId:  peerID,
+		},
+	}); err != nil {
+		return nil, err
+	}
+
+	if resp, err := pbs.ReadResponse(stream); err != nil {
+		return nil, err
+	} else if resp.Punch == nil {
+		return nil, kleverr.Newf("unexpected response")
+	}
+	rtt := time.Since(start)
+
+	resp, err := pbs.ReadResponse(stream)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Punch == nil || !resp.Punch.Ready {
+		return nil, kleverr.Newf("unexpected response")
+	}
+
+	p := &punch{
+		stream:  stream,
+		rtt:     rtt,
+		matched: resp.Punch.Matched,
+		delay:   time.Duration(resp.Punch.DelayMs) * time.Millisecond,
+	}
+	if resp.Punch.RemotePublic != nil {
+		p.remotePublic = resp.Punch.RemotePublic.AsNetip()
+	}
+	return p, nil
+}
+
+// wait blocks until it is time to start sending, taking into account the time
+// it took for the server's signal to reach us
+func (p *punch) wait(ctx context.Context) error {
+	d := p.delay - p.rtt/2
+	if d <= 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// cancel closes the stream without reporting an outcome
+func (p *punch) cancel() {
+	p.stop()
+	p.stream.CancelWrite(0)
+	p.stream.CancelRead(0)
+}
+
+// report sends the outcome of the punch back to the control server and closes the stream
+func (p *punch) report(conn quic.Connection, err error) error {
+	defer p.stop()
+	defer p.stream.Close()
+
+	result := &pbs.Request_PunchResult{}
+	if err != nil {
+		result.Error = err.Error()
+	} else {
+		result.Success = true
+		if addr, aerr := pb.AddrPortFromNet(conn.RemoteAddr()); aerr == nil {
+			result.Addr = addr
+		}
+	}
+	return pb.Write(p.stream, &pbs.Request{PunchResult: result})
+}
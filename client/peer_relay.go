@@ -60,6 +60,7 @@ func (r *relayPeer) runConn(ctx context.Context) error {
 		conn, err := r.connect(ctx)
 		if err != nil {
 			r.logger.Debug("could not connect relay", "relay", r.serverHostport, "err", err)
+			r.local.setRelayErr(r.serverHostport, err)
 			if errors.Is(err, context.Canceled) {
 				return err
 			}
@@ -76,6 +77,7 @@ func (r *relayPeer) runConn(ctx context.Context) error {
 
 		if err := r.keepalive(ctx, conn); err != nil {
 			r.logger.Debug("disconnected relay", "relay", r.serverHostport, "err", err)
+			r.local.setRelayErr(r.serverHostport, err)
 		}
 	}
 }
@@ -93,9 +95,7 @@ func (r *relayPeer) connect(ctx context.Context) (quic.Connection, error) {
 		RootCAs:      cfg.cas,
 		ServerName:   cfg.name,
 		NextProtos:   []string{"connet-relay"},
-	}, &quic.Config{
-		KeepAlivePeriod: 25 * time.Second,
-	})
+	}, r.local.direct.quicConf.QUIC())
 }
 
 func (r *relayPeer) keepalive(ctx context.Context, conn quic.Connection) error {
@@ -103,11 +103,13 @@ func (r *relayPeer) keepalive(ctx context.Context, conn quic.Connection) error {
 	if err != nil {
 		return err
 	}
-	if err := r.heartbeat(ctx, stream); err != nil {
+	stats := newPathStats()
+	if err := r.heartbeat(ctx, stream, stats); err != nil {
 		return err
 	}
 
-	r.local.addRelayConn(r.serverHostport, conn)
+	r.local.setRelayErr(r.serverHostport, nil)
+	r.local.addRelayConn(r.serverHostport, newPeerConn(conn, stats))
 	defer r.local.removeRelayConn(r.serverHostport)
 
 	for {
@@ -116,13 +118,13 @@ func (r *relayPeer) keepalive(ctx context.Context, conn quic.Connection) error {
 			return ctx.Err()
 		case <-time.After(10 * time.Second):
 		}
-		if err := r.heartbeat(ctx, stream); err != nil {
+		if err := r.heartbeat(ctx, stream, stats); err != nil {
 			return err
 		}
 	}
 }
 
-func (r *relayPeer) heartbeat(ctx context.Context, stream quic.Stream) error {
+func (r *relayPeer) heartbeat(ctx context.Context, stream quic.Stream, stats *pathStats) error {
 	// TODO setDeadline as additional assurance we are not blocked
 	req := &pbc.Heartbeat{Time: timestamppb.Now()}
 	if err := pb.Write(stream, &pbc.Request{Heartbeat: req}); err != nil {
@@ -132,7 +134,9 @@ func (r *relayPeer) heartbeat(ctx context.Context, stream quic.Stream) error {
 		return err
 	} else {
 		dur := time.Since(resp.Heartbeat.Time.AsTime())
-		r.logger.Debug("relay heartbeat", "dur", dur)
+		stats.observe(dur)
+		q := stats.get()
+		r.logger.Debug("relay heartbeat", "dur", dur, "rtt", q.rtt, "late", q.late, "traffic", q.traffic)
 		return nil
 	}
 }
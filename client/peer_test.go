@@ -0,0 +1,36 @@
+package client
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/connet-dev/connet/pbs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergePeers(t *testing.T) {
+	root, err := certc.NewRoot()
+	require.NoError(t, err)
+	p, err := newPeer(nil, root, slog.Default())
+	require.NoError(t, err)
+
+	ids := func() []string {
+		peers, err := p.peers.Peek()
+		require.NoError(t, err)
+		var ids []string
+		for _, sp := range peers {
+			ids = append(ids, sp.Id)
+		}
+		return ids
+	}
+
+	p.setPeers([]*pbs.ServerPeer{{Id: "a"}, {Id: "b"}})
+
+	// a reconnect only adds peers, until reconciled
+	p.mergePeers([]*pbs.ServerPeer{{Id: "b"}, {Id: "c"}})
+	require.ElementsMatch(t, []string{"a", "b", "c"}, ids())
+
+	p.setPeers([]*pbs.ServerPeer{{Id: "c"}})
+	require.Equal(t, []string{"c"}, ids())
+}
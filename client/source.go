@@ -1,12 +1,14 @@
 package client
 
 import (
+	"cmp"
 	"context"
+	"errors"
 	"log/slog"
-	"maps"
 	"net"
 	"net/netip"
 	"slices"
+	"sync"
 	"sync/atomic"
 
 	"github.com/connet-dev/connet/certc"
@@ -20,21 +22,25 @@ import (
 )
 
 type Source struct {
-	fwd    model.Forward
-	addr   string
-	opt    model.RouteOption
-	logger *slog.Logger
+	fwd      model.Forward
+	addr     string
+	opt      model.RouteOption
+	timeouts netc.JoinTimeouts
+	logger   *slog.Logger
 
 	peer  *peer
 	conns atomic.Pointer[[]sourceConn]
+
+	draining  chan struct{}
+	drainOnce sync.Once
 }
 
 type sourceConn struct {
 	peer peerConnKey
-	conn quic.Connection
+	conn *peerConn
 }
 
-func NewSource(fwd model.Forward, addr string, opt model.RouteOption, direct *DirectServer, root *certc.Cert, logger *slog.Logger) (*Source, error) {
+func NewSource(fwd model.Forward, addr string, opt model.RouteOption, timeouts netc.JoinTimeouts, direct *DirectServer, root *certc.Cert, logger *slog.Logger) (*Source, error) {
 	logger = logger.With("source", fwd)
 	p, err := newPeer(direct, root, logger)
 	if err != nil {
@@ -45,12 +51,14 @@ func NewSource(fwd model.Forward, addr string, opt model.RouteOption, direct *Di
 	}
 
 	return &Source{
-		fwd:    fwd,
-		addr:   addr,
-		opt:    opt,
-		logger: logger,
+		fwd:      fwd,
+		addr:     addr,
+		opt:      opt,
+		timeouts: timeouts,
+		logger:   logger,
 
-		peer: p,
+		peer:     p,
+		draining: make(chan struct{}),
 	}, nil
 }
 
@@ -62,6 +70,11 @@ func (s *Source) SetDirectAddrs(addrs []netip.AddrPort) {
 	s.peer.setDirectAddrs(addrs)
 }
 
+// RoutesListen calls f with the active routes to peers, each time they change
+func (s *Source) RoutesListen(ctx context.Context, f func([]Route) error) error {
+	return s.peer.routesListen(ctx, f)
+}
+
 func (s *Source) Run(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 
@@ -72,38 +85,139 @@ func (s *Source) Run(ctx context.Context) error {
 	return g.Wait()
 }
 
+// RunPeer runs the source without listening for connections at its address, e.g. to only Probe its routes
+func (s *Source) RunPeer(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error { return s.peer.run(ctx) })
+	g.Go(func() error { return s.runActive(ctx) })
+
+	return g.Wait()
+}
+
 func (s *Source) runActive(ctx context.Context) error {
-	return s.peer.activeConnsListen(ctx, func(active map[peerConnKey]quic.Connection) error {
+	return s.peer.activeConnsListen(ctx, func(active map[peerConnKey]*peerConn) error {
 		s.logger.Debug("active conns", "len", len(active))
-		activePeers := slices.SortedFunc(maps.Keys(active), func(l, r peerConnKey) int {
-			return int(l.style - r.style)
-		})
-
-		var conns = make([]sourceConn, len(activePeers))
-		for i, peer := range activePeers {
-			conns[i] = sourceConn{peer, active[peer]}
+		var conns = make([]sourceConn, 0, len(active))
+		for peer, conn := range active {
+			conns = append(conns, sourceConn{peer, conn})
 		}
 		s.conns.Store(&conns)
 		return nil
 	})
 }
 
-func (s *Source) findActive(ctx context.Context) (quic.Stream, error) {
+// connect sends a connect request through the active conns, best measured path first, until
+// one of them succeeds. A failing route (for example a relay going away, or not knowing the destination anymore)
+// falls back to the next one. A destination peer that cannot dial its address is not asked again through its other
+// conns, but other destination peers still are. When no other route was tried, its dial error is returned as is.
+func (s *Source) connect(ctx context.Context) (quic.Stream, *peerConn, error) {
 	conns := s.conns.Load()
 	if conns == nil || len(*conns) == 0 {
-		return nil, kleverr.New("no active conns")
+		return nil, nil, kleverr.New("no active conns")
 	}
 
-	for _, sc := range *conns {
-		if stream, err := sc.conn.OpenStreamSync(ctx); err != nil {
-			s.logger.Debug("could not open active conn stream", "peer", sc.peer.id, "style", sc.peer.style, "err", err)
-		} else {
-			s.logger.Debug("found active conn", "peer", sc.peer.id, "style", sc.peer.style)
-			return stream, nil
+	type rankedConn struct {
+		sourceConn
+		quality pathQuality
+	}
+	ranked := make([]rankedConn, len(*conns))
+	for i, sc := range *conns {
+		ranked[i] = rankedConn{sc, sc.conn.stats.get()}
+	}
+	slices.SortFunc(ranked, func(l, r rankedConn) int {
+		return comparePaths(l.peer, l.quality, r.peer, r.quality)
+	})
+
+	var errs []error
+	var dialErr error
+	dialFailed := map[string]struct{}{}
+	for _, sc := range ranked {
+		if _, ok := dialFailed[sc.peer.id]; ok {
+			continue
+		}
+		stream, err := s.connectConn(ctx, sc.conn)
+		if err != nil {
+			s.logger.Debug("could not connect via active conn", "peer", sc.peer.id, "style", sc.peer.style, "err", err)
+			if ctx.Err() != nil {
+				return nil, nil, ctx.Err()
+			}
+			if perr := pb.GetError(err); perr != nil && perr.Code == pb.Error_DestinationDialFailed {
+				dialFailed[sc.peer.id] = struct{}{}
+				if dialErr == nil {
+					dialErr = err
+				}
+			}
+			errs = append(errs, err)
+			continue
 		}
+		s.logger.Debug("connected via active conn", "peer", sc.peer.id, "style", sc.peer.style, "rtt", sc.quality.rtt, "late", sc.quality.late)
+		return stream, sc.conn, nil
+	}
+
+	if dialErr != nil && len(errs) == len(dialFailed) {
+		// every destination peer that was asked could not dial
+		return nil, nil, dialErr
+	}
+	return nil, nil, kleverr.Newf("could not connect via %d conns: %w", len(ranked), errors.Join(errs...))
+}
+
+func (s *Source) connectConn(ctx context.Context, conn *peerConn) (quic.Stream, error) {
+	stream, err := conn.conn.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, kleverr.Newf("could not open stream: %w", err)
+	}
+
+	if err := pb.Write(stream, &pbc.Request{
+		Connect: &pbc.Request_Connect{},
+	}); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, kleverr.Newf("could not write request: %w", err)
+	}
+
+	if _, err := pbc.ReadResponse(stream); err != nil {
+		stream.CancelRead(0)
+		stream.Close()
+		return nil, kleverr.Newf("could not read response: %w", err)
 	}
 
-	return nil, kleverr.New("could not open conn stream")
+	return countingStream{stream, conn.stats}, nil
+}
+
+// Dial opens a stream to a destination through the best active route, like for connections accepted at the source address
+func (s *Source) Dial(ctx context.Context) (quic.Stream, error) {
+	stream, _, err := s.connect(ctx)
+	return stream, err
+}
+
+// ProbeResult is the outcome of a connect request through one of the active routes of a source
+type ProbeResult struct {
+	Peer  string
+	Style string
+	Err   error // the pb.Error of the destination, when it refused the request (e.g. it cannot dial its address)
+}
+
+// Probe sends a connect request through each active route, and closes the stream as soon as the destination responds
+func (s *Source) Probe(ctx context.Context) []ProbeResult {
+	conns := s.conns.Load()
+	if conns == nil {
+		return nil
+	}
+
+	var results []ProbeResult
+	for _, sc := range *conns {
+		stream, err := s.connectConn(ctx, sc.conn)
+		if err == nil {
+			stream.CancelRead(0)
+			stream.Close()
+		}
+		results = append(results, ProbeResult{Peer: sc.peer.id, Style: sc.peer.style.String(), Err: err})
+	}
+	slices.SortFunc(results, func(l, r ProbeResult) int {
+		return cmp.Or(cmp.Compare(l.Peer, r.Peer), cmp.Compare(l.Style, r.Style))
+	})
+	return results
 }
 
 func (s *Source) runServer(ctx context.Context) error {
@@ -115,7 +229,10 @@ func (s *Source) runServer(ctx context.Context) error {
 	defer l.Close()
 
 	go func() {
-		<-ctx.Done()
+		select {
+		case <-ctx.Done():
+		case <-s.draining:
+		}
 		l.Close()
 	}()
 
@@ -123,7 +240,13 @@ func (s *Source) runServer(ctx context.Context) error {
 	for {
 		conn, err := l.Accept()
 		if err != nil {
-			return kleverr.Ret(err)
+			select {
+			case <-s.draining:
+				s.logger.Info("stopped listening for conns, draining")
+				return nil
+			default:
+				return kleverr.Ret(err)
+			}
 		}
 
 		go s.runConn(ctx, conn)
@@ -132,6 +255,7 @@ func (s *Source) runServer(ctx context.Context) error {
 
 func (s *Source) runConn(ctx context.Context, conn net.Conn) {
 	defer conn.Close()
+	defer s.peer.streams.add()()
 	s.logger.Debug("received conn", "remote", conn.RemoteAddr())
 
 	if err := s.runConnErr(ctx, conn); err != nil {
@@ -140,29 +264,27 @@ func (s *Source) runConn(ctx context.Context, conn net.Conn) {
 }
 
 func (s *Source) runConnErr(ctx context.Context, conn net.Conn) error {
-	stream, err := s.findActive(ctx)
+	stream, pc, err := s.connect(ctx)
 	if err != nil {
 		return kleverr.Newf("could not find route: %w", err)
 	}
 	defer stream.Close()
-
-	if err := pb.Write(stream, &pbc.Request{
-		Connect: &pbc.Request_Connect{},
-	}); err != nil {
-		return kleverr.Newf("could not write request: %w", err)
-	}
-
-	if _, err := pbc.ReadResponse(stream); err != nil {
-		return kleverr.Newf("could not read response: %w", err)
-	}
+	defer pc.streams.add()()
 
 	s.logger.Debug("joining to server")
-	err = netc.Join(ctx, conn, stream)
+	err = netc.Join(ctx, conn, stream, s.timeouts)
 	s.logger.Debug("disconnected to server", "err", err)
+	s.peer.joined(err, s.timeouts)
 
 	return nil
 }
 
+// Drain stops accepting conns at the source address, and waits for the ones in flight to finish or for ctx to be done
+func (s *Source) Drain(ctx context.Context) error {
+	s.drainOnce.Do(func() { close(s.draining) })
+	return s.peer.streams.wait(ctx)
+}
+
 func (s *Source) RunControl(ctx context.Context, conn quic.Connection) error {
 	return (&peerControl{
 		local: s.peer,
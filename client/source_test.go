@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/pbc"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSourceConnectRefused(t *testing.T) {
+	cert, cas, err := certc.SelfSigned("localhost")
+	require.NoError(t, err)
+
+	// a destination answering each connect request with respErr, or accepting it when nil
+	destination := func(t *testing.T, requests *atomic.Int32, respErr *pb.Error, stats *pathStats) *peerConn {
+		l, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{"connet-test"},
+		}, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { l.Close() })
+
+		go func() {
+			conn, err := l.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			for {
+				stream, err := conn.AcceptStream(context.Background())
+				if err != nil {
+					return
+				}
+				if _, err := pbc.ReadRequest(stream); err != nil {
+					return
+				}
+				requests.Add(1)
+				pb.Write(stream, &pbc.Response{Error: respErr})
+				stream.Close()
+			}
+		}()
+
+		conn, err := quic.DialAddr(context.Background(), l.Addr().String(), &tls.Config{
+			RootCAs:    cas,
+			ServerName: "localhost",
+			NextProtos: []string{"connet-test"},
+		}, nil)
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.CloseWithError(0, "done") })
+		return newPeerConn(conn, stats)
+	}
+
+	t.Run("dial failed", func(t *testing.T) {
+		refused := pb.NewError(pb.Error_DestinationDialFailed, "connection refused")
+
+		var directRequests, relayRequests atomic.Int32
+		s := &Source{logger: slog.Default()}
+		s.conns.Store(&[]sourceConn{
+			{peerConnKey{id: "peer", style: peerOutgoing}, destination(t, &directRequests, refused, newPathStats())},
+			{peerConnKey{id: "peer", style: peerRelay}, destination(t, &relayRequests, refused, newPathStats())},
+		})
+
+		_, _, err := s.connect(context.Background())
+		require.Equal(t, pb.Error_DestinationDialFailed, pb.GetError(err).Code)
+		// the destination is not asked again over the other route
+		require.Equal(t, int32(1), directRequests.Load()+relayRequests.Load())
+	})
+
+	t.Run("one of two destinations cannot dial", func(t *testing.T) {
+		refused := pb.NewError(pb.Error_DestinationDialFailed, "connection refused")
+
+		// the refusing peer is measured, so it is tried first
+		refusingStats := newPathStats()
+		refusingStats.observe(time.Millisecond)
+
+		var refusingDirect, refusingRelay, okRequests atomic.Int32
+		ok := destination(t, &okRequests, nil, newPathStats())
+		s := &Source{logger: slog.Default()}
+		s.conns.Store(&[]sourceConn{
+			{peerConnKey{id: "peer-1", style: peerOutgoing}, destination(t, &refusingDirect, refused, refusingStats)},
+			{peerConnKey{id: "peer-1", style: peerRelay}, destination(t, &refusingRelay, refused, newPathStats())},
+			{peerConnKey{id: "peer-2", style: peerOutgoing}, ok},
+		})
+
+		stream, pc, err := s.connect(context.Background())
+		require.NoError(t, err)
+		stream.Close()
+		// the source moves on to the other destination peer, without asking the refusing one again
+		require.Equal(t, ok, pc)
+		require.Equal(t, int32(1), refusingDirect.Load()+refusingRelay.Load())
+		require.Equal(t, int32(1), okRequests.Load())
+	})
+
+	t.Run("relay lost destination", func(t *testing.T) {
+		notFound := pb.NewError(pb.Error_DestinationNotFound, "could not dial destinations: 0")
+
+		// the relay route is measured, so it is tried first
+		relayStats := newPathStats()
+		relayStats.observe(time.Millisecond)
+
+		var directRequests, relayRequests atomic.Int32
+		direct := destination(t, &directRequests, nil, newPathStats())
+		s := &Source{logger: slog.Default()}
+		s.conns.Store(&[]sourceConn{
+			{peerConnKey{id: "peer", style: peerOutgoing}, direct},
+			{peerConnKey{id: "peer", style: peerRelay}, destination(t, &relayRequests, notFound, relayStats)},
+		})
+
+		stream, pc, err := s.connect(context.Background())
+		require.NoError(t, err)
+		stream.Close()
+		// the source falls back to the direct route
+		require.Equal(t, direct, pc)
+		require.Equal(t, int32(1), relayRequests.Load())
+		require.Equal(t, int32(1), directRequests.Load())
+	})
+}
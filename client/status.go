@@ -0,0 +1,93 @@
+package client
+
+import (
+	"cmp"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/connet-dev/connet/model"
+)
+
+// Status is a snapshot of the peers, relays, routes and conns of a destination or source
+type Status struct {
+	Peers  []string      `json:"peers"` // ids of the peers announced by control
+	Relays []RelayStatus `json:"relays"`
+	Routes []RouteStatus `json:"routes"`
+	Conns  ConnsStatus   `json:"conns"`
+}
+
+// RelayStatus is a relay offered by control, and whether there is a connection to it
+type RelayStatus struct {
+	Hostport  string `json:"hostport"`
+	Connected bool   `json:"connected"`
+	Error     string `json:"error,omitempty"` // why connecting to the relay last failed, while not connected
+}
+
+// RouteStatus is an active route to a peer, with the estimates of its path quality
+type RouteStatus struct {
+	Peer    string         `json:"peer"`
+	Style   string         `json:"style"`
+	Addr    netip.AddrPort `json:"addr"`
+	RTT     time.Duration  `json:"rtt"`
+	Late    float64        `json:"late"`    // ratio of heartbeats slower than a second
+	Traffic float64        `json:"traffic"` // bytes per second forwarded through the route
+}
+
+// ConnsStatus counts the forwarded conns in flight, and the ones closed by the idle and max lifetime timeouts
+type ConnsStatus struct {
+	Active         int    `json:"active"`
+	ReapedIdle     uint64 `json:"reaped_idle"`
+	ReapedLifetime uint64 `json:"reaped_lifetime"`
+}
+
+func (p *peer) status() Status {
+	s := Status{Peers: []string{}, Relays: []RelayStatus{}, Routes: []RouteStatus{}}
+
+	peers, _ := p.peers.Peek()
+	for _, sp := range peers {
+		s.Peers = append(s.Peers, sp.Id)
+	}
+	slices.Sort(s.Peers)
+
+	relayConns, _ := p.relayConns.Peek()
+	relays, _ := p.relays.Peek()
+	for _, r := range relays {
+		hp := model.HostPortFromPB(r.Address)
+		_, connected := relayConns[hp]
+		rs := RelayStatus{Hostport: hp.String(), Connected: connected}
+		if err := p.getRelayErr(hp); err != nil && !connected {
+			rs.Error = err.Error()
+		}
+		s.Relays = append(s.Relays, rs)
+	}
+	slices.SortFunc(s.Relays, func(l, r RelayStatus) int { return cmp.Compare(l.Hostport, r.Hostport) })
+
+	active, _ := p.peerConns.Peek()
+	for k, conn := range active {
+		q := conn.stats.get()
+		route := RouteStatus{Peer: k.id, Style: k.style.String(), RTT: q.rtt, Late: q.late, Traffic: q.traffic}
+		if addr, ok := conn.conn.RemoteAddr().(*net.UDPAddr); ok {
+			route.Addr = addr.AddrPort()
+		}
+		s.Routes = append(s.Routes, route)
+	}
+	slices.SortFunc(s.Routes, func(l, r RouteStatus) int {
+		return cmp.Or(cmp.Compare(l.Peer, r.Peer), cmp.Compare(l.Style, r.Style), l.Addr.Compare(r.Addr))
+	})
+
+	s.Conns.Active, _ = p.streams.count.Peek()
+	s.Conns.ReapedIdle = p.reaped.Idle()
+	s.Conns.ReapedLifetime = p.reaped.Lifetime()
+
+	return s
+}
+
+func (d *Destination) Status() Status {
+	return d.peer.status()
+}
+
+func (s *Source) Status() Status {
+	return s.peer.status()
+}
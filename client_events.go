@@ -0,0 +1,92 @@
+package connet
+
+import (
+	"context"
+	"errors"
+	"slices"
+
+	"github.com/connet-dev/connet/client"
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/pb"
+	"github.com/klev-dev/kleverr"
+)
+
+// ErrAuthenticationFailed is returned by Client.Run when the control server rejects the client while connecting,
+// in which case reconnecting would not help (e.g. the token is unknown, expired or was revoked)
+var ErrAuthenticationFailed = errors.New("authentication failed")
+
+type ClientEventType string
+
+const (
+	// ClientAuthenticated the client connected and authenticated to the control server
+	ClientAuthenticated ClientEventType = "authenticated"
+	// ClientDisconnected the client lost its control server connection, it will reconnect unless the error is terminal
+	ClientDisconnected ClientEventType = "disconnected"
+	// ClientPeerAdded a peer of a forward has its first active route
+	ClientPeerAdded ClientEventType = "peer-added"
+	// ClientPeerRemoved a peer of a forward has no active routes anymore
+	ClientPeerRemoved ClientEventType = "peer-removed"
+	// ClientRouteChanged the active routes to a peer of a forward changed
+	ClientRouteChanged ClientEventType = "route-changed"
+	// ClientTerminated the client stopped running, because of Err
+	ClientTerminated ClientEventType = "terminated"
+)
+
+// ClientEvent reports a change in the client lifecycle. Forward, Role, Peer and Routes are set for peer and route
+// events, Err for disconnected and terminated events.
+type ClientEvent struct {
+	Type ClientEventType
+
+	Forward model.Forward
+	Role    model.Role
+	Peer    string
+	Routes  []client.Route
+
+	Err error
+}
+
+func (c *Client) emit(ev ClientEvent) {
+	if c.events != nil {
+		c.events(ev)
+	}
+}
+
+// runRoutes turns route changes of a forward into peer and route events
+func (c *Client) runRoutes(ctx context.Context, fwd model.Forward, role model.Role,
+	listen func(ctx context.Context, f func([]client.Route) error) error) error {
+
+	last := map[string][]client.Route{}
+	return listen(ctx, func(routes []client.Route) error {
+		current := map[string][]client.Route{}
+		for _, r := range routes {
+			current[r.Peer] = append(current[r.Peer], r)
+		}
+
+		for peer, peerRoutes := range current {
+			switch prev, ok := last[peer]; {
+			case !ok:
+				c.emit(ClientEvent{Type: ClientPeerAdded, Forward: fwd, Role: role, Peer: peer, Routes: peerRoutes})
+			case !slices.Equal(prev, peerRoutes):
+				c.emit(ClientEvent{Type: ClientRouteChanged, Forward: fwd, Role: role, Peer: peer, Routes: peerRoutes})
+			}
+		}
+		for peer := range last {
+			if _, ok := current[peer]; !ok {
+				c.emit(ClientEvent{Type: ClientPeerRemoved, Forward: fwd, Role: role, Peer: peer})
+			}
+		}
+
+		last = current
+		return nil
+	})
+}
+
+// terminalError wraps connect errors after which the client should stop instead of reconnecting, nil otherwise.
+// Only the server rejecting the token while connecting is. Sessions closed with AuthenticationFailed
+// (e.g. the token was revoked while connected) are retried, since the next connect re-checks the current token.
+func terminalError(err error) error {
+	if perr := pb.GetError(err); perr != nil && perr.Code == pb.Error_AuthenticationFailed {
+		return kleverr.Newf("%w: %w", ErrAuthenticationFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package connet
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/connet-dev/connet/client"
+	"github.com/connet-dev/connet/statusc"
+)
+
+type ClientControlState string
+
+const (
+	// ClientControlConnecting the client has not connected to the control server yet
+	ClientControlConnecting ClientControlState = "connecting"
+	// ClientControlConnected the client is connected and authenticated to the control server
+	ClientControlConnected ClientControlState = "connected"
+	// ClientControlDisconnected the client lost its control server connection, and is reconnecting
+	ClientControlDisconnected ClientControlState = "disconnected"
+)
+
+// ClientStatus is a snapshot of a running client, see Client.Status
+type ClientStatus struct {
+	Control      ClientControlStatus      `json:"control"`
+	DirectAddrs  []netip.AddrPort         `json:"direct_addrs"`
+	Destinations map[string]client.Status `json:"destinations"`
+	Sources      map[string]client.Status `json:"sources"`
+}
+
+type ClientControlStatus struct {
+	State ClientControlState `json:"state"`
+	Addr  string             `json:"addr,omitempty"` // of the control server, while connected
+	Since time.Time          `json:"since"`
+	Error string             `json:"error,omitempty"` // why the client disconnected, or its last reconnect failed
+}
+
+func (c *Client) setControlStatus(state ClientControlState, addr net.Addr, err error) {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	status := ClientControlStatus{State: state, Since: time.Now()}
+	if state == c.controlStatus.State {
+		status.Since = c.controlStatus.Since
+	}
+	if addr != nil {
+		status.Addr = addr.String()
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+	c.controlStatus = status
+}
+
+// Status reports the control connection, direct addresses, and the peers, relays and routes of each forward
+func (c *Client) Status() ClientStatus {
+	c.statusMu.Lock()
+	defer c.statusMu.Unlock()
+
+	c.directAddrsMu.Lock()
+	directAddrs := c.directAddrs.all()
+	c.directAddrsMu.Unlock()
+
+	s := ClientStatus{
+		Control:      c.controlStatus,
+		DirectAddrs:  directAddrs,
+		Destinations: map[string]client.Status{},
+		Sources:      map[string]client.Status{},
+	}
+	for fwd, dst := range c.dsts {
+		s.Destinations[fwd.String()] = dst.Status()
+	}
+	for fwd, src := range c.srcs {
+		s.Sources[fwd.String()] = src.Status()
+	}
+	return s
+}
+
+func (c *Client) runStatus(ctx context.Context) error {
+	return statusc.Run(ctx, c.statusAddr, func() (ClientStatus, error) { return c.Status(), nil }, c.logger)
+}
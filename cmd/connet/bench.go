@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/connet-dev/connet"
+	"github.com/connet-dev/connet/model"
+	"github.com/klev-dev/kleverr"
+	"github.com/spf13/cobra"
+)
+
+func benchCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bench",
+		Short: "measure latency and throughput of direct and relay routes through a control server",
+	}
+
+	filename := cmd.Flags().String("config", "", "config file of the client, its destinations and sources are ignored")
+	name := cmd.Flags().String("name", "connet-bench", "prefix of the generated forward names")
+	routes := cmd.Flags().StringArray("route", []string{"direct", "relay"}, "route to measure")
+	pings := cmd.Flags().Int("pings", 100, "number of round trips to measure latency with")
+	duration := cmd.Flags().Duration("duration", 3*time.Second, "duration of each throughput measurement")
+	timeout := cmd.Flags().Duration("timeout", 10*time.Second, "how long to wait for each route")
+	directAddr := cmd.Flags().String("direct-addr", ":0", "direct address to listen, a random port so it does not clash with a running client")
+	asJSON := cmd.Flags().Bool("json", false, "print the results as json")
+	logLevel := cmd.Flags().String("log-level", "", "log level to use, no logs if empty")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(*filename)
+		if err != nil {
+			return err
+		}
+		cfg.LogLevel = *logLevel
+		logger, err := logger(cfg)
+		if err != nil {
+			return kleverr.Ret(err)
+		}
+		if *logLevel == "" {
+			logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		}
+
+		benchCfg := connet.BenchConfig{
+			Name:     *name,
+			Pings:    *pings,
+			Duration: *duration,
+			Timeout:  *timeout,
+		}
+		for _, s := range *routes {
+			route, err := model.ParseRouteOption(s)
+			if err != nil {
+				return err
+			}
+			if route == model.RouteAny {
+				return kleverr.New("bench needs specific routes, either direct or relay")
+			}
+			benchCfg.Routes = append(benchCfg.Routes, route)
+		}
+
+		cfg.Client.DirectAddr = *directAddr
+		cfg.Client.PortMapping = false
+		cfg.Client.StatusAddr = ""
+		cfg.Client.DrainTimeout = ""
+		cfg.Client.Destinations = nil
+		cfg.Client.Sources = nil
+		opts, err := clientOptions(cfg.Client, logger)
+		if err != nil {
+			return err
+		}
+
+		results, err := connet.Bench(cmd.Context(), benchCfg, opts...)
+		if err != nil {
+			return err
+		}
+
+		if *asJSON {
+			enc := json.NewEncoder(cmd.OutOrStdout())
+			enc.SetIndent("", "  ")
+			return enc.Encode(results)
+		}
+		printBench(cmd.OutOrStdout(), results)
+		return nil
+	}
+
+	return cmd
+}
+
+func printBench(w io.Writer, results []connet.BenchResult) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTE\tPINGS\tMIN\tAVG\tP50\tP99\tDOWNLOAD\tUPLOAD\tERROR")
+	for _, r := range results {
+		round := func(d time.Duration) time.Duration { return d.Round(10 * time.Microsecond) }
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", r.Route, r.Pings,
+			round(r.LatencyMin), round(r.LatencyAvg), round(r.LatencyP50), round(r.LatencyP99),
+			formatRate(r.Download), formatRate(r.Upload), orNone(r.Error))
+	}
+	tw.Flush()
+}
+
+// formatRate formats bytes per second in megabits per second
+func formatRate(bytesPerSecond float64) string {
+	return fmt.Sprintf("%.1f Mbit/s", bytesPerSecond*8/1e6)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/klev-dev/kleverr"
+	"github.com/spf13/cobra"
+)
+
+func certCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cert",
+		Short: "manage certificates of a private pki",
+	}
+
+	cmd.AddCommand(certCACmd())
+	cmd.AddCommand(certLeafCmd("server", "create a server certificate, e.g. for control cert-file/key-file"))
+	cmd.AddCommand(certLeafCmd("client", "create a client certificate"))
+	cmd.AddCommand(certInspectCmd())
+
+	return cmd
+}
+
+func certCACmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "ca",
+		Short: "create a root certificate authority, or an intermediate one when signed by another",
+	}
+
+	keyType := cmd.Flags().String("key-type", "ed25519", "key type of the root: ed25519, ecdsa or rsa")
+	days := cmd.Flags().Int("days", 365, "number of days the certificate is valid for")
+	certFile := cmd.Flags().String("cert-file", "ca.pem", "file to write the certificate to, e.g. for server-cas/control-cas")
+	keyFile := cmd.Flags().String("key-file", "ca-key.pem", "file to write the private key to")
+	caCert := cmd.Flags().String("ca-cert-file", "", "certificate of the signing ca, creates an intermediate ca")
+	caKey := cmd.Flags().String("ca-key-file", "", "private key of the signing ca")
+	force := cmd.Flags().Bool("force", false, "overwrite existing certificate and key files")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		validity := time.Duration(*days) * 24 * time.Hour
+
+		if *caCert == "" {
+			alg, err := parseKeyType(*keyType)
+			if err != nil {
+				return err
+			}
+			root, err := certc.NewRootOpts(certc.RootOpts{Algorithm: alg, Validity: validity})
+			if err != nil {
+				return kleverr.Newf("cannot create root: %w", err)
+			}
+			return writeCert(root, nil, *certFile, *keyFile, *force)
+		}
+
+		if cmd.Flags().Changed("key-type") {
+			return kleverr.New("the key type of an intermediate ca follows its signing ca")
+		}
+		parent, chain, err := loadCA(*caCert, *caKey)
+		if err != nil {
+			return err
+		}
+		cert, err := parent.NewIntermediate(certc.CertOpts{Validity: validity})
+		if err != nil {
+			return kleverr.Newf("cannot create intermediate: %w", err)
+		}
+		return writeCert(cert, chain, *certFile, *keyFile, *force)
+	}
+
+	return cmd
+}
+
+func certLeafCmd(typ string, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   typ,
+		Short: short,
+	}
+
+	domains := cmd.Flags().StringArray("domain", nil, "domain name to include in the certificate")
+	ips := cmd.Flags().StringArray("ip", nil, "ip address to include in the certificate")
+	days := cmd.Flags().Int("days", 90, "number of days the certificate is valid for")
+	certFile := cmd.Flags().String("cert-file", typ+".pem", "file to write the certificate (and its chain) to")
+	keyFile := cmd.Flags().String("key-file", typ+"-key.pem", "file to write the private key to")
+	caCert := cmd.Flags().String("ca-cert-file", "ca.pem", "certificate of the signing ca")
+	caKey := cmd.Flags().String("ca-key-file", "ca-key.pem", "private key of the signing ca")
+	force := cmd.Flags().Bool("force", false, "overwrite existing certificate and key files")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		opts := certc.CertOpts{
+			Domains:  *domains,
+			Validity: time.Duration(*days) * 24 * time.Hour,
+		}
+		for _, s := range *ips {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				return kleverr.Newf("invalid ip address: %s", s)
+			}
+			opts.IPs = append(opts.IPs, ip)
+		}
+		if typ == "server" && len(opts.Domains) == 0 && len(opts.IPs) == 0 {
+			return kleverr.New("a server certificate needs at least one domain or ip")
+		}
+
+		parent, chain, err := loadCA(*caCert, *caKey)
+		if err != nil {
+			return err
+		}
+
+		var cert *certc.Cert
+		if typ == "server" {
+			cert, err = parent.NewServer(opts)
+		} else {
+			cert, err = parent.NewClient(opts)
+		}
+		if err != nil {
+			return kleverr.Newf("cannot create %s certificate: %w", typ, err)
+		}
+		return writeCert(cert, chain, *certFile, *keyFile, *force)
+	}
+
+	return cmd
+}
+
+func certInspectCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "inspect <cert-file>",
+		Short: "print the certificates in a pem file",
+		Args:  cobra.ExactArgs(1),
+	}
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		certs, err := readCerts(args[0])
+		if err != nil {
+			return err
+		}
+		for i, cert := range certs {
+			if i > 0 {
+				fmt.Fprintln(cmd.OutOrStdout())
+			}
+			printCert(cmd.OutOrStdout(), cert)
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func parseKeyType(s string) (x509.PublicKeyAlgorithm, error) {
+	switch strings.ToLower(s) {
+	case "ed25519":
+		return x509.Ed25519, nil
+	case "ecdsa":
+		return x509.ECDSA, nil
+	case "rsa":
+		return x509.RSA, nil
+	default:
+		return x509.UnknownPublicKeyAlgorithm, kleverr.Newf("unknown key type: %s", s)
+	}
+}
+
+// loadCA reads a signing ca, and the chain to include in the certificates it signs (empty for roots)
+func loadCA(certFile, keyFile string) (*certc.Cert, []*x509.Certificate, error) {
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, kleverr.Newf("cannot read ca cert: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, kleverr.Newf("cannot read ca key: %w", err)
+	}
+	ca, err := certc.DecodeFromMemory(certPEM, keyPEM)
+	if err != nil {
+		return nil, nil, kleverr.Newf("cannot decode ca: %w", err)
+	}
+
+	certs, err := readCerts(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !certs[0].IsCA {
+		return nil, nil, kleverr.Newf("%s is not a certificate authority", certFile)
+	}
+	if certs[0].CheckSignatureFrom(certs[0]) == nil {
+		return ca, nil, nil
+	}
+	return ca, certs, nil
+}
+
+func readCerts(path string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, kleverr.Newf("cannot read cert file: %w", err)
+	}
+
+	var certs []*x509.Certificate
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, kleverr.Newf("cannot parse certificate: %w", err)
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) == 0 {
+		return nil, kleverr.Newf("no certificates found in %s", path)
+	}
+	return certs, nil
+}
+
+// writeCert writes the certificate followed by its chain, and its private key. Unless forced, it does not
+// overwrite existing files, which could be the key of a ca that other certificates were issued with.
+func writeCert(cert *certc.Cert, chain []*x509.Certificate, certFile, keyFile string, force bool) error {
+	var certOut, keyOut strings.Builder
+	if err := cert.Encode(&certOut, &keyOut); err != nil {
+		return err
+	}
+	for _, c := range chain {
+		if err := pem.Encode(&certOut, &pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}); err != nil {
+			return kleverr.Ret(err)
+		}
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if !force {
+		// check both first, so neither is written when one already exists
+		for _, file := range []string{keyFile, certFile} {
+			if _, err := os.Stat(file); err == nil {
+				return kleverr.Newf("%s already exists, use --force to overwrite it", file)
+			}
+		}
+		flags = os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	}
+
+	if err := writeFile(keyFile, flags, []byte(keyOut.String()), 0600); err != nil {
+		return kleverr.Newf("cannot write key file: %w", err)
+	}
+	if err := writeFile(certFile, flags, []byte(certOut.String()), 0644); err != nil {
+		return kleverr.Newf("cannot write cert file: %w", err)
+	}
+	return nil
+}
+
+func writeFile(name string, flags int, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, flags, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func printCert(w io.Writer, cert *x509.Certificate) {
+	fingerprint := sha256.Sum256(cert.Raw)
+
+	fmt.Fprintf(w, "subject:     %s\n", cert.Subject)
+	fmt.Fprintf(w, "issuer:      %s\n", cert.Issuer)
+	fmt.Fprintf(w, "serial:      %s\n", cert.SerialNumber)
+	fmt.Fprintf(w, "not before:  %s\n", cert.NotBefore.Format(time.RFC3339))
+	fmt.Fprintf(w, "not after:   %s\n", cert.NotAfter.Format(time.RFC3339))
+	fmt.Fprintf(w, "key:         %s\n", cert.PublicKeyAlgorithm)
+	fmt.Fprintf(w, "ca:          %t\n", cert.IsCA)
+	if len(cert.DNSNames) > 0 {
+		fmt.Fprintf(w, "domains:     %s\n", strings.Join(cert.DNSNames, ", "))
+	}
+	if len(cert.IPAddresses) > 0 {
+		ips := make([]string, len(cert.IPAddresses))
+		for i, ip := range cert.IPAddresses {
+			ips[i] = ip.String()
+		}
+		fmt.Fprintf(w, "ips:         %s\n", strings.Join(ips, ", "))
+	}
+	var usages []string
+	for _, u := range cert.ExtKeyUsage {
+		switch u {
+		case x509.ExtKeyUsageServerAuth:
+			usages = append(usages, "server")
+		case x509.ExtKeyUsageClientAuth:
+			usages = append(usages, "client")
+		}
+	}
+	if len(usages) > 0 {
+		fmt.Fprintf(w, "usage:       %s\n", strings.Join(usages, ", "))
+	}
+	fmt.Fprintf(w, "sha256:      %s\n", hex.EncodeToString(fingerprint[:]))
+	fmt.Fprintf(w, "connet key:  %s\n", certc.NewKey(cert))
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"text/tabwriter"
+	"time"
+
+	"github.com/connet-dev/connet"
+	"github.com/klev-dev/kleverr"
+	"github.com/spf13/cobra"
+)
+
+func diagnoseCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diagnose",
+		Short: "check the connectivity of a client config, step by step",
+		Long: `check the connectivity of a client config, step by step
+
+Runs a temporary client with the same config, which joins its forwards as an additional peer
+for a moment. Its destinations refuse every connection, so sources move on to the actual ones.`,
+	}
+
+	filename := cmd.Flags().String("config", "", "config file of the client")
+	timeout := cmd.Flags().Duration("timeout", 10*time.Second, "how long to wait for routes to peers")
+	directAddr := cmd.Flags().String("direct-addr", ":0", "direct address to listen, a random port so it does not clash with a running client")
+	logLevel := cmd.Flags().String("log-level", "", "log level to use, no logs if empty")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(*filename)
+		if err != nil {
+			return err
+		}
+		cfg.LogLevel = *logLevel
+		logger, err := logger(cfg)
+		if err != nil {
+			return kleverr.Ret(err)
+		}
+		if *logLevel == "" {
+			// the diagnosis reports what went wrong, logs are only needed to dig deeper
+			logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+		}
+
+		cfg.Client.DirectAddr = *directAddr
+		cfg.Client.PortMapping = false
+		cfg.Client.StatusAddr = ""
+		cfg.Client.DrainTimeout = ""
+		opts, err := clientOptions(cfg.Client, logger)
+		if err != nil {
+			return err
+		}
+
+		steps, err := connet.Diagnose(cmd.Context(), *timeout, opts...)
+		if err != nil {
+			return err
+		}
+		if failed := printDiagnosis(cmd.OutOrStdout(), steps); failed > 0 {
+			// the table already explains the failures, no need for a stack trace
+			return fmt.Errorf("%d of %d checks failed", failed, len(steps))
+		}
+		return nil
+	}
+
+	return cmd
+}
+
+func printDiagnosis(w io.Writer, steps []connet.DiagnoseStep) int {
+	var failed int
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RESULT\tCHECK\tFORWARD\tTARGET\tDETAIL")
+	for _, step := range steps {
+		fwd := "-"
+		if step.Forward != "" {
+			fwd = fmt.Sprintf("%s (%s)", step.Forward, step.Role)
+		}
+		detail := step.Detail
+		if step.Code != 0 {
+			detail = fmt.Sprintf("%s [%s %d]", detail, step.Code, step.Code)
+		}
+		if step.Result == connet.DiagnoseFailed {
+			failed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", step.Result, step.Check, fwd, orNone(step.Target), detail)
+	}
+	tw.Flush()
+	return failed
+}
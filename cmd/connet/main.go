@@ -5,17 +5,24 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/connet-dev/connet"
+	"github.com/connet-dev/connet/acmec"
+	"github.com/connet-dev/connet/certc"
 	"github.com/connet-dev/connet/control"
 	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/netc"
 	"github.com/connet-dev/connet/relay"
 	"github.com/connet-dev/connet/selfhosted"
 	"github.com/klev-dev/kleverr"
@@ -35,8 +42,11 @@ type Config struct {
 }
 
 type ServerConfig struct {
-	Tokens     []string `toml:"tokens"`
-	TokensFile string   `toml:"tokens-file"`
+	Tokens               []string `toml:"tokens"`
+	TokensFile           string   `toml:"tokens-file"`
+	ClientCAs            string   `toml:"client-cas"`
+	ClientIdentities     []string `toml:"client-identities"`
+	ClientIdentitiesFile string   `toml:"client-identities-file"`
 
 	Addr string `toml:"addr"`
 	Cert string `toml:"cert-file"`
@@ -45,21 +55,52 @@ type ServerConfig struct {
 	RelayAddr     string `toml:"relay-addr"`
 	RelayHostname string `toml:"relay-hostname"`
 
+	RelayIdleTimeout string                        `toml:"relay-idle-timeout"`
+	RelayMaxLifetime string                        `toml:"relay-max-lifetime"`
+	RelayForwards    map[string]RelayForwardConfig `toml:"relay-forwards"`
+
 	StoreDir string `toml:"store-dir"`
+
+	StatusAddr string `toml:"status-addr"`
+
+	QUIC QUICConfig `toml:"quic"`
 }
 
 type ControlConfig struct {
 	ClientTokens     []string `toml:"client-tokens"`
 	ClientTokensFile string   `toml:"client-tokens-file"`
 
+	ClientJWKS        string `toml:"client-jwks"`
+	ClientJWTIssuer   string `toml:"client-jwt-issuer"`
+	ClientJWTAudience string `toml:"client-jwt-audience"`
+
 	RelayTokens     []string `toml:"relay-tokens"`
 	RelayTokensFile string   `toml:"relay-tokens-file"`
 
+	ClientCAs            string   `toml:"client-cas"`
+	ClientIdentities     []string `toml:"client-identities"`
+	ClientIdentitiesFile string   `toml:"client-identities-file"`
+	RelayCAs             string   `toml:"relay-cas"`
+	RelayIdentities      []string `toml:"relay-identities"`
+	RelayIdentitiesFile  string   `toml:"relay-identities-file"`
+
 	Addr string `toml:"addr"`
 	Cert string `toml:"cert-file"`
 	Key  string `toml:"key-file"`
 
+	ACMEDomains   []string `toml:"acme-domains"`
+	ACMEEmail     string   `toml:"acme-email"`
+	ACMEDirectory string   `toml:"acme-directory"`
+	ACMEHTTPAddr  string   `toml:"acme-http-addr"`
+	ACMEDNSHook   string   `toml:"acme-dns-hook"`
+
 	StoreDir string `toml:"store-dir"`
+
+	AuditSyslog string `toml:"audit-syslog"`
+
+	StatusAddr string `toml:"status-addr"`
+
+	QUIC QUICConfig `toml:"quic"`
 }
 
 type RelayConfig struct {
@@ -72,7 +113,23 @@ type RelayConfig struct {
 	ControlAddr string `toml:"control-addr"`
 	ControlCAs  string `toml:"control-cas"`
 
+	Cert string `toml:"cert-file"`
+	Key  string `toml:"key-file"`
+
 	StoreDir string `toml:"store-dir"`
+
+	StatusAddr string `toml:"status-addr"`
+
+	IdleTimeout string                        `toml:"idle-timeout"`
+	MaxLifetime string                        `toml:"max-lifetime"`
+	Forwards    map[string]RelayForwardConfig `toml:"forwards"`
+
+	QUIC QUICConfig `toml:"quic"`
+}
+
+type RelayForwardConfig struct {
+	IdleTimeout string `toml:"idle-timeout"`
+	MaxLifetime string `toml:"max-lifetime"`
 }
 
 type ClientConfig struct {
@@ -83,6 +140,18 @@ type ClientConfig struct {
 	ServerCAs  string `toml:"server-cas"`
 	DirectAddr string `toml:"direct-addr"`
 
+	Cert string `toml:"cert-file"`
+	Key  string `toml:"key-file"`
+
+	PortMapping        bool   `toml:"port-mapping"`
+	PortMappingGateway string `toml:"port-mapping-gateway"`
+
+	StatusAddr string `toml:"status-addr"`
+
+	DrainTimeout string `toml:"drain-timeout"`
+
+	QUIC QUICConfig `toml:"quic"`
+
 	Destinations map[string]ForwardConfig `toml:"destinations"`
 	Sources      map[string]ForwardConfig `toml:"sources"`
 }
@@ -90,6 +159,9 @@ type ClientConfig struct {
 type ForwardConfig struct {
 	Addr  string `toml:"addr"`
 	Route string `toml:"route"`
+
+	IdleTimeout string `toml:"idle-timeout"`
+	MaxLifetime string `toml:"max-lifetime"`
 }
 
 func main() {
@@ -122,6 +194,11 @@ func rootCmd() *cobra.Command {
 	cmd.AddCommand(controlCmd())
 	cmd.AddCommand(relayCmd())
 	cmd.AddCommand(checkCmd())
+	cmd.AddCommand(certCmd())
+	cmd.AddCommand(statusCmd())
+	cmd.AddCommand(peersCmd())
+	cmd.AddCommand(diagnoseCmd())
+	cmd.AddCommand(benchCmd())
 
 	filename := cmd.Flags().String("config", "", "config file to load")
 
@@ -135,18 +212,30 @@ func rootCmd() *cobra.Command {
 	cmd.Flags().StringVar(&flagsConfig.Client.ServerAddr, "server-addr", "", "control server address to connect")
 	cmd.Flags().StringVar(&flagsConfig.Client.ServerCAs, "server-cas", "", "control server CAs to use")
 	cmd.Flags().StringVar(&flagsConfig.Client.DirectAddr, "direct-addr", "", "direct server address to listen")
+	cmd.Flags().BoolVar(&flagsConfig.Client.PortMapping, "port-mapping", false, "map the direct port on the local gateway (PCP, NAT-PMP or UPnP)")
+	cmd.Flags().StringVar(&flagsConfig.Client.PortMappingGateway, "port-mapping-gateway", "", "gateway address for port mapping, discovered if empty")
+
+	cmd.Flags().StringVar(&flagsConfig.Client.Cert, "cert-file", "", "client cert to authenticate with, instead of a token")
+	cmd.Flags().StringVar(&flagsConfig.Client.Key, "key-file", "", "client cert key to authenticate with")
+
+	cmd.Flags().StringVar(&flagsConfig.Client.StatusAddr, "status-addr", "", "address (or unix:<path> socket) to serve the client status on")
+	cmd.Flags().StringVar(&flagsConfig.Client.DrainTimeout, "drain-timeout", "", "how long to wait for conns in flight when stopping (e.g. 30s)")
 
 	var dstName string
 	var dstCfg ForwardConfig
 	cmd.Flags().StringVar(&dstName, "dst-name", "", "destination name")
 	cmd.Flags().StringVar(&dstCfg.Addr, "dst-addr", "", "destination address")
 	cmd.Flags().StringVar(&dstCfg.Route, "dst-route", "", "destination route")
+	cmd.Flags().StringVar(&dstCfg.IdleTimeout, "dst-idle-timeout", "", "close destination conns idle for this long (e.g. 5m)")
+	cmd.Flags().StringVar(&dstCfg.MaxLifetime, "dst-max-lifetime", "", "close destination conns open for this long (e.g. 24h)")
 
 	var srcName string
 	var srcCfg ForwardConfig
 	cmd.Flags().StringVar(&srcName, "src-name", "", "source name")
 	cmd.Flags().StringVar(&srcCfg.Addr, "src-addr", "", "source address")
 	cmd.Flags().StringVar(&srcCfg.Route, "src-route", "", "source route")
+	cmd.Flags().StringVar(&srcCfg.IdleTimeout, "src-idle-timeout", "", "close source conns idle for this long (e.g. 5m)")
+	cmd.Flags().StringVar(&srcCfg.MaxLifetime, "src-max-lifetime", "", "close source conns open for this long (e.g. 24h)")
 
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		cfg, err := loadConfig(*filename)
@@ -188,6 +277,9 @@ func serverCmd() *cobra.Command {
 
 	cmd.Flags().StringArrayVar(&flagsConfig.Server.Tokens, "tokens", nil, "tokens for clients to connect")
 	cmd.Flags().StringVar(&flagsConfig.Server.TokensFile, "tokens-file", "", "tokens file to load")
+	cmd.Flags().StringVar(&flagsConfig.Server.ClientCAs, "client-cas", "", "CAs to require and verify client certs with")
+	cmd.Flags().StringArrayVar(&flagsConfig.Server.ClientIdentities, "client-identities", nil, "client cert identities to accept")
+	cmd.Flags().StringVar(&flagsConfig.Server.ClientIdentitiesFile, "client-identities-file", "", "client cert identities file to load")
 
 	cmd.Flags().StringVar(&flagsConfig.Server.Addr, "addr", "", "control server addr to use")
 	cmd.Flags().StringVar(&flagsConfig.Server.Cert, "cert-file", "", "control server cert to use")
@@ -195,9 +287,13 @@ func serverCmd() *cobra.Command {
 
 	cmd.Flags().StringVar(&flagsConfig.Server.RelayAddr, "relay-addr", "", "relay server addr to use")
 	cmd.Flags().StringVar(&flagsConfig.Server.RelayHostname, "relay-hostname", "", "relay server public hostname to use")
+	cmd.Flags().StringVar(&flagsConfig.Server.RelayIdleTimeout, "relay-idle-timeout", "", "close relayed conns idle for this long (e.g. 5m)")
+	cmd.Flags().StringVar(&flagsConfig.Server.RelayMaxLifetime, "relay-max-lifetime", "", "close relayed conns open for this long (e.g. 24h)")
 
 	cmd.Flags().StringVar(&flagsConfig.Server.StoreDir, "store-dir", "", "storage dir, /tmp subdirectory if empty")
 
+	cmd.Flags().StringVar(&flagsConfig.Server.StatusAddr, "status-addr", "", "address (or unix:<path> socket) to serve the control status on")
+
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		cfg, err := loadConfig(*filename)
 		if err != nil {
@@ -214,6 +310,8 @@ func serverCmd() *cobra.Command {
 		return serverRun(cmd.Context(), cfg.Server, logger)
 	}
 
+	cmd.AddCommand(controlStatusCmd("print the status of a running server", func(cfg Config) string { return cfg.Server.StatusAddr }))
+
 	return cmd
 }
 
@@ -232,15 +330,36 @@ func controlCmd() *cobra.Command {
 	cmd.Flags().StringArrayVar(&flagsConfig.Control.ClientTokens, "client-tokens", nil, "client tokens for clients to connect")
 	cmd.Flags().StringVar(&flagsConfig.Control.ClientTokensFile, "client-tokens-file", "", "client tokens file to load")
 
+	cmd.Flags().StringVar(&flagsConfig.Control.ClientJWKS, "client-jwks", "", "jwks file or url to validate client jwt tokens")
+	cmd.Flags().StringVar(&flagsConfig.Control.ClientJWTIssuer, "client-jwt-issuer", "", "expected issuer of client jwt tokens")
+	cmd.Flags().StringVar(&flagsConfig.Control.ClientJWTAudience, "client-jwt-audience", "", "expected audience of client jwt tokens")
+
 	cmd.Flags().StringArrayVar(&flagsConfig.Control.RelayTokens, "relay-tokens", nil, "relay tokens for clients to connect")
 	cmd.Flags().StringVar(&flagsConfig.Control.RelayTokensFile, "relay-tokens-file", "", "relay tokens file to load")
 
+	cmd.Flags().StringVar(&flagsConfig.Control.ClientCAs, "client-cas", "", "CAs to require and verify client certs with")
+	cmd.Flags().StringArrayVar(&flagsConfig.Control.ClientIdentities, "client-identities", nil, "client cert identities to accept")
+	cmd.Flags().StringVar(&flagsConfig.Control.ClientIdentitiesFile, "client-identities-file", "", "client cert identities file to load")
+	cmd.Flags().StringVar(&flagsConfig.Control.RelayCAs, "relay-cas", "", "CAs to require and verify relay certs with")
+	cmd.Flags().StringArrayVar(&flagsConfig.Control.RelayIdentities, "relay-identities", nil, "relay cert identities to accept")
+	cmd.Flags().StringVar(&flagsConfig.Control.RelayIdentitiesFile, "relay-identities-file", "", "relay cert identities file to load")
+
 	cmd.Flags().StringVar(&flagsConfig.Control.Addr, "addr", "", "control server addr to use")
 	cmd.Flags().StringVar(&flagsConfig.Control.Cert, "cert-file", "", "control server cert to use")
 	cmd.Flags().StringVar(&flagsConfig.Control.Key, "key-file", "", "control server key to use")
 
+	cmd.Flags().StringArrayVar(&flagsConfig.Control.ACMEDomains, "acme-domain", nil, "domain to obtain an acme certificate for")
+	cmd.Flags().StringVar(&flagsConfig.Control.ACMEEmail, "acme-email", "", "contact email of the acme account")
+	cmd.Flags().StringVar(&flagsConfig.Control.ACMEDirectory, "acme-directory", "", "acme directory url, lets encrypt if empty")
+	cmd.Flags().StringVar(&flagsConfig.Control.ACMEHTTPAddr, "acme-http-addr", "", "addr to answer http-01 challenges on, :80 if empty")
+	cmd.Flags().StringVar(&flagsConfig.Control.ACMEDNSHook, "acme-dns-hook", "", "command to answer dns-01 challenges with, instead of http-01")
+
 	cmd.Flags().StringVar(&flagsConfig.Control.StoreDir, "store-dir", "", "storage dir, /tmp subdirectory if empty")
 
+	cmd.Flags().StringVar(&flagsConfig.Control.AuditSyslog, "audit-syslog", "", "syslog socket to forward audit events to")
+
+	cmd.Flags().StringVar(&flagsConfig.Control.StatusAddr, "status-addr", "", "address (or unix:<path> socket) to serve the control status on")
+
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		cfg, err := loadConfig(*filename)
 		if err != nil {
@@ -257,6 +376,39 @@ func controlCmd() *cobra.Command {
 		return controlRun(cmd.Context(), cfg.Control, logger)
 	}
 
+	cmd.AddCommand(controlAuditCmd())
+	cmd.AddCommand(controlStatusCmd("print the status of a running control server", func(cfg Config) string { return cfg.Control.StatusAddr }))
+
+	return cmd
+}
+
+func controlAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "export the control server audit log as json lines",
+	}
+
+	filename := cmd.Flags().String("config", "", "config file to load")
+
+	var flagsConfig Config
+	cmd.Flags().StringVar(&flagsConfig.Control.StoreDir, "store-dir", "", "storage dir of the control server")
+
+	fingerprint := cmd.Flags().String("fingerprint", "", "print the fingerprint of this token in the audit log, instead of exporting it")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig(*filename)
+		if err != nil {
+			return err
+		}
+
+		cfg.merge(flagsConfig)
+
+		if *fingerprint != "" {
+			return controlAuditFingerprint(cfg.Control, *fingerprint, cmd.OutOrStdout())
+		}
+		return controlAuditExport(cfg.Control, cmd.OutOrStdout())
+	}
+
 	return cmd
 }
 
@@ -281,8 +433,16 @@ func relayCmd() *cobra.Command {
 	cmd.Flags().StringVar(&flagsConfig.Relay.ControlAddr, "control-addr", "", "control server address to connect")
 	cmd.Flags().StringVar(&flagsConfig.Relay.ControlCAs, "control-cas", "", "control server CAs to use")
 
+	cmd.Flags().StringVar(&flagsConfig.Relay.Cert, "cert-file", "", "relay cert to authenticate with, instead of a token")
+	cmd.Flags().StringVar(&flagsConfig.Relay.Key, "key-file", "", "relay cert key to authenticate with")
+
 	cmd.Flags().StringVar(&flagsConfig.Relay.StoreDir, "store-dir", "", "storage dir, /tmp subdirectory if empty")
 
+	cmd.Flags().StringVar(&flagsConfig.Relay.StatusAddr, "status-addr", "", "address (or unix:<path> socket) to serve the relay status on")
+
+	cmd.Flags().StringVar(&flagsConfig.Relay.IdleTimeout, "idle-timeout", "", "close relayed conns idle for this long (e.g. 5m)")
+	cmd.Flags().StringVar(&flagsConfig.Relay.MaxLifetime, "max-lifetime", "", "close relayed conns open for this long (e.g. 24h)")
+
 	cmd.RunE = func(cmd *cobra.Command, args []string) error {
 		cfg, err := loadConfig(*filename)
 		if err != nil {
@@ -299,6 +459,8 @@ func relayCmd() *cobra.Command {
 		return relayRun(cmd.Context(), cfg.Relay, logger)
 	}
 
+	cmd.AddCommand(relayStatusCmd())
+
 	return cmd
 }
 
@@ -370,14 +532,23 @@ func logger(cfg Config) (*slog.Logger, error) {
 }
 
 func clientRun(ctx context.Context, cfg ClientConfig, logger *slog.Logger) error {
+	opts, err := clientOptions(cfg, logger)
+	if err != nil {
+		return err
+	}
+
+	cl, err := connet.NewClient(opts...)
+	if err != nil {
+		return err
+	}
+	return cl.Run(ctx)
+}
+
+func clientOptions(cfg ClientConfig, logger *slog.Logger) ([]connet.ClientOption, error) {
 	var opts []connet.ClientOption
 
 	if cfg.TokenFile != "" {
-		tokens, err := loadTokens(cfg.TokenFile)
-		if err != nil {
-			return err
-		}
-		opts = append(opts, connet.ClientToken(tokens[0]))
+		opts = append(opts, connet.ClientTokenFile(cfg.TokenFile))
 	} else {
 		opts = append(opts, connet.ClientToken(cfg.Token))
 	}
@@ -388,47 +559,81 @@ func clientRun(ctx context.Context, cfg ClientConfig, logger *slog.Logger) error
 	if cfg.ServerCAs != "" {
 		opts = append(opts, connet.ClientControlCAs(cfg.ServerCAs))
 	}
+	if cfg.Cert != "" {
+		opts = append(opts, connet.ClientControlCertificate(cfg.Cert, cfg.Key))
+	}
 
 	if cfg.DirectAddr != "" {
 		opts = append(opts, connet.ClientDirectAddress(cfg.DirectAddr))
 	}
+	if cfg.PortMapping {
+		opts = append(opts, connet.ClientPortMapping(cfg.PortMappingGateway))
+	}
+	if cfg.StatusAddr != "" {
+		opts = append(opts, connet.ClientStatusAddress(cfg.StatusAddr))
+	}
+	if cfg.DrainTimeout != "" {
+		timeout, err := time.ParseDuration(cfg.DrainTimeout)
+		if err != nil {
+			return nil, kleverr.Newf("drain-timeout cannot be parsed: %w", err)
+		}
+		opts = append(opts, connet.ClientDrainTimeout(timeout))
+	}
+
+	quicConf, err := cfg.QUIC.parse()
+	if err != nil {
+		return nil, err
+	}
+	opts = append(opts, connet.ClientQUICConfig(quicConf))
 
 	for name, fc := range cfg.Destinations {
 		route, err := parseRouteOption(fc.Route)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		opts = append(opts, connet.ClientDestination(name, fc.Addr, route))
+
+		timeouts, err := parseJoinTimeouts(fc.IdleTimeout, fc.MaxLifetime)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connet.ClientDestinationTimeouts(name, timeouts))
 	}
 	for name, fc := range cfg.Sources {
 		route, err := parseRouteOption(fc.Route)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		opts = append(opts, connet.ClientSource(name, fc.Addr, route))
+
+		timeouts, err := parseJoinTimeouts(fc.IdleTimeout, fc.MaxLifetime)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, connet.ClientSourceTimeouts(name, timeouts))
 	}
 
 	opts = append(opts, connet.ClientLogger(logger))
 
-	cl, err := connet.NewClient(opts...)
-	if err != nil {
-		return err
-	}
-	return cl.Run(ctx)
+	return opts, nil
 }
 
 func serverRun(ctx context.Context, cfg ServerConfig, logger *slog.Logger) error {
 	var opts []connet.ServerOption
 
 	if cfg.TokensFile != "" {
-		tokens, err := loadTokens(cfg.TokensFile)
-		if err != nil {
-			return err
-		}
-		opts = append(opts, connet.ServerClientTokens(tokens...))
+		opts = append(opts, connet.ServerClientTokensFile(cfg.TokensFile))
 	} else {
 		opts = append(opts, connet.ServerClientTokens(cfg.Tokens...))
 	}
+	if cfg.ClientCAs != "" {
+		opts = append(opts, connet.ServerClientCAs(cfg.ClientCAs))
+		if cfg.ClientIdentitiesFile != "" {
+			opts = append(opts, connet.ServerClientIdentitiesFile(cfg.ClientIdentitiesFile))
+		} else {
+			opts = append(opts, connet.ServerClientIdentities(cfg.ClientIdentities...))
+		}
+	}
 
 	if cfg.Addr != "" {
 		opts = append(opts, connet.ServerControlAddress(cfg.Addr))
@@ -444,9 +649,31 @@ func serverRun(ctx context.Context, cfg ServerConfig, logger *slog.Logger) error
 		opts = append(opts, connet.ServerRelayHostname(cfg.RelayHostname))
 	}
 
+	relayTimeouts, err := parseJoinTimeouts(cfg.RelayIdleTimeout, cfg.RelayMaxLifetime)
+	if err != nil {
+		return err
+	}
+	opts = append(opts, connet.ServerRelayTimeouts(relayTimeouts))
+	for name, fc := range cfg.RelayForwards {
+		timeouts, err := parseJoinTimeouts(fc.IdleTimeout, fc.MaxLifetime)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, connet.ServerRelayForwardTimeouts(name, timeouts))
+	}
+
 	if cfg.StoreDir != "" {
 		opts = append(opts, connet.ServerStoreDir(cfg.StoreDir))
 	}
+	if cfg.StatusAddr != "" {
+		opts = append(opts, connet.ServerStatusAddress(cfg.StatusAddr))
+	}
+
+	quicConf, err := cfg.QUIC.parse()
+	if err != nil {
+		return err
+	}
+	opts = append(opts, connet.ServerQUICConfig(quicConf))
 
 	opts = append(opts, connet.ServerLogger(logger))
 
@@ -462,26 +689,72 @@ func controlRun(ctx context.Context, cfg ControlConfig, logger *slog.Logger) err
 		Logger: logger,
 	}
 
-	if cfg.ClientTokensFile != "" {
-		tokens, err := loadTokens(cfg.ClientTokensFile)
+	if cfg.ClientJWKS != "" || cfg.ClientJWTIssuer != "" {
+		auth, err := selfhosted.NewJWTAuthenticator(selfhosted.JWTConfig{
+			JWKS:     cfg.ClientJWKS,
+			Issuer:   cfg.ClientJWTIssuer,
+			Audience: cfg.ClientJWTAudience,
+			Logger:   logger,
+		})
 		if err != nil {
 			return err
 		}
-		controlCfg.ClientAuth = selfhosted.NewClientAuthenticator(tokens...)
+		controlCfg.ClientAuth = auth
+	} else if cfg.ClientTokensFile != "" {
+		auth, err := selfhosted.NewClientAuthenticatorFile(cfg.ClientTokensFile, logger)
+		if err != nil {
+			return err
+		}
+		controlCfg.ClientAuth = auth
 	} else {
 		controlCfg.ClientAuth = selfhosted.NewClientAuthenticator(cfg.ClientTokens...)
 	}
 
 	if cfg.RelayTokensFile != "" {
-		tokens, err := loadTokens(cfg.RelayTokensFile)
+		auth, err := selfhosted.NewRelayAuthenticatorFile(cfg.RelayTokensFile, logger)
 		if err != nil {
 			return err
 		}
-		controlCfg.RelayAuth = selfhosted.NewRelayAuthenticator(tokens...)
+		controlCfg.RelayAuth = auth
 	} else {
 		controlCfg.RelayAuth = selfhosted.NewRelayAuthenticator(cfg.RelayTokens...)
 	}
 
+	if cfg.ClientCAs != "" {
+		cas, err := loadCertPool(cfg.ClientCAs)
+		if err != nil {
+			return err
+		}
+		controlCfg.ClientCAs = cas
+
+		if cfg.ClientIdentitiesFile != "" {
+			auth, err := selfhosted.NewClientCertAuthenticatorFile(cfg.ClientIdentitiesFile, logger)
+			if err != nil {
+				return err
+			}
+			controlCfg.ClientCertAuth = auth
+		} else {
+			controlCfg.ClientCertAuth = selfhosted.NewClientCertAuthenticator(cfg.ClientIdentities...)
+		}
+	}
+	if cfg.RelayCAs != "" {
+		cas, err := loadCertPool(cfg.RelayCAs)
+		if err != nil {
+			return err
+		}
+		controlCfg.RelayCAs = cas
+
+		if cfg.RelayIdentitiesFile != "" {
+			auth, err := selfhosted.NewRelayCertAuthenticatorFile(cfg.RelayIdentitiesFile, logger)
+			if err != nil {
+				return err
+			}
+			controlCfg.RelayCertAuth = auth
+		} else {
+			controlCfg.RelayCertAuth = selfhosted.NewRelayCertAuthenticator(cfg.RelayIdentities...)
+		}
+	}
+
 	if cfg.Addr == "" {
 		cfg.Addr = ":19190"
 	}
@@ -492,11 +765,43 @@ func controlRun(ctx context.Context, cfg ControlConfig, logger *slog.Logger) err
 	controlCfg.Addr = addr
 
 	if cfg.Cert != "" {
-		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		certFile, err := certc.NewCertFile(cfg.Cert, cfg.Key, logger)
 		if err != nil {
 			return kleverr.Newf("control cert cannot be loaded: %w", err)
 		}
-		controlCfg.Cert = cert
+		controlCfg.CertSource = certFile
+	}
+
+	if len(cfg.ACMEDomains) > 0 {
+		if cfg.Cert != "" {
+			return kleverr.New("acme cannot be used together with a cert file")
+		}
+		if cfg.StoreDir == "" {
+			return kleverr.New("store dir is required to keep acme certificates")
+		}
+
+		var solver acmec.Solver
+		if cfg.ACMEDNSHook != "" {
+			solver = acmec.NewDNSHookSolver(cfg.ACMEDNSHook)
+		} else {
+			if cfg.ACMEHTTPAddr == "" {
+				cfg.ACMEHTTPAddr = ":80"
+			}
+			solver = acmec.NewHTTPSolver(cfg.ACMEHTTPAddr)
+		}
+
+		certs, err := acmec.NewManager(acmec.Config{
+			Domains:      cfg.ACMEDomains,
+			Email:        cfg.ACMEEmail,
+			DirectoryURL: cfg.ACMEDirectory,
+			Dir:          filepath.Join(cfg.StoreDir, "acme"),
+			Solver:       solver,
+			Logger:       logger,
+		})
+		if err != nil {
+			return err
+		}
+		controlCfg.CertSource = certs
 	}
 
 	if cfg.StoreDir == "" {
@@ -508,6 +813,14 @@ func controlRun(ctx context.Context, cfg ControlConfig, logger *slog.Logger) err
 		controlCfg.Stores = control.NewFileStores(cfg.StoreDir)
 	}
 
+	controlCfg.AuditSyslog = cfg.AuditSyslog
+	controlCfg.StatusAddr = cfg.StatusAddr
+
+	controlCfg.QUIC, err = cfg.QUIC.parse()
+	if err != nil {
+		return err
+	}
+
 	srv, err := control.NewServer(controlCfg)
 	if err != nil {
 		return err
@@ -515,6 +828,44 @@ func controlRun(ctx context.Context, cfg ControlConfig, logger *slog.Logger) err
 	return srv.Run(ctx)
 }
 
+func controlAuditFingerprint(cfg ControlConfig, token string, w io.Writer) error {
+	if cfg.StoreDir == "" {
+		return kleverr.New("store dir is required to fingerprint tokens")
+	}
+
+	fingerprint, err := control.AuditTokenFingerprint(cfg.StoreDir, token)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, fingerprint)
+	return nil
+}
+
+func controlAuditExport(cfg ControlConfig, w io.Writer) error {
+	if cfg.StoreDir == "" {
+		return kleverr.New("store dir is required to export the audit log")
+	}
+
+	events, err := control.NewAuditReader(cfg.StoreDir)
+	if err != nil {
+		return kleverr.Newf("cannot open audit log: %w", err)
+	}
+	defer events.Close()
+
+	msgs, _, err := events.Snapshot()
+	if err != nil {
+		return kleverr.Newf("cannot read audit log: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	for _, msg := range msgs {
+		if err := enc.Encode(msg.Value); err != nil {
+			return kleverr.Ret(err)
+		}
+	}
+	return nil
+}
+
 func relayRun(ctx context.Context, cfg RelayConfig, logger *slog.Logger) error {
 	relayCfg := relay.Config{
 		Logger: logger,
@@ -547,11 +898,7 @@ func relayRun(ctx context.Context, cfg RelayConfig, logger *slog.Logger) error {
 	if cfg.ControlAddr == "" {
 		cfg.ControlAddr = "localhost:19190"
 	}
-	controlAddr, err := net.ResolveUDPAddr("udp", cfg.ControlAddr)
-	if err != nil {
-		return kleverr.Newf("control address cannot be resolved: %w", err)
-	}
-	relayCfg.ControlAddr = controlAddr
+	relayCfg.ControlAddr = cfg.ControlAddr
 
 	if cfg.ControlCAs != "" {
 		casData, err := os.ReadFile(cfg.ControlCAs)
@@ -566,6 +913,14 @@ func relayRun(ctx context.Context, cfg RelayConfig, logger *slog.Logger) error {
 		relayCfg.ControlCAs = cas
 	}
 
+	if cfg.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return kleverr.Newf("relay cert cannot be loaded: %w", err)
+		}
+		relayCfg.ControlCert = &cert
+	}
+
 	controlHost, _, err := net.SplitHostPort(cfg.ControlAddr)
 	if err != nil {
 		return err
@@ -581,6 +936,28 @@ func relayRun(ctx context.Context, cfg RelayConfig, logger *slog.Logger) error {
 		relayCfg.Stores = relay.NewFileStores(cfg.StoreDir)
 	}
 
+	relayCfg.StatusAddr = cfg.StatusAddr
+
+	relayCfg.Timeouts, err = parseJoinTimeouts(cfg.IdleTimeout, cfg.MaxLifetime)
+	if err != nil {
+		return err
+	}
+	for name, fc := range cfg.Forwards {
+		timeouts, err := parseJoinTimeouts(fc.IdleTimeout, fc.MaxLifetime)
+		if err != nil {
+			return err
+		}
+		if relayCfg.ForwardTimeouts == nil {
+			relayCfg.ForwardTimeouts = map[model.Forward]netc.JoinTimeouts{}
+		}
+		relayCfg.ForwardTimeouts[model.NewForward(name)] = timeouts
+	}
+
+	relayCfg.QUIC, err = cfg.QUIC.parse()
+	if err != nil {
+		return err
+	}
+
 	srv, err := relay.NewServer(relayCfg)
 	if err != nil {
 		return err
@@ -612,6 +989,25 @@ func parseRouteOption(s string) (model.RouteOption, error) {
 	return model.ParseRouteOption(s)
 }
 
+func parseJoinTimeouts(idleTimeout, maxLifetime string) (netc.JoinTimeouts, error) {
+	var timeouts netc.JoinTimeouts
+	if idleTimeout != "" {
+		d, err := time.ParseDuration(idleTimeout)
+		if err != nil {
+			return timeouts, kleverr.Newf("idle-timeout cannot be parsed: %w", err)
+		}
+		timeouts.Idle = d
+	}
+	if maxLifetime != "" {
+		d, err := time.ParseDuration(maxLifetime)
+		if err != nil {
+			return timeouts, kleverr.Newf("max-lifetime cannot be parsed: %w", err)
+		}
+		timeouts.MaxLifetime = d
+	}
+	return timeouts, nil
+}
+
 func (c *Config) merge(o Config) {
 	c.LogLevel = override(c.LogLevel, o.LogLevel)
 	c.LogFormat = override(c.LogFormat, o.LogFormat)
@@ -630,6 +1026,13 @@ func (c *ClientConfig) merge(o ClientConfig) {
 	c.ServerAddr = override(c.ServerAddr, o.ServerAddr)
 	c.ServerCAs = override(c.ServerCAs, o.ServerCAs)
 	c.DirectAddr = override(c.DirectAddr, o.DirectAddr)
+	c.Cert = override(c.Cert, o.Cert)
+	c.Key = override(c.Key, o.Key)
+	c.PortMapping = c.PortMapping || o.PortMapping
+	c.PortMappingGateway = override(c.PortMappingGateway, o.PortMappingGateway)
+	c.StatusAddr = override(c.StatusAddr, o.StatusAddr)
+	c.DrainTimeout = override(c.DrainTimeout, o.DrainTimeout)
+	c.QUIC.merge(o.QUIC)
 
 	for k, v := range o.Destinations {
 		if c.Destinations == nil {
@@ -649,6 +1052,9 @@ func (c *ClientConfig) merge(o ClientConfig) {
 func (c *ServerConfig) merge(o ServerConfig) {
 	c.Tokens = append(c.Tokens, o.Tokens...)
 	c.TokensFile = override(c.TokensFile, o.TokensFile)
+	c.ClientCAs = override(c.ClientCAs, o.ClientCAs)
+	c.ClientIdentities = append(c.ClientIdentities, o.ClientIdentities...)
+	c.ClientIdentitiesFile = override(c.ClientIdentitiesFile, o.ClientIdentitiesFile)
 
 	c.Addr = override(c.Addr, o.Addr)
 	c.Cert = override(c.Cert, o.Cert)
@@ -656,22 +1062,48 @@ func (c *ServerConfig) merge(o ServerConfig) {
 
 	c.RelayAddr = override(c.RelayAddr, o.RelayAddr)
 	c.RelayHostname = override(c.RelayHostname, o.RelayHostname)
+	c.RelayIdleTimeout = override(c.RelayIdleTimeout, o.RelayIdleTimeout)
+	c.RelayMaxLifetime = override(c.RelayMaxLifetime, o.RelayMaxLifetime)
+	c.RelayForwards = mergeRelayForwards(c.RelayForwards, o.RelayForwards)
 
 	c.StoreDir = override(c.StoreDir, o.StoreDir)
+	c.StatusAddr = override(c.StatusAddr, o.StatusAddr)
+	c.QUIC.merge(o.QUIC)
 }
 
 func (c *ControlConfig) merge(o ControlConfig) {
 	c.ClientTokens = append(c.ClientTokens, o.ClientTokens...)
 	c.ClientTokensFile = override(c.ClientTokensFile, o.ClientTokensFile)
 
+	c.ClientJWKS = override(c.ClientJWKS, o.ClientJWKS)
+	c.ClientJWTIssuer = override(c.ClientJWTIssuer, o.ClientJWTIssuer)
+	c.ClientJWTAudience = override(c.ClientJWTAudience, o.ClientJWTAudience)
+
 	c.RelayTokens = append(c.RelayTokens, o.RelayTokens...)
 	c.RelayTokensFile = override(c.RelayTokensFile, o.RelayTokensFile)
 
+	c.ClientCAs = override(c.ClientCAs, o.ClientCAs)
+	c.ClientIdentities = append(c.ClientIdentities, o.ClientIdentities...)
+	c.ClientIdentitiesFile = override(c.ClientIdentitiesFile, o.ClientIdentitiesFile)
+	c.RelayCAs = override(c.RelayCAs, o.RelayCAs)
+	c.RelayIdentities = append(c.RelayIdentities, o.RelayIdentities...)
+	c.RelayIdentitiesFile = override(c.RelayIdentitiesFile, o.RelayIdentitiesFile)
+
 	c.Addr = override(c.Addr, o.Addr)
 	c.Cert = override(c.Cert, o.Cert)
 	c.Key = override(c.Key, o.Key)
 
+	c.ACMEDomains = append(c.ACMEDomains, o.ACMEDomains...)
+	c.ACMEEmail = override(c.ACMEEmail, o.ACMEEmail)
+	c.ACMEDirectory = override(c.ACMEDirectory, o.ACMEDirectory)
+	c.ACMEHTTPAddr = override(c.ACMEHTTPAddr, o.ACMEHTTPAddr)
+	c.ACMEDNSHook = override(c.ACMEDNSHook, o.ACMEDNSHook)
+
 	c.StoreDir = override(c.StoreDir, o.StoreDir)
+
+	c.AuditSyslog = override(c.AuditSyslog, o.AuditSyslog)
+	c.StatusAddr = override(c.StatusAddr, o.StatusAddr)
+	c.QUIC.merge(o.QUIC)
 }
 
 func (c *RelayConfig) merge(o RelayConfig) {
@@ -684,14 +1116,53 @@ func (c *RelayConfig) merge(o RelayConfig) {
 	c.ControlAddr = override(c.ControlAddr, o.ControlAddr)
 	c.ControlCAs = override(c.ControlCAs, o.ControlCAs)
 
+	c.Cert = override(c.Cert, o.Cert)
+	c.Key = override(c.Key, o.Key)
+
 	c.StoreDir = override(c.StoreDir, o.StoreDir)
+	c.StatusAddr = override(c.StatusAddr, o.StatusAddr)
+
+	c.IdleTimeout = override(c.IdleTimeout, o.IdleTimeout)
+	c.MaxLifetime = override(c.MaxLifetime, o.MaxLifetime)
+	c.Forwards = mergeRelayForwards(c.Forwards, o.Forwards)
+
+	c.QUIC.merge(o.QUIC)
+}
+
+func loadCertPool(path string) (*x509.CertPool, error) {
+	casData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, kleverr.Newf("cannot read certs file: %w", err)
+	}
+
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(casData) {
+		return nil, kleverr.Newf("no certificates found in %s", path)
+	}
+	return cas, nil
 }
 
 func mergeForwardConfig(c, o ForwardConfig) ForwardConfig {
 	return ForwardConfig{
 		Addr:  override(c.Addr, o.Addr),
 		Route: override(c.Route, o.Route),
+
+		IdleTimeout: override(c.IdleTimeout, o.IdleTimeout),
+		MaxLifetime: override(c.MaxLifetime, o.MaxLifetime),
+	}
+}
+
+func mergeRelayForwards(c, o map[string]RelayForwardConfig) map[string]RelayForwardConfig {
+	for k, v := range o {
+		if c == nil {
+			c = map[string]RelayForwardConfig{}
+		}
+		c[k] = RelayForwardConfig{
+			IdleTimeout: override(c[k].IdleTimeout, v.IdleTimeout),
+			MaxLifetime: override(c[k].MaxLifetime, v.MaxLifetime),
+		}
 	}
+	return c
 }
 
 func override(s, o string) string {
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"time"
+
+	"github.com/connet-dev/connet/quicc"
+	"github.com/klev-dev/kleverr"
+)
+
+type QUICConfig struct {
+	MaxIdleTimeout  string `toml:"max-idle-timeout"`
+	KeepAlivePeriod string `toml:"keepalive-period"`
+
+	InitialStreamReceiveWindow     uint64 `toml:"initial-stream-receive-window"`
+	MaxStreamReceiveWindow         uint64 `toml:"max-stream-receive-window"`
+	InitialConnectionReceiveWindow uint64 `toml:"initial-connection-receive-window"`
+	MaxConnectionReceiveWindow     uint64 `toml:"max-connection-receive-window"`
+
+	MaxIncomingStreams int64 `toml:"max-incoming-streams"`
+
+	EnableDatagrams bool `toml:"enable-datagrams"`
+
+	UDPReadBuffer  int `toml:"udp-read-buffer"`
+	UDPWriteBuffer int `toml:"udp-write-buffer"`
+}
+
+func (c QUICConfig) parse() (quicc.Config, error) {
+	cfg := quicc.Config{
+		InitialStreamReceiveWindow:     c.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         c.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: c.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     c.MaxConnectionReceiveWindow,
+
+		MaxIncomingStreams: c.MaxIncomingStreams,
+
+		EnableDatagrams: c.EnableDatagrams,
+
+		UDPReadBuffer:  c.UDPReadBuffer,
+		UDPWriteBuffer: c.UDPWriteBuffer,
+	}
+
+	if c.MaxIdleTimeout != "" {
+		d, err := time.ParseDuration(c.MaxIdleTimeout)
+		if err != nil {
+			return cfg, kleverr.Newf("quic max-idle-timeout cannot be parsed: %w", err)
+		}
+		cfg.MaxIdleTimeout = d
+	}
+	if c.KeepAlivePeriod != "" {
+		d, err := time.ParseDuration(c.KeepAlivePeriod)
+		if err != nil {
+			return cfg, kleverr.Newf("quic keepalive-period cannot be parsed: %w", err)
+		}
+		cfg.KeepAlivePeriod = d
+	}
+
+	return cfg, nil
+}
+
+func (c *QUICConfig) merge(o QUICConfig) {
+	c.MaxIdleTimeout = override(c.MaxIdleTimeout, o.MaxIdleTimeout)
+	c.KeepAlivePeriod = override(c.KeepAlivePeriod, o.KeepAlivePeriod)
+
+	c.InitialStreamReceiveWindow = overrideNum(c.InitialStreamReceiveWindow, o.InitialStreamReceiveWindow)
+	c.MaxStreamReceiveWindow = overrideNum(c.MaxStreamReceiveWindow, o.MaxStreamReceiveWindow)
+	c.InitialConnectionReceiveWindow = overrideNum(c.InitialConnectionReceiveWindow, o.InitialConnectionReceiveWindow)
+	c.MaxConnectionReceiveWindow = overrideNum(c.MaxConnectionReceiveWindow, o.MaxConnectionReceiveWindow)
+
+	c.MaxIncomingStreams = overrideNum(c.MaxIncomingStreams, o.MaxIncomingStreams)
+
+	c.EnableDatagrams = c.EnableDatagrams || o.EnableDatagrams
+
+	c.UDPReadBuffer = overrideNum(c.UDPReadBuffer, o.UDPReadBuffer)
+	c.UDPWriteBuffer = overrideNum(c.UDPWriteBuffer, o.UDPWriteBuffer)
+}
+
+func overrideNum[T uint64 | int64 | int](s, o T) T {
+	if o != 0 {
+		return o
+	}
+	return s
+}
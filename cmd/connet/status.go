@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/connet-dev/connet"
+	"github.com/connet-dev/connet/client"
+	"github.com/connet-dev/connet/control"
+	"github.com/connet-dev/connet/relay"
+	"github.com/connet-dev/connet/statusc"
+	"github.com/klev-dev/kleverr"
+	"github.com/spf13/cobra"
+)
+
+func statusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "print the forwards of a running client, and how healthy they are",
+	}
+
+	filename := cmd.Flags().String("config", "", "config file of the client")
+	statusAddr := cmd.Flags().String("status-addr", "", "status address of the client, instead of its config")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		status, err := clientStatus(cmd, *filename, *statusAddr)
+		if err != nil {
+			return err
+		}
+		printClientStatus(cmd.OutOrStdout(), status)
+		return nil
+	}
+
+	return cmd
+}
+
+func peersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "peers",
+		Short: "print the active routes of a running client to its peers",
+	}
+
+	filename := cmd.Flags().String("config", "", "config file of the client")
+	statusAddr := cmd.Flags().String("status-addr", "", "status address of the client, instead of its config")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		status, err := clientStatus(cmd, *filename, *statusAddr)
+		if err != nil {
+			return err
+		}
+		printClientPeers(cmd.OutOrStdout(), status)
+		return nil
+	}
+
+	return cmd
+}
+
+func controlStatusCmd(short string, configAddr func(Config) string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: short,
+	}
+
+	filename := cmd.Flags().String("config", "", "config file of the server")
+	statusAddr := cmd.Flags().String("status-addr", "", "status address of the server, instead of its config")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		addr, err := statusAddress(*filename, *statusAddr, configAddr)
+		if err != nil {
+			return err
+		}
+		status, err := statusc.Get[control.Status](cmd.Context(), addr)
+		if err != nil {
+			return err
+		}
+		printControlStatus(cmd.OutOrStdout(), status)
+		return nil
+	}
+
+	return cmd
+}
+
+func relayStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "print the forwards of a running relay server, and the conns it joins",
+	}
+
+	filename := cmd.Flags().String("config", "", "config file of the relay server")
+	statusAddr := cmd.Flags().String("status-addr", "", "status address of the relay server, instead of its config")
+
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		addr, err := statusAddress(*filename, *statusAddr, func(cfg Config) string { return cfg.Relay.StatusAddr })
+		if err != nil {
+			return err
+		}
+		status, err := statusc.Get[relay.Status](cmd.Context(), addr)
+		if err != nil {
+			return err
+		}
+		printRelayStatus(cmd.OutOrStdout(), status)
+		return nil
+	}
+
+	return cmd
+}
+
+func statusAddress(filename, statusAddr string, configAddr func(Config) string) (string, error) {
+	if statusAddr != "" {
+		return statusAddr, nil
+	}
+	cfg, err := loadConfig(filename)
+	if err != nil {
+		return "", err
+	}
+	if addr := configAddr(cfg); addr != "" {
+		return addr, nil
+	}
+	return "", kleverr.New("status address is missing, set status-addr in the config or use --status-addr")
+}
+
+func clientStatus(cmd *cobra.Command, filename, statusAddr string) (connet.ClientStatus, error) {
+	addr, err := statusAddress(filename, statusAddr, func(cfg Config) string { return cfg.Client.StatusAddr })
+	if err != nil {
+		return connet.ClientStatus{}, err
+	}
+	return statusc.Get[connet.ClientStatus](cmd.Context(), addr)
+}
+
+func printClientStatus(w io.Writer, status connet.ClientStatus) {
+	state := fmt.Sprintf("%s since %s", status.Control.State, status.Control.Since.Format(time.RFC3339))
+	if status.Control.Addr != "" {
+		state = fmt.Sprintf("%s to %s since %s", status.Control.State, status.Control.Addr, status.Control.Since.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "control: %s\n", state)
+	if status.Control.Error != "" {
+		fmt.Fprintf(w, "error:   %s\n", status.Control.Error)
+	}
+	direct := make([]string, len(status.DirectAddrs))
+	for i, addr := range status.DirectAddrs {
+		direct[i] = addr.String()
+	}
+	fmt.Fprintf(w, "direct:  %s\n\n", orNone(strings.Join(direct, ", ")))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FORWARD\tROLE\tPEERS\tRELAYS\tROUTES\tCONNS\tREAPED\tHEALTH")
+	eachForward(status, func(fwd, role string, s client.Status) {
+		var connected int
+		for _, r := range s.Relays {
+			if r.Connected {
+				connected++
+			}
+		}
+		var routes []string
+		for _, r := range s.Routes {
+			routes = append(routes, r.Style)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d/%d\t%s\t%d\t%s\t%s\n", fwd, role, len(s.Peers), connected, len(s.Relays),
+			orNone(strings.Join(routes, ",")), s.Conns.Active, reaped(s.Conns.ReapedIdle, s.Conns.ReapedLifetime), forwardHealth(s))
+	})
+	tw.Flush()
+}
+
+// reaped formats the conns closed by their idle timeout and max lifetime
+func reaped(idle, lifetime uint64) string {
+	return fmt.Sprintf("%d idle, %d lifetime", idle, lifetime)
+}
+
+func forwardHealth(s client.Status) string {
+	switch {
+	case len(s.Peers) == 0:
+		return "no peers announced"
+	case len(s.Routes) == 0:
+		return "no route to peers"
+	default:
+		return "ok"
+	}
+}
+
+func printClientPeers(w io.Writer, status connet.ClientStatus) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FORWARD\tROLE\tPEER\tROUTE\tADDR\tRTT\tLATE")
+	eachForward(status, func(fwd, role string, s client.Status) {
+		for _, r := range s.Routes {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%.1f%%\n", fwd, role, r.Peer, r.Style, r.Addr,
+				r.RTT.Round(time.Microsecond*100), r.Late*100)
+		}
+	})
+	tw.Flush()
+}
+
+func eachForward(status connet.ClientStatus, fn func(fwd, role string, s client.Status)) {
+	for _, fwd := range slices.Sorted(maps.Keys(status.Destinations)) {
+		fn(fwd, "destination", status.Destinations[fwd])
+	}
+	for _, fwd := range slices.Sorted(maps.Keys(status.Sources)) {
+		fn(fwd, "source", status.Sources[fwd])
+	}
+}
+
+func printControlStatus(w io.Writer, status control.Status) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "CLIENT\tADDR")
+	for _, c := range status.Clients {
+		fmt.Fprintf(tw, "%s\t%s\n", c.ID, c.Addr)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "RELAY\tHOSTPORT")
+	for _, r := range status.Relays {
+		fmt.Fprintf(tw, "%s\t%s\n", r.ID, r.Hostport)
+	}
+	fmt.Fprintln(tw)
+
+	fmt.Fprintln(tw, "FORWARD\tDESTINATIONS\tSOURCES\tRELAYS\tHEALTH")
+	for _, f := range status.Forwards {
+		health := "ok"
+		switch {
+		case len(f.Destinations) == 0:
+			health = "no destinations"
+		case len(f.Sources) == 0:
+			health = "no sources"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\n", f.Forward, len(f.Destinations), len(f.Sources),
+			orNone(strings.Join(f.Relays, ",")), health)
+	}
+	tw.Flush()
+}
+
+func printRelayStatus(w io.Writer, status relay.Status) {
+	fmt.Fprintf(w, "reaped: %s\n\n", reaped(status.ReapedIdle, status.ReapedLifetime))
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FORWARD\tDESTINATIONS\tSOURCES\tCONNS\tREAPED")
+	for _, f := range status.Forwards {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\n", f.Forward, f.Destinations, f.Sources, f.Active,
+			reaped(f.ReapedIdle, f.ReapedLifetime))
+	}
+	tw.Flush()
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
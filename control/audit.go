@@ -0,0 +1,349 @@
+package control
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/connet-dev/connet/logc"
+	"github.com/klev-dev/kleverr"
+	"github.com/segmentio/ksuid"
+	"golang.org/x/sync/errgroup"
+)
+
+type AuditEvent string
+
+const (
+	AuditClientAuthenticated AuditEvent = "client-authenticated"
+	AuditClientAuthFailed    AuditEvent = "client-auth-failed"
+	AuditClientDisconnected  AuditEvent = "client-disconnected"
+	AuditRelayConnected      AuditEvent = "relay-connected"
+	AuditRelayAuthFailed     AuditEvent = "relay-auth-failed"
+	AuditRelayDisconnected   AuditEvent = "relay-disconnected"
+	AuditAnnounce            AuditEvent = "announce"
+	AuditRevoke              AuditEvent = "revoke"
+	AuditDenied              AuditEvent = "denied"
+)
+
+// failed reports if the event is a rejected attempt
+func (e AuditEvent) failed() bool {
+	switch e {
+	case AuditClientAuthFailed, AuditRelayAuthFailed, AuditDenied:
+		return true
+	default:
+		return false
+	}
+}
+
+// TokenFingerprint identifies a token in the audit log without storing the token itself. It is keyed with
+// a secret of the server, so tokens cannot be guessed offline from the log alone.
+func TokenFingerprint(secret []byte, token string) string {
+	if token == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// AuditTokenFingerprint computes the fingerprint of token with the secret of a stopped control server in dir,
+// to look the token up in its audit log
+func AuditTokenFingerprint(dir string, token string) (string, error) {
+	config, err := logc.NewReadonlyKV[ConfigKey, ConfigValue](filepath.Join(dir, "config"))
+	if err != nil {
+		return "", err
+	}
+	defer config.Close()
+
+	secret, err := config.Get(configServerAuditSecret)
+	if err != nil {
+		return "", kleverr.Newf("cannot read audit secret: %w", err)
+	}
+	return TokenFingerprint(secret.Bytes, token), nil
+}
+
+const (
+	// repeated failures of a remote within this window are aggregated into a single event
+	auditFailuresWindow = time.Minute
+	// how many remotes are tracked at once, the failures of any others are aggregated together
+	auditFailuresRemotes = 4096
+	// how many events can wait to be forwarded to syslog, newer events are dropped when it is full
+	auditSyslogQueue = 1024
+)
+
+type auditLog struct {
+	events logc.KV[AuditKey, AuditValue]
+	secret []byte
+	syslog *syslogWriter
+	logger *slog.Logger
+
+	failures   map[auditFailureKey]*auditFailures
+	failuresMu sync.Mutex
+}
+
+type auditFailureKey struct {
+	event  AuditEvent
+	remote string // the host only, since the port changes on each attempt
+}
+
+// auditFailures tracks the failures of a remote after the first one was recorded
+type auditFailures struct {
+	start    time.Time
+	repeated int
+	last     AuditValue
+}
+
+func newAuditLog(stores Stores, config logc.KV[ConfigKey, ConfigValue], syslogPath string, logger *slog.Logger) (*auditLog, error) {
+	events, err := stores.Audit()
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := config.GetOrInit(configServerAuditSecret, func(ck ConfigKey) (ConfigValue, error) {
+		privateKey := [32]byte{}
+		if _, err := io.ReadFull(rand.Reader, privateKey[:]); err != nil {
+			return ConfigValue{}, err
+		}
+		return ConfigValue{Bytes: privateKey[:]}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	a := &auditLog{
+		events:   events,
+		secret:   secret.Bytes,
+		logger:   logger.With("audit", "events"),
+		failures: map[auditFailureKey]*auditFailures{},
+	}
+	if syslogPath != "" {
+		a.syslog = &syslogWriter{path: syslogPath, queue: make(chan AuditValue, auditSyslogQueue)}
+	}
+	return a, nil
+}
+
+// run forwards events to syslog and records the aggregated failures once their window is over
+func (a *auditLog) run(ctx context.Context) error {
+	g, ctx := errgroup.WithContext(ctx)
+
+	if a.syslog != nil {
+		g.Go(func() error { return a.syslog.run(ctx, a.logger) })
+	}
+	g.Go(func() error {
+		t := time.NewTicker(auditFailuresWindow / 4)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case now := <-t.C:
+				a.flushFailures(now)
+			}
+		}
+	})
+
+	return g.Wait()
+}
+
+// fingerprint identifies token in the events of this server, see TokenFingerprint
+func (a *auditLog) fingerprint(token string) string {
+	return TokenFingerprint(a.secret, token)
+}
+
+// record appends an event to the audit log. Failures are logged, but do not fail the calling operation.
+func (a *auditLog) record(v AuditValue) {
+	if v.Time.IsZero() {
+		v.Time = time.Now()
+	}
+
+	if err := a.events.Put(AuditKey{ksuid.New()}, v); err != nil {
+		a.logger.Warn("cannot store audit event", "event", v.Event, "err", err)
+	}
+	if a.syslog != nil {
+		a.syslog.enqueue(v, a.logger)
+	}
+}
+
+// recordFailure records the first failed authentication of a remote in a window, and only counts the ones
+// repeated after it, so unauthenticated peers cannot grow the log with each attempt
+func (a *auditLog) recordFailure(v AuditValue) {
+	if v.Time.IsZero() {
+		v.Time = time.Now()
+	}
+	host := v.Remote
+	if h, _, err := net.SplitHostPort(v.Remote); err == nil {
+		host = h
+	}
+
+	a.failuresMu.Lock()
+	key := auditFailureKey{v.Event, host}
+	if _, ok := a.failures[key]; !ok && len(a.failures) >= auditFailuresRemotes {
+		key.remote = "*"
+	}
+	if f, ok := a.failures[key]; ok && v.Time.Sub(f.start) < auditFailuresWindow {
+		f.repeated++
+		f.last = v
+		a.failuresMu.Unlock()
+		return
+	}
+	summary := a.failures[key].summary()
+	a.failures[key] = &auditFailures{start: v.Time}
+	a.failuresMu.Unlock()
+
+	if summary != nil {
+		a.record(*summary)
+	}
+	a.record(v)
+}
+
+// flushFailures records the failures repeated in windows that are over, and stops tracking their remotes
+func (a *auditLog) flushFailures(now time.Time) {
+	var summaries []AuditValue
+	a.failuresMu.Lock()
+	for key, f := range a.failures {
+		if now.Sub(f.start) < auditFailuresWindow {
+			continue
+		}
+		if summary := f.summary(); summary != nil {
+			summaries = append(summaries, *summary)
+		}
+		delete(a.failures, key)
+	}
+	a.failuresMu.Unlock()
+
+	for _, v := range summaries {
+		a.record(v)
+	}
+}
+
+// summary is the last of the repeated failures, with how many there were, or nil if there were none
+func (f *auditFailures) summary() *AuditValue {
+	if f == nil || f.repeated == 0 {
+		return nil
+	}
+	v := f.last
+	v.Count = f.repeated
+	return &v
+}
+
+func auditAddr(addr net.Addr) string {
+	if addr == nil {
+		return ""
+	}
+	return addr.String()
+}
+
+func auditErr(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+const (
+	syslogFacilityAuthpriv = 10
+	syslogSeverityWarning  = 4
+	syslogSeverityNotice   = 5
+)
+
+// syslogWriter forwards audit events as JSON to a local syslog socket, like /dev/log. Events are queued,
+// so a slow or missing syslog does not block the connections recording them.
+type syslogWriter struct {
+	path    string
+	queue   chan AuditValue
+	dropped atomic.Int64
+
+	conn net.Conn
+}
+
+// enqueue adds the event to the queue, dropping it if the queue is full
+func (w *syslogWriter) enqueue(v AuditValue, logger *slog.Logger) {
+	select {
+	case w.queue <- v:
+	default:
+		if w.dropped.Add(1) == 1 {
+			logger.Warn("syslog queue is full, dropping audit events")
+		}
+	}
+}
+
+func (w *syslogWriter) run(ctx context.Context, logger *slog.Logger) error {
+	defer func() {
+		if w.conn != nil {
+			w.conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case v := <-w.queue:
+			if err := w.write(v); err != nil {
+				logger.Warn("cannot forward audit event", "event", v.Event, "err", err)
+			}
+		}
+		if dropped := w.dropped.Swap(0); dropped > 0 {
+			logger.Warn("dropped audit events forwarded to syslog", "dropped", dropped)
+		}
+	}
+}
+
+func (w *syslogWriter) write(v AuditValue) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return kleverr.Ret(err)
+	}
+
+	severity := syslogSeverityNotice
+	if v.Event.failed() {
+		severity = syslogSeverityWarning
+	}
+	msg := fmt.Sprintf("<%d>%s connet[%d]: %s\n", syslogFacilityAuthpriv*8+severity,
+		v.Time.Format(time.Stamp), os.Getpid(), data)
+
+	// retry once with a fresh connection, in case syslog was restarted
+	for attempt := 0; ; attempt++ {
+		if w.conn == nil {
+			conn, err := dialSyslog(w.path)
+			if err != nil {
+				return err
+			}
+			w.conn = conn
+		}
+
+		_, err := w.conn.Write([]byte(msg))
+		if err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+		if attempt > 0 {
+			return kleverr.Newf("cannot write to syslog: %w", err)
+		}
+	}
+}
+
+func dialSyslog(path string) (net.Conn, error) {
+	conn, err := net.Dial("unixgram", path)
+	if err == nil {
+		return conn, nil
+	}
+	conn, err = net.Dial("unix", path)
+	if err != nil {
+		return nil, kleverr.Newf("cannot connect to syslog: %w", err)
+	}
+	return conn, nil
+}
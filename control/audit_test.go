@@ -0,0 +1,110 @@
+package control
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLog(t *testing.T) {
+	dir := t.TempDir()
+	syslogPath := filepath.Join(dir, "syslog.sock")
+	syslog, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: syslogPath, Net: "unixgram"})
+	require.NoError(t, err)
+	defer syslog.Close()
+
+	stores := NewFileStores(dir)
+	config, err := stores.Config()
+	require.NoError(t, err)
+	audit, err := newAuditLog(stores, config, syslogPath, slog.Default())
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go audit.run(ctx)
+
+	audit.recordFailure(AuditValue{Event: AuditClientAuthFailed, Remote: "127.0.0.1:1234", Token: audit.fingerprint("secret")})
+	audit.record(AuditValue{Event: AuditAnnounce, Forward: "db", Role: "destination"})
+
+	buf := make([]byte, 4096)
+	n, err := syslog.Read(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	require.True(t, strings.HasPrefix(msg, "<84>"), msg)
+	_, data, ok := strings.Cut(msg, "]: ")
+	require.True(t, ok)
+	var v AuditValue
+	require.NoError(t, json.Unmarshal([]byte(data), &v))
+	require.Equal(t, AuditClientAuthFailed, v.Event)
+	require.NotContains(t, msg, "secret")
+
+	cancel()
+	require.NoError(t, audit.events.Close())
+	require.NoError(t, config.Close())
+
+	events, err := NewAuditReader(dir)
+	require.NoError(t, err)
+	defer events.Close()
+
+	msgs, _, err := events.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, msgs, 2)
+	require.Equal(t, AuditClientAuthFailed, msgs[0].Value.Event)
+	require.Equal(t, "127.0.0.1:1234", msgs[0].Value.Remote)
+	require.Len(t, msgs[0].Value.Token, 16)
+	// the fingerprint is keyed with the server secret, not a plain hash of the token
+	sum := sha256.Sum256([]byte("secret"))
+	require.NotEqual(t, hex.EncodeToString(sum[:8]), msgs[0].Value.Token)
+	fingerprint, err := AuditTokenFingerprint(dir, "secret")
+	require.NoError(t, err)
+	require.Equal(t, fingerprint, msgs[0].Value.Token)
+	require.Equal(t, AuditAnnounce, msgs[1].Value.Event)
+	require.Equal(t, "db", msgs[1].Value.Forward)
+}
+
+func TestAuditLogFailures(t *testing.T) {
+	stores := NewFileStores(t.TempDir())
+	config, err := stores.Config()
+	require.NoError(t, err)
+	// a syslog that is never read from, so its queue fills up
+	audit, err := newAuditLog(stores, config, filepath.Join(t.TempDir(), "missing.sock"), slog.Default())
+	require.NoError(t, err)
+
+	start := time.Now()
+	for i := range 10 {
+		audit.recordFailure(AuditValue{Time: start.Add(time.Duration(i) * time.Millisecond),
+			Event: AuditClientAuthFailed, Remote: fmt.Sprintf("192.0.2.1:%d", 1000+i)})
+	}
+	audit.recordFailure(AuditValue{Time: start, Event: AuditClientAuthFailed, Remote: "192.0.2.2:1000"})
+	for range auditSyslogQueue {
+		audit.record(AuditValue{Event: AuditAnnounce})
+	}
+	require.Positive(t, audit.syslog.dropped.Load())
+
+	msgs, _, err := audit.events.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, msgs, 2+auditSyslogQueue)
+	require.Equal(t, "192.0.2.1:1000", msgs[0].Value.Remote)
+	require.Equal(t, "192.0.2.2:1000", msgs[1].Value.Remote)
+
+	// once the window is over, the repeated failures are recorded as one event
+	audit.flushFailures(start.Add(auditFailuresWindow))
+	msgs, _, err = audit.events.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, msgs, 3+auditSyslogQueue)
+	summary := msgs[len(msgs)-1].Value
+	require.Equal(t, AuditClientAuthFailed, summary.Event)
+	require.Equal(t, "192.0.2.1:1009", summary.Remote)
+	require.Equal(t, 9, summary.Count)
+	require.Empty(t, audit.failures)
+}
@@ -0,0 +1,91 @@
+package control
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"slices"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+	"github.com/quic-go/quic-go"
+)
+
+// ClientCertAuthenticator validates clients presenting a certificate, see Config.ClientCAs. It is separate from
+// ClientAuthenticator, so certificate identities and tokens cannot stand in for each other.
+type ClientCertAuthenticator interface {
+	AuthenticateCertificate(cert *x509.Certificate) (ClientAuthentication, error)
+}
+
+// RelayCertAuthenticator is the same as ClientCertAuthenticator, for relays and Config.RelayCAs
+type RelayCertAuthenticator interface {
+	AuthenticateCertificate(cert *x509.Certificate) (RelayAuthentication, error)
+}
+
+// CertIdentity is the identity of a client or relay certificate: its first DNS, email or URI SAN,
+// or its subject common name when it has none of these
+func CertIdentity(cert *x509.Certificate) (string, error) {
+	switch {
+	case len(cert.DNSNames) > 0:
+		return cert.DNSNames[0], nil
+	case len(cert.EmailAddresses) > 0:
+		return cert.EmailAddresses[0], nil
+	case len(cert.URIs) > 0:
+		return cert.URIs[0].String(), nil
+	case cert.Subject.CommonName != "":
+		return cert.Subject.CommonName, nil
+	}
+	return "", kleverr.New("certificate has no identity, it needs a SAN or a subject common name")
+}
+
+// peerIdentity returns the identity of the verified certificate of the remote, if it presented one
+func peerIdentity(conn quic.Connection) (string, bool, error) {
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return "", false, nil
+	}
+	identity, err := CertIdentity(certs[0])
+	return identity, true, err
+}
+
+// peerCertificate returns the verified certificate of the remote, or nil when it did not present one
+func peerCertificate(conn quic.Connection) *x509.Certificate {
+	certs := conn.ConnectionState().TLS.PeerCertificates
+	if len(certs) == 0 {
+		return nil
+	}
+	return certs[0]
+}
+
+// checkCertificate fails once cert expired, since connections outlive the handshake which verified it
+func checkCertificate(cert *x509.Certificate, now time.Time) error {
+	if now.After(cert.NotAfter) {
+		return kleverr.Newf("certificate expired at %s", cert.NotAfter.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// clientCertConfig requires certificates signed by clientCAs from clients and by relayCAs from relays,
+// selecting by the protocol the remote asks for. A nil pool does not require certificates for that protocol.
+func clientCertConfig(base *tls.Config, clientCAs, relayCAs *x509.CertPool) func(*tls.ClientHelloInfo) (*tls.Config, error) {
+	return func(chi *tls.ClientHelloInfo) (*tls.Config, error) {
+		proto, cas := "connet", clientCAs
+		if slices.Contains(chi.SupportedProtos, "connet-relays") {
+			proto, cas = "connet-relays", relayCAs
+		}
+
+		conf := base.Clone()
+		conf.GetConfigForClient = nil
+		// only the selected protocol can be negotiated, so the certificate requirement cannot be sidestepped
+		conf.NextProtos = []string{proto}
+		if cas != nil {
+			conf.ClientCAs = cas
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+		return conf, nil
+	}
+}
+
+func auditIdentity(conn quic.Connection) string {
+	identity, _, _ := peerIdentity(conn)
+	return identity
+}
@@ -0,0 +1,211 @@
+package control
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"log/slog"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/pbs"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCertIdentity(t *testing.T) {
+	u, err := url.Parse("spiffe://example.com/client")
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		cert     *x509.Certificate
+		identity string
+	}{
+		{&x509.Certificate{DNSNames: []string{"a.example.com", "b.example.com"}, EmailAddresses: []string{"c@example.com"}}, "a.example.com"},
+		{&x509.Certificate{EmailAddresses: []string{"c@example.com"}, URIs: []*url.URL{u}}, "c@example.com"},
+		{&x509.Certificate{URIs: []*url.URL{u}, Subject: pkix.Name{CommonName: "cn"}}, "spiffe://example.com/client"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "cn"}}, "cn"},
+	} {
+		identity, err := CertIdentity(tc.cert)
+		require.NoError(t, err)
+		require.Equal(t, tc.identity, identity)
+	}
+
+	_, err = CertIdentity(&x509.Certificate{})
+	require.Error(t, err)
+}
+
+type testClientAuthenticator map[string]struct{}
+
+func (a testClientAuthenticator) Authenticate(token string) (ClientAuthentication, error) {
+	if _, ok := a[token]; !ok {
+		return nil, errors.New("unknown")
+	}
+	return testClientAuthentication(token), nil
+}
+
+type testClientAuthentication string
+
+func (a testClientAuthentication) Validate(fwd model.Forward, _ model.Role) (model.Forward, error) {
+	return fwd, nil
+}
+
+func (a testClientAuthentication) MarshalBinary() ([]byte, error) {
+	return []byte(a), nil
+}
+
+type testClientCertAuthenticator map[string]struct{}
+
+func (a testClientCertAuthenticator) AuthenticateCertificate(cert *x509.Certificate) (ClientAuthentication, error) {
+	identity, err := CertIdentity(cert)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := a[identity]; !ok {
+		return nil, errors.New("unknown")
+	}
+	return testClientAuthentication(identity), nil
+}
+
+type testRelayAuthenticator struct{}
+
+func (testRelayAuthenticator) Authenticate(token string) (RelayAuthentication, error) {
+	return nil, errors.New("unknown")
+}
+
+func TestClientCertificates(t *testing.T) {
+	serverCert, serverCAs, err := certc.SelfSigned("localhost")
+	require.NoError(t, err)
+
+	root, err := certc.NewRoot()
+	require.NoError(t, err)
+	clientCAs, err := root.CertPool()
+	require.NoError(t, err)
+
+	newClientCert := func(root *certc.Cert, domain string) tls.Certificate {
+		cert, err := root.NewClient(certc.CertOpts{Domains: []string{domain}})
+		require.NoError(t, err)
+		tlsCert, err := cert.TLSCert()
+		require.NoError(t, err)
+		return tlsCert
+	}
+
+	srv, err := NewServer(Config{
+		Addr:           &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 19390},
+		Cert:           serverCert,
+		ClientAuth:     testClientAuthenticator{"client-token": {}},
+		ClientCAs:      clientCAs,
+		ClientCertAuth: testClientCertAuthenticator{"client.example.com": {}},
+		RelayAuth:      testRelayAuthenticator{},
+		Stores:         NewFileStores(t.TempDir()),
+		Logger:         slog.Default(),
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Run(ctx)
+
+	connect := func(protos []string, token string, certs ...tls.Certificate) (string, error) {
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+
+		var conn quic.Connection
+		var err error
+		require.Eventually(t, func() bool {
+			conn, err = quic.DialAddr(ctx, "127.0.0.1:19390", &tls.Config{
+				ServerName:   "localhost",
+				RootCAs:      serverCAs,
+				Certificates: certs,
+				NextProtos:   protos,
+			}, &quic.Config{})
+			var nerr *net.OpError
+			return !errors.As(err, &nerr)
+		}, 5*time.Second, 10*time.Millisecond)
+		if err != nil {
+			return "", err
+		}
+		defer conn.CloseWithError(0, "done")
+
+		proto := conn.ConnectionState().TLS.NegotiatedProtocol
+		if proto != "connet" {
+			return proto, nil
+		}
+
+		stream, err := conn.OpenStreamSync(ctx)
+		if err != nil {
+			return proto, err
+		}
+		defer stream.Close()
+
+		if err := pb.Write(stream, &pbs.Authenticate{Token: token}); err != nil {
+			return proto, err
+		}
+		resp := &pbs.AuthenticateResp{}
+		if err := pb.Read(stream, resp); err != nil {
+			return proto, err
+		}
+		if resp.Error != nil {
+			return proto, resp.Error
+		}
+		return proto, nil
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		_, err := connect([]string{"connet"}, "", newClientCert(root, "client.example.com"))
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown identity", func(t *testing.T) {
+		_, err := connect([]string{"connet"}, "", newClientCert(root, "other.example.com"))
+		require.ErrorContains(t, err, "Invalid or unknown token")
+	})
+
+	t.Run("token is not an identity", func(t *testing.T) {
+		_, err := connect([]string{"connet"}, "client-token", newClientCert(root, "client-token"))
+		require.ErrorContains(t, err, "Invalid or unknown token")
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := connect([]string{"connet"}, "client.example.com")
+		require.Error(t, err)
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		otherRoot, err := certc.NewRoot()
+		require.NoError(t, err)
+		_, err = connect([]string{"connet"}, "", newClientCert(otherRoot, "client.example.com"))
+		require.Error(t, err)
+	})
+
+	t.Run("relay protocol", func(t *testing.T) {
+		// relays do not need certificates, but offering their protocol cannot be used to connect as a client
+		proto, err := connect([]string{"connet", "connet-relays"}, "")
+		require.NoError(t, err)
+		require.Equal(t, "connet-relays", proto)
+	})
+}
+
+func TestCheckCertificate(t *testing.T) {
+	now := time.Now()
+	cert := &x509.Certificate{NotAfter: now.Add(time.Hour)}
+
+	require.NoError(t, checkCertificate(cert, now))
+	require.ErrorContains(t, checkCertificate(cert, now.Add(2*time.Hour)), "certificate expired")
+}
+
+func TestClientCertificatesRequireAuthenticator(t *testing.T) {
+	_, err := NewServer(Config{
+		ClientAuth: testClientAuthenticator{},
+		ClientCAs:  x509.NewCertPool(),
+		RelayAuth:  testRelayAuthenticator{},
+	})
+	require.ErrorContains(t, err, "client certificate authenticator")
+}
@@ -10,6 +10,7 @@ import (
 	"net"
 	"slices"
 	"sync"
+	"time"
 
 	"github.com/connet-dev/connet/logc"
 	"github.com/connet-dev/connet/model"
@@ -39,10 +40,13 @@ type ClientRelays interface {
 }
 
 func newClientServer(
+	epoch int64,
 	auth ClientAuthenticator,
+	certAuth ClientCertAuthenticator,
 	relays ClientRelays,
 	config logc.KV[ConfigKey, ConfigValue],
 	stores Stores,
+	audit *auditLog,
 	logger *slog.Logger,
 ) (*clientServer, error) {
 	conns, err := stores.ClientConns()
@@ -55,6 +59,11 @@ func newClientServer(
 		return nil, err
 	}
 
+	punches, err := stores.ClientPunches()
+	if err != nil {
+		return nil, err
+	}
+
 	clientsMsgs, clientsOffset, err := peers.Snapshot()
 	if err != nil {
 		return nil, err
@@ -82,36 +91,60 @@ func newClientServer(
 	}
 
 	s := &clientServer{
-		auth:   auth,
-		relays: relays,
-		logger: logger.With("server", "clients"),
+		epoch:    epoch,
+		auth:     auth,
+		certAuth: certAuth,
+		relays:   relays,
+		audit:    audit,
+		logger:   logger.With("server", "clients"),
 
 		clientSecretKey: [32]byte(serverSecret.Bytes),
 
-		conns: conns,
-		peers: peers,
+		conns:   conns,
+		peers:   peers,
+		punches: punches,
 
 		peersCache:  peersCache,
 		peersOffset: clientsOffset,
+
+		punchWaiters: map[punchKey][]*punchWaiter{},
 	}
 
 	return s, nil
 }
 
 type clientServer struct {
-	auth   ClientAuthenticator
-	relays ClientRelays
-	encode []byte
-	logger *slog.Logger
+	epoch    int64
+	auth     ClientAuthenticator
+	certAuth ClientCertAuthenticator
+	relays   ClientRelays
+	encode   []byte
+	audit    *auditLog
+	logger   *slog.Logger
 
 	clientSecretKey [32]byte
 
-	conns logc.KV[ClientConnKey, ClientConnValue]
-	peers logc.KV[ClientPeerKey, ClientPeerValue]
+	conns   logc.KV[ClientConnKey, ClientConnValue]
+	peers   logc.KV[ClientPeerKey, ClientPeerValue]
+	punches logc.KV[ClientPunchKey, ClientPunchValue]
 
 	peersCache  map[cacheKey][]*pbs.ServerPeer
 	peersOffset int64
 	peersMu     sync.RWMutex
+
+	punchWaiters   map[punchKey][]*punchWaiter
+	punchWaitersMu sync.Mutex
+}
+
+// authenticateCertificate validates the certificate of a client, which must not have expired since the handshake
+func (s *clientServer) authenticateCertificate(cert *x509.Certificate) (ClientAuthentication, error) {
+	if err := checkCertificate(cert, time.Now()); err != nil {
+		return nil, err
+	}
+	if s.certAuth == nil {
+		return nil, kleverr.New("client certificates are not accepted")
+	}
+	return s.certAuth.AuthenticateCertificate(cert)
 }
 
 func (s *clientServer) connected(id ksuid.KSUID, auth ClientAuthentication, remote net.Addr) error {
@@ -119,7 +152,7 @@ func (s *clientServer) connected(id ksuid.KSUID, auth ClientAuthentication, remo
 	if err != nil {
 		return err
 	}
-	return s.conns.Put(ClientConnKey{id}, ClientConnValue{Authentication: authData, Addr: remote.String()})
+	return s.conns.Put(ClientConnKey{id}, ClientConnValue{Authentication: authData, Addr: remote.String(), Epoch: s.epoch})
 }
 
 func (s *clientServer) disconnected(id ksuid.KSUID) error {
@@ -127,7 +160,7 @@ func (s *clientServer) disconnected(id ksuid.KSUID) error {
 }
 
 func (s *clientServer) announce(fwd model.Forward, role model.Role, id ksuid.KSUID, peer *pbs.ClientPeer) error {
-	return s.peers.Put(ClientPeerKey{fwd, role, id}, ClientPeerValue{peer})
+	return s.peers.Put(ClientPeerKey{fwd, role, id}, ClientPeerValue{Peer: peer, Epoch: s.epoch})
 }
 
 func (s *clientServer) revoke(fwd model.Forward, role model.Role, id ksuid.KSUID) error {
@@ -142,11 +175,10 @@ func (s *clientServer) announcements(fwd model.Forward, role model.Role) ([]*pbs
 }
 
 func (s *clientServer) listen(ctx context.Context, fwd model.Forward, role model.Role, notify func(peers []*pbs.ServerPeer) error) error {
+	// always send the initial list, even if empty, so clients can reconcile their peers after a reconnect
 	peers, offset := s.announcements(fwd, role)
-	if len(peers) > 0 {
-		if err := notify(peers); err != nil {
-			return err
-		}
+	if err := notify(peers); err != nil {
+		return err
 	}
 
 	for {
@@ -250,9 +282,10 @@ func (s *clientServer) run(ctx context.Context) error {
 
 func (s *clientServer) handle(ctx context.Context, conn quic.Connection) {
 	cc := &clientConn{
-		server: s,
-		conn:   conn,
-		logger: s.logger,
+		server:    s,
+		conn:      conn,
+		logger:    s.logger,
+		punchKeys: map[ClientPunchKey]struct{}{},
 	}
 	go cc.run(ctx)
 }
@@ -262,8 +295,13 @@ type clientConn struct {
 	conn   quic.Connection
 	logger *slog.Logger
 
-	auth ClientAuthentication
-	id   ksuid.KSUID
+	auth  ClientAuthentication
+	token string
+	cert  *x509.Certificate
+	id    ksuid.KSUID
+
+	punchKeys   map[ClientPunchKey]struct{}
+	punchKeysMu sync.Mutex
 }
 
 func (c *clientConn) run(ctx context.Context) {
@@ -275,15 +313,17 @@ func (c *clientConn) run(ctx context.Context) {
 }
 
 func (c *clientConn) runErr(ctx context.Context) error {
-	if auth, id, err := c.authenticate(ctx); err != nil {
+	if auth, id, token, err := c.authenticate(ctx); err != nil {
 		if perr := pb.GetError(err); perr != nil {
 			c.conn.CloseWithError(quic.ApplicationErrorCode(perr.Code), perr.Message)
 		} else {
-			c.conn.CloseWithError(quic.ApplicationErrorCode(pb.Error_AuthenticationFailed), "Error while authenticating")
+			c.conn.CloseWithError(quic.ApplicationErrorCode(pb.Error_Unknown), "Error while authenticating")
 		}
 		return kleverr.Ret(err)
 	} else {
 		c.auth = auth
+		c.token = token
+		c.cert = peerCertificate(c.conn)
 		c.id = id
 		c.logger = c.logger.With("client-id", id)
 	}
@@ -292,24 +332,45 @@ func (c *clientConn) runErr(ctx context.Context) error {
 		return err
 	}
 	defer c.server.disconnected(c.id)
+	defer c.clearPunches()
 
-	for {
-		stream, err := c.conn.AcceptStream(ctx)
-		if err != nil {
+	c.record(AuditValue{Event: AuditClientAuthenticated})
+	defer c.record(AuditValue{Event: AuditClientDisconnected})
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	g.Go(func() error {
+		return reauthenticate(ctx, c.conn, func() error {
+			if c.cert != nil {
+				_, err := c.server.authenticateCertificate(c.cert)
+				return err
+			}
+			_, err := c.server.auth.Authenticate(c.token)
 			return err
-		}
+		})
+	})
+
+	g.Go(func() error {
+		for {
+			stream, err := c.conn.AcceptStream(ctx)
+			if err != nil {
+				return err
+			}
 
-		cs := &clientStream{
-			conn:   c,
-			stream: stream,
+			cs := &clientStream{
+				conn:   c,
+				stream: stream,
+			}
+			go cs.run(ctx)
 		}
-		go cs.run(ctx)
-	}
+	})
+
+	return g.Wait()
 }
 
-var retClientAuth = kleverr.Ret2[ClientAuthentication, ksuid.KSUID]
+var retClientAuth = kleverr.Ret3[ClientAuthentication, ksuid.KSUID, string]
 
-func (c *clientConn) authenticate(ctx context.Context) (ClientAuthentication, ksuid.KSUID, error) {
+func (c *clientConn) authenticate(ctx context.Context) (ClientAuthentication, ksuid.KSUID, string, error) {
 	c.logger.Debug("waiting for authentication")
 	authStream, err := c.conn.AcceptStream(ctx)
 	if err != nil {
@@ -322,8 +383,20 @@ func (c *clientConn) authenticate(ctx context.Context) (ClientAuthentication, ks
 		return retClientAuth(err)
 	}
 
-	auth, err := c.server.auth.Authenticate(req.Token)
+	var auth ClientAuthentication
+	if cert := peerCertificate(c.conn); cert != nil {
+		auth, err = c.server.authenticateCertificate(cert)
+	} else {
+		auth, err = c.server.auth.Authenticate(req.Token)
+	}
 	if err != nil {
+		c.server.audit.recordFailure(AuditValue{
+			Event:    AuditClientAuthFailed,
+			Remote:   auditAddr(c.conn.RemoteAddr()),
+			Token:    c.server.audit.fingerprint(req.Token),
+			Identity: auditIdentity(c.conn),
+			Error:    auditErr(err),
+		})
 		err := pb.NewError(pb.Error_AuthenticationFailed, "Invalid or unknown token")
 		if err := pb.Write(authStream, &pbs.AuthenticateResp{Error: err}); err != nil {
 			return retClientAuth(err)
@@ -344,7 +417,8 @@ func (c *clientConn) authenticate(ctx context.Context) (ClientAuthentication, ks
 
 	origin, err := pb.AddrPortFromNet(c.conn.RemoteAddr())
 	if err != nil {
-		err := pb.NewError(pb.Error_AuthenticationFailed, "cannot resolve origin: %v", err)
+		// not the fault of the client, which should retry instead of stopping
+		err := pb.NewError(pb.Error_Unknown, "cannot resolve origin: %v", err)
 		if err := pb.Write(authStream, &pbs.AuthenticateResp{Error: err}); err != nil {
 			return retClientAuth(err)
 		}
@@ -364,7 +438,21 @@ func (c *clientConn) authenticate(ctx context.Context) (ClientAuthentication, ks
 	}
 
 	c.logger.Debug("authentication completed", "local", c.conn.LocalAddr(), "remote", c.conn.RemoteAddr())
-	return auth, id, nil
+	return auth, id, req.Token, nil
+}
+
+// record adds an audit event for this authenticated client
+func (c *clientConn) record(v AuditValue) {
+	v.Remote = auditAddr(c.conn.RemoteAddr())
+	v.Token = c.server.audit.fingerprint(c.token)
+	v.Identity = auditIdentity(c.conn)
+	v.ClientID = c.id.String()
+	c.server.audit.record(v)
+}
+
+// denied records a failed validation of the forward and role
+func (c *clientConn) denied(fwd model.Forward, role model.Role, err error) {
+	c.record(AuditValue{Event: AuditDenied, Forward: fwd.String(), Role: role.String(), Error: auditErr(err)})
 }
 
 func (c *clientConn) encodeReconnect(id []byte) ([]byte, error) {
@@ -415,6 +503,8 @@ func (s *clientStream) runErr(ctx context.Context) error {
 		return s.announce(ctx, req.Announce)
 	case req.Relay != nil:
 		return s.relay(ctx, req.Relay)
+	case req.Punch != nil:
+		return s.punch(ctx, req.Punch)
 	default:
 		return s.unknown(ctx, req)
 	}
@@ -437,6 +527,7 @@ func (s *clientStream) announce(ctx context.Context, req *pbs.Request_Announce)
 	fwd := model.ForwardFromPB(req.Forward)
 	role := model.RoleFromPB(req.Role)
 	if newFwd, err := s.conn.auth.Validate(fwd, role); err != nil {
+		s.conn.denied(fwd, role, err)
 		err := pb.NewError(pb.Error_AnnounceValidationFailed, "failed to validte desination '%s': %v", fwd, err)
 		if err := pb.Write(s.stream, &pbs.Response{Error: err}); err != nil {
 			return kleverr.Newf("could not write error response: %w", err)
@@ -458,6 +549,9 @@ func (s *clientStream) announce(ctx context.Context, req *pbs.Request_Announce)
 	}
 	defer s.conn.server.revoke(fwd, role, s.conn.id)
 
+	s.conn.record(AuditValue{Event: AuditAnnounce, Forward: fwd.String(), Role: role.String()})
+	defer s.conn.record(AuditValue{Event: AuditRevoke, Forward: fwd.String(), Role: role.String()})
+
 	g, ctx := errgroup.WithContext(ctx)
 
 	g.Go(func() error {
@@ -511,6 +605,7 @@ func (s *clientStream) relay(ctx context.Context, req *pbs.Request_Relay) error
 	fwd := model.ForwardFromPB(req.Forward)
 	role := model.RoleFromPB(req.Role)
 	if newFwd, err := s.conn.auth.Validate(fwd, role); err != nil {
+		s.conn.denied(fwd, role, err)
 		err := pb.NewError(pb.Error_RelayValidationFailed, "failed to validate desination '%s': %v", fwd, err)
 		if err := pb.Write(s.stream, &pbs.Response{Error: err}); err != nil {
 			return kleverr.Newf("could not write error response: %w", err)
@@ -0,0 +1,92 @@
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/connet-dev/connet/logc"
+)
+
+// how long after startup entries of previous epochs can be claimed again, before they are removed as stale
+const staleEntriesTimeout = time.Minute
+
+// nextEpoch increments the boot epoch of the server, which is stored in the config
+func nextEpoch(config logc.KV[ConfigKey, ConfigValue]) (int64, error) {
+	prev, err := config.GetOrDefault(configServerEpoch, ConfigValue{})
+	if err != nil {
+		return 0, err
+	}
+	epoch := prev.Int64 + 1
+	if err := config.Put(configServerEpoch, ConfigValue{Int64: epoch}); err != nil {
+		return 0, err
+	}
+	return epoch, nil
+}
+
+// expireEpoch deletes the entries of kv stored before epoch, returning how many. Reconnecting clients and relays
+// claim their entries again by storing them with the current epoch, so these are kept.
+func expireEpoch[K comparable, V any](kv logc.KV[K, V], epoch int64, valueEpoch func(V) int64) (int, error) {
+	msgs, _, err := kv.Snapshot()
+	if err != nil {
+		return 0, err
+	}
+
+	var n int
+	for _, msg := range msgs {
+		if valueEpoch(msg.Value) >= epoch {
+			continue
+		}
+		// only if still stale, the entry might have been claimed since the snapshot
+		deleted, err := kv.DelIf(msg.Key, func(current V) bool { return valueEpoch(current) < epoch })
+		switch {
+		case err != nil:
+			return n, err
+		case !deleted:
+			continue
+		}
+		n++
+	}
+	return n, nil
+}
+
+// runStaleCleanup waits for clients and relays of previous epochs to reconnect, and then removes their leftovers
+func (s *Server) runStaleCleanup(ctx context.Context) error {
+	t := time.NewTimer(staleEntriesTimeout)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+	}
+
+	clientConns, err := expireEpoch(s.clients.conns, s.epoch, func(v ClientConnValue) int64 { return v.Epoch })
+	if err != nil {
+		return err
+	}
+	clientPeers, err := expireEpoch(s.clients.peers, s.epoch, func(v ClientPeerValue) int64 { return v.Epoch })
+	if err != nil {
+		return err
+	}
+	clientPunches, err := expireEpoch(s.clients.punches, s.epoch, func(v ClientPunchValue) int64 { return v.Epoch })
+	if err != nil {
+		return err
+	}
+	relayConns, err := expireEpoch(s.relays.conns, s.epoch, func(v RelayConnValue) int64 { return v.Epoch })
+	if err != nil {
+		return err
+	}
+	relayClients, err := expireEpoch(s.relays.clients, s.epoch, func(v RelayClientValue) int64 { return v.Epoch })
+	if err != nil {
+		return err
+	}
+	relayServers, err := expireEpoch(s.relays.servers, s.epoch, func(v RelayServerValue) int64 { return v.Epoch })
+	if err != nil {
+		return err
+	}
+
+	s.logger.Info("cleaned up stale entries of previous epochs", "epoch", s.epoch,
+		"client-conns", clientConns, "client-peers", clientPeers, "client-punches", clientPunches,
+		"relay-conns", relayConns, "relay-clients", relayClients, "relay-servers", relayServers)
+	return nil
+}
@@ -0,0 +1,73 @@
+package control
+
+import (
+	"testing"
+
+	"github.com/connet-dev/connet/logc"
+	"github.com/segmentio/ksuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEpochStaleEntries(t *testing.T) {
+	stores := NewFileStores(t.TempDir())
+	config, err := stores.Config()
+	require.NoError(t, err)
+
+	epoch, err := nextEpoch(config)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), epoch)
+	epoch, err = nextEpoch(config)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), epoch)
+
+	conns, err := stores.ClientConns()
+	require.NoError(t, err)
+	reclaimed, stale := ClientConnKey{ksuid.New()}, ClientConnKey{ksuid.New()}
+	require.NoError(t, conns.Put(reclaimed, ClientConnValue{Addr: "127.0.0.1:1", Epoch: epoch - 1}))
+	require.NoError(t, conns.Put(stale, ClientConnValue{Addr: "127.0.0.1:2", Epoch: epoch - 1}))
+	// the client reconnects after the restart
+	require.NoError(t, conns.Put(reclaimed, ClientConnValue{Addr: "127.0.0.1:1", Epoch: epoch}))
+
+	n, err := expireEpoch(conns, epoch, func(v ClientConnValue) int64 { return v.Epoch })
+	require.NoError(t, err)
+	require.Equal(t, 1, n)
+
+	msgs, _, err := conns.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+	require.Equal(t, reclaimed, msgs[0].Key)
+}
+
+// claimAfterSnapshot stores claim right after a snapshot is taken, like a client reconnecting during a cleanup
+type claimAfterSnapshot struct {
+	logc.KV[ClientConnKey, ClientConnValue]
+	claim func() error
+}
+
+func (c claimAfterSnapshot) Snapshot() ([]logc.Message[ClientConnKey, ClientConnValue], int64, error) {
+	msgs, offset, err := c.KV.Snapshot()
+	if err != nil {
+		return nil, 0, err
+	}
+	return msgs, offset, c.claim()
+}
+
+func TestEpochClaimedDuringCleanup(t *testing.T) {
+	stores := NewFileStores(t.TempDir())
+	conns, err := stores.ClientConns()
+	require.NoError(t, err)
+
+	key := ClientConnKey{ksuid.New()}
+	require.NoError(t, conns.Put(key, ClientConnValue{Addr: "127.0.0.1:1", Epoch: 1}))
+
+	kv := claimAfterSnapshot{conns, func() error {
+		return conns.Put(key, ClientConnValue{Addr: "127.0.0.1:1", Epoch: 2})
+	}}
+	n, err := expireEpoch(kv, 2, func(v ClientConnValue) int64 { return v.Epoch })
+	require.NoError(t, err)
+	require.Equal(t, 0, n)
+
+	value, err := conns.Get(key)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), value.Epoch)
+}
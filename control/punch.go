@@ -0,0 +1,206 @@
+package control
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/pbs"
+	"github.com/klev-dev/kleverr"
+	"github.com/segmentio/ksuid"
+)
+
+const (
+	// how long to wait for the other peer to request the same punch
+	punchTimeout = 5 * time.Second
+	// how far in the future both peers should start sending
+	punchDelay = 100 * time.Millisecond
+)
+
+type punchKey struct {
+	forward     model.Forward
+	source      ksuid.KSUID
+	destination ksuid.KSUID
+}
+
+type punchWaiter struct {
+	role   model.Role
+	public *pb.AddrPort
+	ch     chan *pb.AddrPort
+}
+
+// punchWait blocks until the other side of key requests the same punch, returning its public address.
+// Each peer may wait more than once at the same time (e.g. while both dialing and accepting), so the
+// request is matched with any waiter of the other role. When nobody shows up in time, it returns false.
+func (s *clientServer) punchWait(ctx context.Context, key punchKey, role model.Role, public *pb.AddrPort) (*pb.AddrPort, bool) {
+	s.punchWaitersMu.Lock()
+	waiters := s.punchWaiters[key]
+	if idx := slices.IndexFunc(waiters, func(w *punchWaiter) bool { return w.role != role }); idx >= 0 {
+		w := waiters[idx]
+		s.removePunchWaiter(key, w)
+		s.punchWaitersMu.Unlock()
+
+		w.ch <- public
+		return w.public, true
+	}
+
+	w := &punchWaiter{role: role, public: public, ch: make(chan *pb.AddrPort, 1)}
+	s.punchWaiters[key] = append(waiters, w)
+	s.punchWaitersMu.Unlock()
+
+	defer func() {
+		s.punchWaitersMu.Lock()
+		defer s.punchWaitersMu.Unlock()
+
+		s.removePunchWaiter(key, w)
+	}()
+
+	select {
+	case remote := <-w.ch:
+		return remote, true
+	case <-time.After(punchTimeout):
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// removePunchWaiter must be called with punchWaitersMu held
+func (s *clientServer) removePunchWaiter(key punchKey, w *punchWaiter) {
+	waiters := slices.DeleteFunc(s.punchWaiters[key], func(o *punchWaiter) bool { return o == w })
+	if len(waiters) == 0 {
+		delete(s.punchWaiters, key)
+	} else {
+		s.punchWaiters[key] = waiters
+	}
+}
+
+func (s *clientServer) punched(key ClientPunchKey, matched bool, result *pbs.Request_PunchResult) error {
+	value, err := s.punches.GetOrDefault(key, ClientPunchValue{})
+	if err != nil {
+		return err
+	}
+
+	value.Attempts++
+	if matched {
+		value.Matched++
+	}
+	if result.Success {
+		value.Successes++
+	}
+
+	value.LastSuccess = result.Success
+	value.LastAddr = ""
+	if result.Addr != nil {
+		value.LastAddr = result.Addr.AsNetip().String()
+	}
+	value.LastError = result.Error
+	value.LastTime = time.Now()
+	value.Epoch = s.epoch
+
+	return s.punches.Put(key, value)
+}
+
+// punched records the result of a punch by this client, which is removed once it disconnects
+func (c *clientConn) punched(fwd model.Forward, peerID ksuid.KSUID, matched bool, result *pbs.Request_PunchResult) error {
+	key := ClientPunchKey{Forward: fwd, ID: c.id, PeerID: peerID}
+
+	c.punchKeysMu.Lock()
+	defer c.punchKeysMu.Unlock()
+
+	if c.punchKeys == nil {
+		// the client already disconnected
+		return nil
+	}
+	c.punchKeys[key] = struct{}{}
+	return c.server.punched(key, matched, result)
+}
+
+// clearPunches removes the punch results recorded by this client
+func (c *clientConn) clearPunches() error {
+	c.punchKeysMu.Lock()
+	defer c.punchKeysMu.Unlock()
+
+	for key := range c.punchKeys {
+		if err := c.server.punches.Del(key); err != nil {
+			return err
+		}
+		delete(c.punchKeys, key)
+	}
+	c.punchKeys = nil
+	return nil
+}
+
+func (s *clientStream) punch(ctx context.Context, req *pbs.Request_Punch) error {
+	fwd := model.ForwardFromPB(req.Forward)
+	role := model.RoleFromPB(req.Role)
+	if newFwd, err := s.conn.auth.Validate(fwd, role); err != nil {
+		s.conn.denied(fwd, role, err)
+		err := pb.NewError(pb.Error_PunchValidationFailed, "failed to validate %s '%s': %v", role, fwd, err)
+		if err := pb.Write(s.stream, &pbs.Response{Error: err}); err != nil {
+			return kleverr.Newf("could not write error response: %w", err)
+		}
+		return err
+	} else {
+		fwd = newFwd
+	}
+
+	peerID, err := ksuid.Parse(req.PeerId)
+	if err != nil {
+		err := pb.NewError(pb.Error_PunchInvalidPeer, "invalid peer '%s': %v", req.PeerId, err)
+		if err := pb.Write(s.stream, &pbs.Response{Error: err}); err != nil {
+			return kleverr.Newf("could not write error response: %w", err)
+		}
+		return err
+	}
+
+	public, err := pb.AddrPortFromNet(s.conn.conn.RemoteAddr())
+	if err != nil {
+		return kleverr.Newf("cannot resolve public address: %w", err)
+	}
+
+	// acknowledge, so the peer can estimate how long our next message takes to reach it
+	if err := pb.Write(s.stream, &pbs.Response{Punch: &pbs.Response_Punch{}}); err != nil {
+		return kleverr.Ret(err)
+	}
+
+	var key punchKey
+	switch role {
+	case model.Source:
+		key = punchKey{forward: fwd, source: s.conn.id, destination: peerID}
+	default:
+		key = punchKey{forward: fwd, source: peerID, destination: s.conn.id}
+	}
+
+	remotePublic, matched := s.conn.server.punchWait(ctx, key, role, public)
+	resp := &pbs.Response_Punch{
+		Ready:        true,
+		Matched:      matched,
+		RemotePublic: remotePublic,
+	}
+	if matched {
+		resp.DelayMs = punchDelay.Milliseconds()
+	}
+	s.conn.logger.Debug("punch ready", "forward", fwd, "role", role, "peer", peerID, "matched", matched)
+	if err := pb.Write(s.stream, &pbs.Response{Punch: resp}); err != nil {
+		return kleverr.Ret(err)
+	}
+
+	resultReq, err := pbs.ReadRequest(s.stream)
+	if err != nil {
+		return err
+	}
+	if resultReq.PunchResult == nil {
+		respErr := pb.NewError(pb.Error_RequestUnknown, "unexpected request")
+		if err := pb.Write(s.stream, &pbs.Response{Error: respErr}); err != nil {
+			return kleverr.Ret(err)
+		}
+		return respErr
+	}
+
+	s.conn.logger.Debug("punch completed", "forward", fwd, "role", role, "peer", peerID,
+		"success", resultReq.PunchResult.Success, "err", resultReq.PunchResult.Error)
+	return s.conn.punched(fwd, peerID, matched, resultReq.PunchResult)
+}
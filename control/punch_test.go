@@ -0,0 +1,93 @@
+package control
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/pbs"
+	"github.com/segmentio/ksuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPunchesCleared(t *testing.T) {
+	stores := NewFileStores(t.TempDir())
+	config, err := stores.Config()
+	require.NoError(t, err)
+
+	s, err := newClientServer(1, nil, nil, nil, config, stores, nil, slog.Default())
+	require.NoError(t, err)
+
+	c := &clientConn{server: s, id: ksuid.New(), punchKeys: map[ClientPunchKey]struct{}{}}
+	fwd := model.NewForward("punch")
+	peerID := ksuid.New()
+
+	require.NoError(t, c.punched(fwd, peerID, true, &pbs.Request_PunchResult{Success: true}))
+	require.NoError(t, c.punched(fwd, peerID, false, &pbs.Request_PunchResult{Error: "timeout"}))
+
+	value, err := s.punches.Get(ClientPunchKey{Forward: fwd, ID: c.id, PeerID: peerID})
+	require.NoError(t, err)
+	require.Equal(t, int64(2), value.Attempts)
+	require.Equal(t, int64(1), value.Successes)
+
+	require.NoError(t, c.clearPunches())
+	// results arriving after the client disconnected are not recorded
+	require.NoError(t, c.punched(fwd, peerID, true, &pbs.Request_PunchResult{Success: true}))
+
+	msgs, _, err := s.punches.Snapshot()
+	require.NoError(t, err)
+	require.Empty(t, msgs)
+}
+
+func TestPunchWaitSameRoleTwice(t *testing.T) {
+	stores := NewFileStores(t.TempDir())
+	config, err := stores.Config()
+	require.NoError(t, err)
+
+	s, err := newClientServer(1, nil, nil, nil, config, stores, nil, slog.Default())
+	require.NoError(t, err)
+
+	key := punchKey{forward: model.NewForward("punch"), source: ksuid.New(), destination: ksuid.New()}
+	srcPublic := &pb.AddrPort{Addr: &pb.Addr{V4: []byte{10, 0, 0, 1}}, Port: 1000}
+	dstPublic := &pb.AddrPort{Addr: &pb.Addr{V4: []byte{10, 0, 0, 2}}, Port: 2000}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// the destination both dials and accepts, the source only dials
+	type result struct {
+		public  *pb.AddrPort
+		matched bool
+	}
+	results := make(chan result, 2)
+	for range 2 {
+		go func() {
+			public, matched := s.punchWait(ctx, key, model.Destination, dstPublic)
+			results <- result{public, matched}
+		}()
+	}
+	require.Eventually(t, func() bool {
+		s.punchWaitersMu.Lock()
+		defer s.punchWaitersMu.Unlock()
+		return len(s.punchWaiters[key]) == 2
+	}, time.Second, time.Millisecond)
+
+	public, matched := s.punchWait(ctx, key, model.Source, srcPublic)
+	require.True(t, matched)
+	require.Equal(t, dstPublic, public)
+
+	r := <-results
+	require.True(t, r.matched)
+	require.Equal(t, srcPublic, r.public)
+
+	cancel()
+	r = <-results
+	require.False(t, r.matched)
+
+	s.punchWaitersMu.Lock()
+	defer s.punchWaitersMu.Unlock()
+	require.Empty(t, s.punchWaiters)
+}
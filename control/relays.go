@@ -10,6 +10,7 @@ import (
 	"log/slog"
 	"maps"
 	"sync"
+	"time"
 
 	"github.com/connet-dev/connet/certc"
 	"github.com/connet-dev/connet/logc"
@@ -34,9 +35,13 @@ type RelayAuthentication interface {
 }
 
 func newRelayServer(
+	epoch int64,
 	auth RelayAuthenticator,
+	certAuth RelayCertAuthenticator,
 	config logc.KV[ConfigKey, ConfigValue],
 	stores Stores,
+	clientsRetention time.Duration,
+	audit *auditLog,
 	logger *slog.Logger,
 ) (*relayServer, error) {
 	conns, err := stores.RelayConns()
@@ -74,6 +79,11 @@ func newRelayServer(
 		srv[msg.Key.RelayID] = relayCacheValue{Hostport: msg.Value.Hostport, Cert: msg.Value.Cert}
 	}
 
+	clientsCompacted, err := config.GetOrDefault(configRelayClientsCompacted, ConfigValue{})
+	if err != nil {
+		return nil, err
+	}
+
 	serverIDConfig, err := config.GetOrInit(configServerID, func(ck ConfigKey) (ConfigValue, error) {
 		return ConfigValue{String: model.GenServerName("connet")}, nil
 	})
@@ -93,12 +103,16 @@ func newRelayServer(
 	}
 
 	return &relayServer{
-		id:     serverIDConfig.String,
-		auth:   auth,
-		logger: logger.With("server", "relays"),
+		epoch:    epoch,
+		id:       serverIDConfig.String,
+		auth:     auth,
+		certAuth: certAuth,
+		audit:    audit,
+		logger:   logger.With("server", "relays"),
 
 		relaySecretKey: [32]byte(serverSecret.Bytes),
 
+		config:        config,
 		stores:        stores,
 		conns:         conns,
 		clients:       clients,
@@ -107,16 +121,23 @@ func newRelayServer(
 
 		forwardsCache:  forwardsCache,
 		forwardsOffset: forwardsOffset,
+
+		clientsRetention: clientsRetention,
+		clientsCompacted: clientsCompacted.Int64,
 	}, nil
 }
 
 type relayServer struct {
-	id     string
-	auth   RelayAuthenticator
-	logger *slog.Logger
+	epoch    int64
+	id       string
+	auth     RelayAuthenticator
+	certAuth RelayCertAuthenticator
+	audit    *auditLog
+	logger   *slog.Logger
 
 	relaySecretKey [32]byte
 
+	config        logc.KV[ConfigKey, ConfigValue]
 	stores        Stores
 	conns         logc.KV[RelayConnKey, RelayConnValue]
 	clients       logc.KV[RelayClientKey, RelayClientValue]
@@ -126,6 +147,10 @@ type relayServer struct {
 	forwardsCache  map[model.Forward]map[ksuid.KSUID]relayCacheValue
 	forwardsOffset int64
 	forwardsMu     sync.RWMutex
+
+	clientsRetention   time.Duration
+	clientsCompacted   int64 // relays behind this offset might have missed changes
+	clientsCompactedMu sync.RWMutex
 }
 
 func (s *relayServer) getForward(fwd model.Forward) (map[ksuid.KSUID]relayCacheValue, int64) {
@@ -139,7 +164,7 @@ func (s *relayServer) Client(ctx context.Context, fwd model.Forward, role model.
 	notifyFn func(map[ksuid.KSUID]relayCacheValue) error) error {
 
 	key := RelayClientKey{Forward: fwd, Role: role, Key: certc.NewKey(cert)}
-	val := RelayClientValue{Cert: cert}
+	val := RelayClientValue{Cert: cert, Epoch: s.epoch}
 	s.clients.Put(key, val)
 	defer s.clients.Del(key)
 
@@ -234,6 +259,47 @@ func (s *relayServer) run(ctx context.Context) error {
 	}
 }
 
+func (s *relayServer) getClientsCompacted() int64 {
+	s.clientsCompactedMu.RLock()
+	defer s.clientsCompactedMu.RUnlock()
+
+	return s.clientsCompacted
+}
+
+// runCompactClients periodically removes relay client changes older than the retention. Relays which
+// were offline for longer than that, get a full snapshot when they reconnect.
+func (s *relayServer) runCompactClients(ctx context.Context) error {
+	t := time.NewTicker(s.clientsRetention)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		compacted, err := s.clients.Compact(ctx, time.Now().Add(-s.clientsRetention))
+		if err != nil {
+			return err
+		}
+		if compacted == logc.OffsetInvalid {
+			continue
+		}
+
+		s.clientsCompactedMu.Lock()
+		s.clientsCompacted = max(s.clientsCompacted, compacted)
+		compacted = s.clientsCompacted
+		s.clientsCompactedMu.Unlock()
+
+		// persist the same offset, so it does not go backwards after a restart
+		if err := s.config.Put(configRelayClientsCompacted, ConfigValue{Int64: compacted}); err != nil {
+			return err
+		}
+		s.logger.Debug("compacted relay clients", "offset", compacted)
+	}
+}
+
 func (s *relayServer) handle(ctx context.Context, conn quic.Connection) {
 	rc := &relayConn{
 		server: s,
@@ -267,9 +333,22 @@ type relayConn struct {
 	forwards logc.KV[RelayForwardKey, RelayForwardValue]
 	id       ksuid.KSUID
 	auth     RelayAuthentication
+	token    string
+	cert     *x509.Certificate
 	hostport model.HostPort
 }
 
+// authenticateCertificate validates the certificate of a relay, which must not have expired since the handshake
+func (s *relayServer) authenticateCertificate(cert *x509.Certificate) (RelayAuthentication, error) {
+	if err := checkCertificate(cert, time.Now()); err != nil {
+		return nil, err
+	}
+	if s.certAuth == nil {
+		return nil, kleverr.New("relay certificates are not accepted")
+	}
+	return s.certAuth.AuthenticateCertificate(cert)
+}
+
 func (c *relayConn) run(ctx context.Context) {
 	defer c.conn.CloseWithError(0, "done")
 
@@ -279,7 +358,7 @@ func (c *relayConn) run(ctx context.Context) {
 }
 
 func (c *relayConn) runErr(ctx context.Context) error {
-	if auth, id, hp, err := c.authenticate(ctx); err != nil {
+	if auth, id, req, err := c.authenticate(ctx); err != nil {
 		if perr := pb.GetError(err); perr != nil {
 			c.conn.CloseWithError(quic.ApplicationErrorCode(perr.Code), perr.Message)
 		} else {
@@ -289,8 +368,10 @@ func (c *relayConn) runErr(ctx context.Context) error {
 	} else {
 		c.id = id
 		c.auth = auth
-		c.hostport = hp
-		c.logger = c.logger.With("relay", hp)
+		c.token = req.Token
+		c.cert = peerCertificate(c.conn)
+		c.hostport = model.HostPortFromPB(req.Addr)
+		c.logger = c.logger.With("relay", c.hostport)
 	}
 
 	forwards, err := c.server.stores.RelayForwards(c.id)
@@ -305,14 +386,27 @@ func (c *relayConn) runErr(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
-	value := RelayConnValue{Authentication: authData, Hostport: c.hostport}
+	value := RelayConnValue{Authentication: authData, Hostport: c.hostport, Epoch: c.server.epoch}
 	if err := c.server.conns.Put(key, value); err != nil {
 		return err
 	}
 	defer c.server.conns.Del(key)
 
+	c.record(AuditValue{Event: AuditRelayConnected})
+	defer c.record(AuditValue{Event: AuditRelayDisconnected})
+
 	g, ctx := errgroup.WithContext(ctx)
 
+	g.Go(func() error {
+		return reauthenticate(ctx, c.conn, func() error {
+			if c.cert != nil {
+				_, err := c.server.authenticateCertificate(c.cert)
+				return err
+			}
+			_, err := c.server.auth.Authenticate(c.token)
+			return err
+		})
+	})
 	g.Go(func() error { return c.runRelayClients(ctx) })
 	g.Go(func() error { return c.runRelayForwards(ctx) })
 	g.Go(func() error { return c.runRelayServers(ctx) })
@@ -320,9 +414,9 @@ func (c *relayConn) runErr(ctx context.Context) error {
 	return g.Wait()
 }
 
-var retRelayAuth = kleverr.Ret3[RelayAuthentication, ksuid.KSUID, model.HostPort]
+var retRelayAuth = kleverr.Ret3[RelayAuthentication, ksuid.KSUID, *pbr.AuthenticateReq]
 
-func (c *relayConn) authenticate(ctx context.Context) (RelayAuthentication, ksuid.KSUID, model.HostPort, error) {
+func (c *relayConn) authenticate(ctx context.Context) (RelayAuthentication, ksuid.KSUID, *pbr.AuthenticateReq, error) {
 	c.logger.Debug("waiting for authentication")
 	authStream, err := c.conn.AcceptStream(ctx)
 	if err != nil {
@@ -335,8 +429,20 @@ func (c *relayConn) authenticate(ctx context.Context) (RelayAuthentication, ksui
 		return retRelayAuth(err)
 	}
 
-	auth, err := c.server.auth.Authenticate(req.Token)
+	var auth RelayAuthentication
+	if cert := peerCertificate(c.conn); cert != nil {
+		auth, err = c.server.authenticateCertificate(cert)
+	} else {
+		auth, err = c.server.auth.Authenticate(req.Token)
+	}
 	if err != nil {
+		c.server.audit.recordFailure(AuditValue{
+			Event:    AuditRelayAuthFailed,
+			Remote:   auditAddr(c.conn.RemoteAddr()),
+			Token:    c.server.audit.fingerprint(req.Token),
+			Identity: auditIdentity(c.conn),
+			Error:    auditErr(err),
+		})
 		err := pb.NewError(pb.Error_AuthenticationFailed, "Invalid or unknown token")
 		if err := pb.Write(authStream, &pbr.AuthenticateResp{Error: err}); err != nil {
 			return retRelayAuth(err)
@@ -368,7 +474,16 @@ func (c *relayConn) authenticate(ctx context.Context) (RelayAuthentication, ksui
 	}
 
 	c.logger.Debug("authentication completed", "local", c.conn.LocalAddr(), "remote", c.conn.RemoteAddr())
-	return auth, id, model.HostPortFromPB(req.Addr), nil
+	return auth, id, req, nil
+}
+
+// record adds an audit event for this authenticated relay
+func (c *relayConn) record(v AuditValue) {
+	v.Remote = auditAddr(c.conn.RemoteAddr())
+	v.Token = c.server.audit.fingerprint(c.token)
+	v.Identity = auditIdentity(c.conn)
+	v.RelayID = c.id.String()
+	c.server.audit.record(v)
 }
 
 func (c *relayConn) encodeReconnect(id []byte) ([]byte, error) {
@@ -408,24 +523,12 @@ func (c *relayConn) runRelayClients(ctx context.Context) error {
 			return err
 		}
 
-		var msgs []logc.Message[RelayClientKey, RelayClientValue]
-		var nextOffset int64
-		if req.Offset == logc.OffsetOldest {
-			msgs, nextOffset, err = c.server.clients.Snapshot()
-			c.logger.Debug("sending initial relay changes", "offset", nextOffset, "changes", len(msgs))
-		} else {
-			msgs, nextOffset, err = c.server.clients.Consume(ctx, req.Offset)
-			c.logger.Debug("sending delta relay changes", "offset", nextOffset, "changes", len(msgs))
-		}
+		msgs, nextOffset, restart, err := c.relayClientChanges(ctx, req.Offset)
 		if err != nil {
 			return err
 		}
 
-		// if len(msgs) == 0 && offset >= 0 && offset < nextOffset {
-		// TODO we are too far off and potentially have missed messages
-		// }
-
-		resp := &pbr.ClientsResp{Offset: nextOffset}
+		resp := &pbr.ClientsResp{Offset: nextOffset, Restart: restart}
 
 		for _, msg := range msgs {
 			if !c.auth.Allow(msg.Key.Forward) {
@@ -454,6 +557,31 @@ func (c *relayConn) runRelayClients(ctx context.Context) error {
 	}
 }
 
+// relayClientChanges returns the changes after offset, or a full snapshot (with restart set) for a new relay
+// or when changes after offset might have been compacted away
+func (c *relayConn) relayClientChanges(ctx context.Context, offset int64) ([]logc.Message[RelayClientKey, RelayClientValue], int64, bool, error) {
+	if offset == logc.OffsetOldest {
+		msgs, nextOffset, err := c.server.clients.Snapshot()
+		c.logger.Debug("sending initial relay changes", "offset", nextOffset, "changes", len(msgs))
+		return msgs, nextOffset, false, err
+	}
+
+	if offset >= c.server.getClientsCompacted() {
+		msgs, nextOffset, err := c.server.clients.Consume(ctx, offset)
+		switch {
+		case err == nil:
+			c.logger.Debug("sending delta relay changes", "offset", nextOffset, "changes", len(msgs))
+			return msgs, nextOffset, false, nil
+		case !errors.Is(err, logc.ErrInvalidOffset):
+			return nil, logc.OffsetInvalid, false, err
+		}
+	}
+
+	msgs, nextOffset, err := c.server.clients.Snapshot()
+	c.logger.Debug("relay too far behind, sending restart relay changes", "from", offset, "offset", nextOffset, "changes", len(msgs))
+	return msgs, nextOffset, true, err
+}
+
 func (c *relayConn) runRelayServers(ctx context.Context) error {
 	stream, err := c.conn.OpenStreamSync(ctx)
 	if err != nil {
@@ -479,6 +607,16 @@ func (c *relayConn) runRelayServers(ctx context.Context) error {
 			return err
 		}
 
+		if resp.Restart {
+			if err := c.restartRelayServers(resp); err != nil {
+				return err
+			}
+			if err := c.server.setRelayServerOffset(c.id, resp.Offset); err != nil {
+				return err
+			}
+			continue
+		}
+
 		for _, change := range resp.Changes {
 			key := RelayForwardKey{Forward: model.ForwardFromPB(change.Forward)}
 
@@ -507,6 +645,22 @@ func (c *relayConn) runRelayServers(ctx context.Context) error {
 	}
 }
 
+// restartRelayServers replaces all forwards of the relay with the ones in the snapshot
+func (c *relayConn) restartRelayServers(resp *pbr.ServersResp) error {
+	values := map[RelayForwardKey]RelayForwardValue{}
+	for _, change := range resp.Changes {
+		if change.Change != pbr.ChangeType_ChangePut {
+			continue
+		}
+		cert, err := x509.ParseCertificate(change.ServerCertificate)
+		if err != nil {
+			return err
+		}
+		values[RelayForwardKey{Forward: model.ForwardFromPB(change.Forward)}] = RelayForwardValue{Cert: cert}
+	}
+	return c.forwards.Replace(values)
+}
+
 func (c *relayConn) runRelayForwards(ctx context.Context) error {
 	initialMsgs, offset, err := c.forwards.Snapshot()
 	if err != nil {
@@ -515,7 +669,7 @@ func (c *relayConn) runRelayForwards(ctx context.Context) error {
 
 	for _, msg := range initialMsgs {
 		key := RelayServerKey{Forward: msg.Key.Forward, RelayID: c.id}
-		value := RelayServerValue{Hostport: c.hostport, Cert: msg.Value.Cert}
+		value := RelayServerValue{Hostport: c.hostport, Cert: msg.Value.Cert, Epoch: c.server.epoch}
 		if err := c.server.servers.Put(key, value); err != nil {
 			return err
 		}
@@ -549,7 +703,7 @@ func (c *relayConn) runRelayForwards(ctx context.Context) error {
 					return err
 				}
 			} else {
-				value := RelayServerValue{Hostport: c.hostport, Cert: msg.Value.Cert}
+				value := RelayServerValue{Hostport: c.hostport, Cert: msg.Value.Cert, Epoch: c.server.epoch}
 				if err := c.server.servers.Put(key, value); err != nil {
 					return err
 				}
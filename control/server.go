@@ -3,10 +3,14 @@ package control
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"log/slog"
 	"net"
 	"time"
 
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/quicc"
+	"github.com/connet-dev/connet/statusc"
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
@@ -15,34 +19,97 @@ import (
 type Config struct {
 	Addr       *net.UDPAddr
 	Cert       tls.Certificate
+	CertSource CertificateSource
 	ClientAuth ClientAuthenticator
 	RelayAuth  RelayAuthenticator
 	Stores     Stores
 	Logger     *slog.Logger
+
+	// RelayClientsRetention is how long relays can be offline and still catch up on changes, instead of
+	// getting a full snapshot of the relay clients. Defaults to a day.
+	RelayClientsRetention time.Duration
+
+	// ClientCAs optionally requires clients to present a certificate signed by one of them, which is then
+	// validated by ClientCertAuth instead of validating the client token with ClientAuth
+	ClientCAs      *x509.CertPool
+	ClientCertAuth ClientCertAuthenticator
+	// RelayCAs and RelayCertAuth are the same as ClientCAs and ClientCertAuth, for relays
+	RelayCAs      *x509.CertPool
+	RelayCertAuth RelayCertAuthenticator
+
+	// AuditSyslog is an optional path to a local syslog socket (e.g. /dev/log) to forward audit events to
+	AuditSyslog string
+
+	// QUIC tunes the connections of clients and relays, and the udp socket
+	QUIC quicc.Config
+
+	// StatusAddr optionally serves the server Status as json on GET /status, at a tcp address or a unix socket
+	// (as unix:<path>). It lists clients and relays, so it should only be reachable by operators.
+	StatusAddr string
+}
+
+// CertificateSource provides the certificate for new handshakes, used instead of Config.Cert when set.
+// If it also has a Run method (e.g. to renew the certificate), it is run with the server.
+type CertificateSource interface {
+	GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error)
 }
 
 func NewServer(cfg Config) (*Server, error) {
+	if cfg.ClientCAs != nil && cfg.ClientCertAuth == nil {
+		return nil, kleverr.New("client CAs require a client certificate authenticator")
+	}
+	if cfg.RelayCAs != nil && cfg.RelayCertAuth == nil {
+		return nil, kleverr.New("relay CAs require a relay certificate authenticator")
+	}
+
 	config, err := cfg.Stores.Config()
 	if err != nil {
 		return nil, err
 	}
 
+	epoch, err := nextEpoch(config)
+	if err != nil {
+		return nil, err
+	}
+
 	s := &Server{
-		addr: cfg.Addr,
+		addr:  cfg.Addr,
+		epoch: epoch,
 		tlsConf: &tls.Config{
-			Certificates: []tls.Certificate{cfg.Cert},
-			NextProtos:   []string{"connet", "connet-relays"},
+			NextProtos: []string{"connet", "connet-relays"},
 		},
-		logger: cfg.Logger.With("control", cfg.Addr),
+		certSource: cfg.CertSource,
+		statusAddr: cfg.StatusAddr,
+		quicConf:   cfg.QUIC,
+		logger:     cfg.Logger.With("control", cfg.Addr),
+	}
+	if cfg.CertSource != nil {
+		s.tlsConf.GetCertificate = cfg.CertSource.GetCertificate
+	} else {
+		s.tlsConf.Certificates = []tls.Certificate{cfg.Cert}
+	}
+	if cfg.ClientCAs != nil || cfg.RelayCAs != nil {
+		s.tlsConf.GetConfigForClient = clientCertConfig(s.tlsConf, cfg.ClientCAs, cfg.RelayCAs)
+	}
+
+	audit, err := newAuditLog(cfg.Stores, config, cfg.AuditSyslog, cfg.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	s.audit = audit
+
+	if cfg.RelayClientsRetention == 0 {
+		cfg.RelayClientsRetention = 24 * time.Hour
 	}
 
-	relays, err := newRelayServer(cfg.RelayAuth, config, cfg.Stores, cfg.Logger)
+	relays, err := newRelayServer(epoch, cfg.RelayAuth, cfg.RelayCertAuth, config, cfg.Stores, cfg.RelayClientsRetention, audit, cfg.Logger)
 	if err != nil {
 		return nil, err
 	}
 	s.relays = relays
 
-	clSrv, err := newClientServer(cfg.ClientAuth, s.relays, config, cfg.Stores, cfg.Logger)
+	clSrv, err := newClientServer(epoch, cfg.ClientAuth, cfg.ClientCertAuth, s.relays, config, cfg.Stores, audit, cfg.Logger)
 	if err != nil {
 		return nil, err
 	}
@@ -53,47 +120,103 @@ func NewServer(cfg Config) (*Server, error) {
 
 type Server struct {
 	addr    *net.UDPAddr
+	epoch   int64
 	tlsConf *tls.Config
 	logger  *slog.Logger
 
+	certSource CertificateSource
+	statusAddr string
+	quicConf   quicc.Config
+
 	clients *clientServer
 	relays  *relayServer
+	audit   *auditLog
+}
+
+// runner is implemented by authenticators and certificate sources that work in the background,
+// like reloading their tokens or renewing the certificate
+type runner interface {
+	Run(ctx context.Context) error
 }
 
 func (s *Server) Run(ctx context.Context) error {
 	g, ctx := errgroup.WithContext(ctx)
 
+	if r, ok := s.clients.auth.(runner); ok {
+		g.Go(func() error { return r.Run(ctx) })
+	}
+	if r, ok := s.relays.auth.(runner); ok {
+		g.Go(func() error { return r.Run(ctx) })
+	}
+	if r, ok := s.clients.certAuth.(runner); ok {
+		g.Go(func() error { return r.Run(ctx) })
+	}
+	if r, ok := s.relays.certAuth.(runner); ok {
+		g.Go(func() error { return r.Run(ctx) })
+	}
+	if r, ok := s.certSource.(runner); ok {
+		g.Go(func() error { return r.Run(ctx) })
+	}
+
 	g.Go(func() error { return s.relays.run(ctx) })
+	g.Go(func() error { return s.relays.runCompactClients(ctx) })
 	g.Go(func() error { return s.clients.run(ctx) })
 	g.Go(func() error { return s.runListener(ctx) })
+	g.Go(func() error { return s.runStaleCleanup(ctx) })
+	g.Go(func() error { return s.audit.run(ctx) })
+
+	if s.statusAddr != "" {
+		g.Go(func() error { return statusc.Run(ctx, s.statusAddr, s.Status, s.logger) })
+	}
 
 	return g.Wait()
 }
 
+// how often connected clients and relays are checked if their token is still valid
+const reauthenticateInterval = 10 * time.Second
+
+// reauthenticate periodically calls check, closing the connection once it fails
+func reauthenticate(ctx context.Context, conn quic.Connection, check func() error) error {
+	t := time.NewTicker(reauthenticateInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if err := check(); err != nil {
+			// clients reconnect after a session is closed, so they can authenticate again with their current
+			// token (e.g. a refreshed token file) and only stop once that is rejected too
+			conn.CloseWithError(quic.ApplicationErrorCode(pb.Error_AuthenticationFailed), "Authentication no longer valid")
+			return kleverr.Newf("reauthentication failed: %w", err)
+		}
+	}
+}
+
 func (s *Server) runListener(ctx context.Context) error {
 	s.logger.Debug("start udp listener")
-	udpConn, err := net.ListenUDP("udp", s.addr)
+	udpConn, err := s.quicConf.ListenUDP(s.addr)
 	if err != nil {
-		return kleverr.Ret(err)
+		return err
 	}
 	defer udpConn.Close()
 
 	s.logger.Debug("start quic listener")
 	transport := &quic.Transport{
 		Conn: udpConn,
-		// TODO review other options
 	}
 	defer transport.Close()
 
-	l, err := transport.Listen(s.tlsConf, &quic.Config{
-		KeepAlivePeriod: 25 * time.Second,
-	})
+	l, err := transport.Listen(s.tlsConf, s.quicConf.QUIC())
 	if err != nil {
 		return kleverr.Ret(err)
 	}
 	defer l.Close()
 
-	s.logger.Info("waiting for connections")
+	s.logger.Info("waiting for connections", "epoch", s.epoch)
 	for {
 		conn, err := l.Accept(ctx)
 		if err != nil {
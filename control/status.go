@@ -0,0 +1,105 @@
+package control
+
+import (
+	"cmp"
+	"slices"
+
+	"github.com/connet-dev/connet/model"
+)
+
+// Status is a snapshot of the clients and relays connected to control, and the forwards they serve
+type Status struct {
+	Clients  []ClientStatus  `json:"clients"`
+	Relays   []RelayStatus   `json:"relays"`
+	Forwards []ForwardStatus `json:"forwards"`
+}
+
+type ClientStatus struct {
+	ID   string `json:"id"`
+	Addr string `json:"addr"`
+}
+
+type RelayStatus struct {
+	ID       string `json:"id"`
+	Hostport string `json:"hostport"`
+}
+
+// ForwardStatus lists the ids of the clients announced as destinations and sources of a forward,
+// and the hostports of the relays serving it
+type ForwardStatus struct {
+	Forward      string   `json:"forward"`
+	Destinations []string `json:"destinations"`
+	Sources      []string `json:"sources"`
+	Relays       []string `json:"relays"`
+}
+
+func (s *Server) Status() (Status, error) {
+	status := Status{Clients: []ClientStatus{}, Relays: []RelayStatus{}, Forwards: []ForwardStatus{}}
+
+	clientConns, _, err := s.clients.conns.Snapshot()
+	if err != nil {
+		return Status{}, err
+	}
+	for _, msg := range clientConns {
+		status.Clients = append(status.Clients, ClientStatus{ID: msg.Key.ID.String(), Addr: msg.Value.Addr})
+	}
+	slices.SortFunc(status.Clients, func(l, r ClientStatus) int { return cmp.Compare(l.ID, r.ID) })
+
+	relayConns, _, err := s.relays.conns.Snapshot()
+	if err != nil {
+		return Status{}, err
+	}
+	for _, msg := range relayConns {
+		status.Relays = append(status.Relays, RelayStatus{ID: msg.Key.ID.String(), Hostport: msg.Value.Hostport.String()})
+	}
+	slices.SortFunc(status.Relays, func(l, r RelayStatus) int { return cmp.Compare(l.ID, r.ID) })
+
+	forwards := map[model.Forward]*ForwardStatus{}
+	forward := func(fwd model.Forward) *ForwardStatus {
+		f := forwards[fwd]
+		if f == nil {
+			f = &ForwardStatus{Forward: fwd.String(), Destinations: []string{}, Sources: []string{}, Relays: []string{}}
+			forwards[fwd] = f
+		}
+		return f
+	}
+
+	s.clients.peersMu.RLock()
+	for key, peers := range s.clients.peersCache {
+		if len(peers) == 0 {
+			continue
+		}
+		f := forward(key.forward)
+		for _, peer := range peers {
+			switch key.role {
+			case model.Destination:
+				f.Destinations = append(f.Destinations, peer.Id)
+			case model.Source:
+				f.Sources = append(f.Sources, peer.Id)
+			}
+		}
+	}
+	s.clients.peersMu.RUnlock()
+
+	s.relays.forwardsMu.RLock()
+	for fwd, relays := range s.relays.forwardsCache {
+		if len(relays) == 0 {
+			continue
+		}
+		f := forward(fwd)
+		for _, relay := range relays {
+			f.Relays = append(f.Relays, relay.Hostport.String())
+		}
+	}
+	s.relays.forwardsMu.RUnlock()
+
+	for _, f := range forwards {
+		slices.Sort(f.Destinations)
+		slices.Sort(f.Sources)
+		slices.Sort(f.Relays)
+		status.Forwards = append(status.Forwards, *f)
+	}
+	slices.SortFunc(status.Forwards, func(l, r ForwardStatus) int { return cmp.Compare(l.Forward, r.Forward) })
+
+	return status, nil
+}
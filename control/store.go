@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/connet-dev/connet/certc"
 	"github.com/connet-dev/connet/logc"
@@ -18,12 +19,15 @@ type Stores interface {
 
 	ClientConns() (logc.KV[ClientConnKey, ClientConnValue], error)
 	ClientPeers() (logc.KV[ClientPeerKey, ClientPeerValue], error)
+	ClientPunches() (logc.KV[ClientPunchKey, ClientPunchValue], error)
 
 	RelayConns() (logc.KV[RelayConnKey, RelayConnValue], error)
 	RelayClients() (logc.KV[RelayClientKey, RelayClientValue], error)
 	RelayForwards(id ksuid.KSUID) (logc.KV[RelayForwardKey, RelayForwardValue], error)
 	RelayServers() (logc.KV[RelayServerKey, RelayServerValue], error)
 	RelayServerOffsets() (logc.KV[RelayConnKey, int64], error)
+
+	Audit() (logc.KV[AuditKey, AuditValue], error)
 }
 
 func NewFileStores(dir string) Stores {
@@ -54,6 +58,10 @@ func (f *fileStores) ClientPeers() (logc.KV[ClientPeerKey, ClientPeerValue], err
 	return logc.NewKV[ClientPeerKey, ClientPeerValue](filepath.Join(f.dir, "client-peers"))
 }
 
+func (f *fileStores) ClientPunches() (logc.KV[ClientPunchKey, ClientPunchValue], error) {
+	return logc.NewKV[ClientPunchKey, ClientPunchValue](filepath.Join(f.dir, "client-punches"))
+}
+
 func (f *fileStores) RelayConns() (logc.KV[RelayConnKey, RelayConnValue], error) {
 	return logc.NewKV[RelayConnKey, RelayConnValue](filepath.Join(f.dir, "relay-conns"))
 }
@@ -74,12 +82,25 @@ func (f *fileStores) RelayServerOffsets() (logc.KV[RelayConnKey, int64], error)
 	return logc.NewKV[RelayConnKey, int64](filepath.Join(f.dir, "relay-server-offsets"))
 }
 
+func (f *fileStores) Audit() (logc.KV[AuditKey, AuditValue], error) {
+	return logc.NewKV[AuditKey, AuditValue](filepath.Join(f.dir, "audit"))
+}
+
+// NewAuditReader opens the audit log of a stopped control server in dir for reading
+func NewAuditReader(dir string) (logc.KV[AuditKey, AuditValue], error) {
+	return logc.NewReadonlyKV[AuditKey, AuditValue](filepath.Join(dir, "audit"))
+}
+
 type ConfigKey string
 
 var (
 	configServerID           ConfigKey = "server-id"
 	configServerClientSecret ConfigKey = "server-client-secret"
 	configServerRelaySecret  ConfigKey = "server-relay-secret"
+	configServerEpoch        ConfigKey = "server-epoch"
+	configServerAuditSecret  ConfigKey = "server-audit-secret"
+
+	configRelayClientsCompacted ConfigKey = "relay-clients-compacted"
 )
 
 type ConfigValue struct {
@@ -95,6 +116,7 @@ type ClientConnKey struct {
 type ClientConnValue struct {
 	Authentication []byte `json:"authentication"`
 	Addr           string `json:"addr"`
+	Epoch          int64  `json:"epoch"` // of the server which stored it, see runStaleCleanup
 }
 
 type ClientPeerKey struct {
@@ -104,7 +126,45 @@ type ClientPeerKey struct {
 }
 
 type ClientPeerValue struct {
-	Peer *pbs.ClientPeer `json:"peer"`
+	Peer  *pbs.ClientPeer `json:"peer"`
+	Epoch int64           `json:"epoch"`
+}
+
+type ClientPunchKey struct {
+	Forward model.Forward `json:"forward"`
+	ID      ksuid.KSUID   `json:"id"`
+	PeerID  ksuid.KSUID   `json:"peer_id"`
+}
+
+type ClientPunchValue struct {
+	Attempts  int64 `json:"attempts"`
+	Matched   int64 `json:"matched"`
+	Successes int64 `json:"successes"`
+
+	LastSuccess bool      `json:"last_success"`
+	LastAddr    string    `json:"last_addr,omitempty"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastTime    time.Time `json:"last_time"`
+
+	Epoch int64 `json:"epoch"`
+}
+
+type AuditKey struct {
+	ID ksuid.KSUID `json:"id"`
+}
+
+type AuditValue struct {
+	Time     time.Time  `json:"time"`
+	Event    AuditEvent `json:"event"`
+	Remote   string     `json:"remote,omitempty"`
+	Token    string     `json:"token,omitempty"`    // fingerprint of the token, see TokenFingerprint
+	Identity string     `json:"identity,omitempty"` // of the client certificate, see CertIdentity
+	ClientID string     `json:"client_id,omitempty"`
+	RelayID  string     `json:"relay_id,omitempty"`
+	Forward  string     `json:"forward,omitempty"`
+	Role     string     `json:"role,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Count    int        `json:"count,omitempty"` // how many more times a failure repeated, after it was first recorded
 }
 
 type cacheKey struct {
@@ -119,6 +179,7 @@ type RelayConnKey struct {
 type RelayConnValue struct {
 	Authentication []byte         `json:"authentication"`
 	Hostport       model.HostPort `json:"hostport"`
+	Epoch          int64          `json:"epoch"`
 }
 
 type RelayClientKey struct {
@@ -128,20 +189,37 @@ type RelayClientKey struct {
 }
 
 type RelayClientValue struct {
-	Cert *x509.Certificate `json:"cert"`
+	Cert  *x509.Certificate `json:"cert"`
+	Epoch int64             `json:"epoch"`
 }
 
 func (v RelayClientValue) MarshalJSON() ([]byte, error) {
-	return certc.MarshalJSONCert(v.Cert)
+	s := struct {
+		Cert  []byte `json:"cert"`
+		Epoch int64  `json:"epoch"`
+	}{
+		Cert:  v.Cert.Raw,
+		Epoch: v.Epoch,
+	}
+	return json.Marshal(s)
 }
 
 func (v *RelayClientValue) UnmarshalJSON(b []byte) error {
-	cert, err := certc.UnmarshalJSONCert(b)
+	s := struct {
+		Cert  []byte `json:"cert"`
+		Epoch int64  `json:"epoch"`
+	}{}
+
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+
+	cert, err := x509.ParseCertificate(s.Cert)
 	if err != nil {
 		return err
 	}
 
-	*v = RelayClientValue{cert}
+	*v = RelayClientValue{Cert: cert, Epoch: s.Epoch}
 	return nil
 }
 
@@ -175,15 +253,18 @@ type RelayServerKey struct {
 type RelayServerValue struct {
 	Hostport model.HostPort    `json:"hostport"`
 	Cert     *x509.Certificate `json:"cert"`
+	Epoch    int64             `json:"epoch"`
 }
 
 func (v RelayServerValue) MarshalJSON() ([]byte, error) {
 	s := struct {
 		Hostport model.HostPort `json:"hostport"`
 		Cert     []byte         `json:"cert"`
+		Epoch    int64          `json:"epoch"`
 	}{
 		Hostport: v.Hostport,
 		Cert:     v.Cert.Raw,
+		Epoch:    v.Epoch,
 	}
 	return json.Marshal(s)
 }
@@ -192,6 +273,7 @@ func (v *RelayServerValue) UnmarshalJSON(b []byte) error {
 	s := struct {
 		Hostport model.HostPort `json:"hostport"`
 		Cert     []byte         `json:"cert"`
+		Epoch    int64          `json:"epoch"`
 	}{}
 
 	if err := json.Unmarshal(b, &s); err != nil {
@@ -203,7 +285,7 @@ func (v *RelayServerValue) UnmarshalJSON(b []byte) error {
 		return err
 	}
 
-	*v = RelayServerValue{Hostport: s.Hostport, Cert: cert}
+	*v = RelayServerValue{Hostport: s.Hostport, Cert: cert, Epoch: s.Epoch}
 	return nil
 }
 
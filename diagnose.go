@@ -0,0 +1,309 @@
+package connet
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/connet-dev/connet/client"
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/pb"
+)
+
+type DiagnoseResult string
+
+const (
+	DiagnoseOK      DiagnoseResult = "ok"
+	DiagnoseFailed  DiagnoseResult = "failed"
+	DiagnoseSkipped DiagnoseResult = "skipped"
+)
+
+// DiagnoseStep is the verdict of a single check. Forward and Role are empty for checks of the control connection,
+// Code is set when the failure was reported by a server or peer.
+type DiagnoseStep struct {
+	Check   string
+	Forward string
+	Role    string
+	Target  string
+	Result  DiagnoseResult
+	Detail  string
+	Code    pb.Error_Code
+}
+
+// Diagnose runs a temporary client, configured by opts, for up to timeout and checks each step a connection goes
+// through: authenticating to control, connecting to relays, direct routes to peers and dialing destinations.
+// The client briefly joins its forwards as an additional peer, but its sources do not listen at their addresses and
+// its destinations refuse every connection, so sources and relays move on to the actual destinations.
+func Diagnose(ctx context.Context, timeout time.Duration, opts ...ClientOption) ([]DiagnoseStep, error) {
+	var authenticated bool
+	var disconnects []error
+	var eventsMu sync.Mutex
+
+	opts = append(opts, ClientEvents(func(ev ClientEvent) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		switch ev.Type {
+		case ClientAuthenticated:
+			authenticated = true
+		case ClientDisconnected:
+			if !errors.Is(ev.Err, context.Canceled) {
+				disconnects = append(disconnects, ev.Err)
+			}
+		}
+	}), func(cfg *clientConfig) error {
+		cfg.unbound = true
+		cfg.refusing = true
+		return nil
+	})
+
+	c, err := NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	runErr := make(chan error, 1)
+	go func() { runErr <- c.Run(ctx) }()
+	defer func() {
+		cancel()
+		<-runErr
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case err := <-runErr:
+			runErr <- err // for the deferred wait
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			return []DiagnoseStep{failedStep(DiagnoseStep{Check: "control", Target: c.controlAddr}, err)}, nil
+		case <-deadline.C:
+			break wait
+		case <-ticker.C:
+			eventsMu.Lock()
+			done := authenticated && (len(disconnects) > 0 || c.diagnoseSettled())
+			eventsMu.Unlock()
+			if done {
+				break wait
+			}
+		}
+	}
+
+	eventsMu.Lock()
+	defer eventsMu.Unlock()
+
+	if !authenticated {
+		step := DiagnoseStep{Check: "control", Target: c.controlAddr, Result: DiagnoseFailed,
+			Detail: fmt.Sprintf("not authenticated within %s", timeout)}
+		if status := c.Status(); status.Control.Error != "" {
+			step.Detail = status.Control.Error
+		}
+		return []DiagnoseStep{step}, nil
+	}
+
+	c.directAddrsMu.Lock()
+	public := c.directAddrs.public
+	c.directAddrsMu.Unlock()
+	control := DiagnoseStep{Check: "control", Target: c.controlAddr, Result: DiagnoseOK,
+		Detail: "authenticated, no public address observed"}
+	if public.IsValid() {
+		control.Detail = fmt.Sprintf("authenticated, observed public address %s", public)
+	}
+	steps := []DiagnoseStep{control}
+
+	for _, err := range disconnects {
+		// e.g. control rejected a forward
+		steps = append(steps, failedStep(DiagnoseStep{Check: "announce", Target: c.controlAddr}, err))
+	}
+
+	status := c.Status()
+	for _, fwd := range slices.SortedFunc(maps.Keys(c.dsts), compareForwards) {
+		steps = append(steps, c.diagnoseForward(fwd, model.Destination, c.destinations[fwd], status.Destinations[fwd.String()])...)
+		steps = append(steps, diagnoseDial(fwd, c.destinations[fwd].addr))
+	}
+	for _, fwd := range slices.SortedFunc(maps.Keys(c.srcs), compareForwards) {
+		steps = append(steps, c.diagnoseForward(fwd, model.Source, c.sources[fwd], status.Sources[fwd.String()])...)
+		steps = append(steps, diagnoseProbe(ctx, fwd, c.srcs[fwd])...)
+	}
+	return steps, nil
+}
+
+// diagnoseSettled is true when each forward has peers, and routes to them of every kind it allows
+func (c *Client) diagnoseSettled() bool {
+	status := c.Status()
+	settled := func(cfg clientForwardConfig, s client.Status) bool {
+		if len(s.Peers) == 0 {
+			return false
+		}
+		for _, r := range s.Relays {
+			if !r.Connected {
+				return false
+			}
+		}
+		for _, peer := range s.Peers {
+			direct, relay := peerRoutes(s, peer)
+			if cfg.route.AllowDirect() && len(direct) == 0 {
+				return false
+			}
+			if cfg.route.AllowRelay() && len(s.Relays) > 0 && len(relay) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	for fwd, cfg := range c.destinations {
+		if !settled(cfg, status.Destinations[fwd.String()]) {
+			return false
+		}
+	}
+	for fwd, cfg := range c.sources {
+		if !settled(cfg, status.Sources[fwd.String()]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) diagnoseForward(fwd model.Forward, role model.Role, cfg clientForwardConfig, s client.Status) []DiagnoseStep {
+	base := DiagnoseStep{Forward: fwd.String(), Role: role.String()}
+	var steps []DiagnoseStep
+
+	relayStep := base
+	relayStep.Check = "relay"
+	switch {
+	case !cfg.route.AllowRelay():
+		relayStep.Result, relayStep.Detail = DiagnoseSkipped, "relay routes are not allowed"
+		steps = append(steps, relayStep)
+	case len(s.Relays) == 0:
+		relayStep.Result, relayStep.Detail = DiagnoseFailed, "control offered no relays for this forward"
+		steps = append(steps, relayStep)
+	}
+	for _, r := range s.Relays {
+		step := relayStep
+		step.Target = r.Hostport
+		switch {
+		case r.Connected:
+			step.Result, step.Detail = DiagnoseOK, "connected"
+		case r.Error != "":
+			step.Result, step.Detail = DiagnoseFailed, r.Error
+		default:
+			step.Result, step.Detail = DiagnoseFailed, "not connected"
+		}
+		steps = append(steps, step)
+	}
+
+	if len(s.Peers) == 0 {
+		step := base
+		step.Check = "peers"
+		step.Result, step.Detail = DiagnoseFailed, fmt.Sprintf("no %s announced for this forward", role.Invert())
+		return append(steps, step)
+	}
+
+	for _, peer := range s.Peers {
+		direct, relay := peerRoutes(s, peer)
+
+		step := base
+		step.Check, step.Target = "direct", peer
+		switch {
+		case !cfg.route.AllowDirect():
+			step.Result, step.Detail = DiagnoseSkipped, "direct routes are not allowed"
+		case len(direct) > 0:
+			step.Result, step.Detail = DiagnoseOK, describeRoutes(direct)
+		default:
+			step.Result, step.Detail = DiagnoseFailed, "no direct route, hole punching did not succeed (or the peer does not allow direct routes)"
+		}
+		steps = append(steps, step)
+
+		step.Check = "relayed"
+		switch {
+		case !cfg.route.AllowRelay():
+			step.Result, step.Detail = DiagnoseSkipped, "relay routes are not allowed"
+		case len(relay) > 0:
+			step.Result, step.Detail = DiagnoseOK, describeRoutes(relay)
+		default:
+			step.Result, step.Detail = DiagnoseFailed, "no route through a relay (or the peer does not allow relay routes)"
+		}
+		steps = append(steps, step)
+	}
+
+	return steps
+}
+
+func diagnoseDial(fwd model.Forward, addr string) DiagnoseStep {
+	step := DiagnoseStep{Check: "dial", Forward: fwd.String(), Role: model.Destination.String(), Target: addr}
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		step.Result, step.Detail, step.Code = DiagnoseFailed, err.Error(), pb.Error_DestinationDialFailed
+		return step
+	}
+	conn.Close()
+	step.Result, step.Detail = DiagnoseOK, "dialed"
+	return step
+}
+
+func diagnoseProbe(ctx context.Context, fwd model.Forward, src *client.Source) []DiagnoseStep {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	var steps []DiagnoseStep
+	for _, r := range src.Probe(ctx) {
+		step := DiagnoseStep{Check: "connect", Forward: fwd.String(), Role: model.Source.String(),
+			Target: fmt.Sprintf("%s via %s", r.Peer, r.Style)}
+		if r.Err != nil {
+			steps = append(steps, failedStep(step, r.Err))
+			continue
+		}
+		step.Result, step.Detail = DiagnoseOK, "destination dialed its address"
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func failedStep(step DiagnoseStep, err error) DiagnoseStep {
+	step.Result, step.Detail = DiagnoseFailed, err.Error()
+	if perr := pb.GetError(err); perr != nil {
+		step.Code, step.Detail = perr.Code, perr.Message
+	} else if aerr := pb.GetAppError(err); aerr != nil && aerr.Remote {
+		step.Code = pb.Error_Code(aerr.ErrorCode)
+	}
+	return step
+}
+
+func peerRoutes(s client.Status, peer string) (direct, relay []client.RouteStatus) {
+	for _, r := range s.Routes {
+		switch {
+		case r.Peer != peer:
+		case r.Style == "relay":
+			relay = append(relay, r)
+		default:
+			direct = append(direct, r)
+		}
+	}
+	return direct, relay
+}
+
+func describeRoutes(routes []client.RouteStatus) string {
+	var s []string
+	for _, r := range routes {
+		s = append(s, fmt.Sprintf("%s %s rtt %s", r.Style, r.Addr, r.RTT.Round(100*time.Microsecond)))
+	}
+	return strings.Join(s, ", ")
+}
+
+func compareForwards(l, r model.Forward) int {
+	return cmp.Compare(l.String(), r.String())
+}
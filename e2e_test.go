@@ -6,15 +6,24 @@ import (
 	"io"
 	"log/slog"
 	"math/rand/v2"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/connet-dev/connet/certc"
+	"github.com/connet-dev/connet/client"
+	"github.com/connet-dev/connet/control"
 	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/netc"
+	"github.com/connet-dev/connet/pb"
+	"github.com/connet-dev/connet/statusc"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/sync/errgroup"
 )
@@ -30,9 +39,15 @@ func TestE2E(t *testing.T) {
 
 	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
 
+	var events = map[ClientEventType]int{}
+	var eventsMu sync.Mutex
+
+	serverStatusSocket := filepath.Join(t.TempDir(), "server-status.sock")
 	srv, err := NewServer(
 		ServerClientTokens("test-token"),
 		serverControlCertificate(cert),
+		ServerStatusAddress("unix:"+serverStatusSocket),
+		ServerRelayForwardTimeouts("reap-relay", netc.JoinTimeouts{MaxLifetime: 300 * time.Millisecond}),
 		ServerLogger(logger.With("test", "server")),
 	)
 	require.NoError(t, err)
@@ -50,10 +65,16 @@ func TestE2E(t *testing.T) {
 		ClientDestination("dst-relay-any-src", hts.Listener.Addr().String(), model.RouteRelay),
 		ClientDestination("dst-direct-relay-src", hts.Listener.Addr().String(), model.RouteDirect),
 		ClientDestination("dst-relay-direct-src", hts.Listener.Addr().String(), model.RouteRelay),
+		ClientEvents(func(ev ClientEvent) {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			events[ev.Type]++
+		}),
 		ClientLogger(logger.With("test", "cl-dst")),
 	)
 	require.NoError(t, err)
 
+	statusSocket := filepath.Join(t.TempDir(), "status.sock")
 	clSrc, err := NewClient(
 		ClientToken("test-token"),
 		ClientControlAddress("localhost:19190"),
@@ -67,20 +88,51 @@ func TestE2E(t *testing.T) {
 		ClientSource("dst-relay-any-src", ":9995", model.RouteAny),
 		ClientSource("dst-direct-relay-src", ":9996", model.RouteRelay),
 		ClientSource("dst-relay-direct-src", ":9997", model.RouteDirect),
+		ClientStatusAddress("unix:"+statusSocket),
 		ClientLogger(logger.With("test", "cl-src")),
 	)
 	require.NoError(t, err)
 
+	clBad, err := NewClient(
+		ClientToken("bad-token"),
+		ClientControlAddress("localhost:19190"),
+		clientControlCAs(cas),
+		ClientDirectAddress(":19194"),
+		ClientSource("direct", ":9998", model.RouteDirect),
+		ClientLogger(logger.With("test", "cl-bad")),
+	)
+	require.NoError(t, err)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	g, ctx := errgroup.WithContext(ctx)
 	g.Go(func() error { return srv.Run(ctx) })
-	time.Sleep(time.Millisecond) // time for server to come online
+	// clients stop if they cannot connect at first, wait for control to accept the embedded relay
+	require.Eventually(t, func() bool {
+		status, err := srv.control.Status()
+		return err == nil && len(status.Relays) > 0
+	}, 5*time.Second, 10*time.Millisecond)
 
 	g.Go(func() error { return clDst.Run(ctx) })
 	g.Go(func() error { return clSrc.Run(ctx) })
-	time.Sleep(300 * time.Millisecond) // time for clients to come online
+	require.Eventually(t, func() bool {
+		status := clSrc.Status()
+		if status.Control.State != ClientControlConnected {
+			return false
+		}
+		for _, fwd := range []string{"direct", "relay", "dst-any-direct-src", "dst-any-relay-src", "dst-direct-any-src", "dst-relay-any-src"} {
+			if len(status.Sources[fwd].Routes) == 0 {
+				return false
+			}
+		}
+		return true
+	}, 10*time.Second, 10*time.Millisecond)
+
+	t.Run("bad-token", func(t *testing.T) {
+		err := clBad.Run(ctx)
+		require.ErrorIs(t, err, ErrAuthenticationFailed)
+	})
 
 	// actual test
 	httpcl := &http.Client{}
@@ -114,8 +166,417 @@ func TestE2E(t *testing.T) {
 		})
 	}
 
+	t.Run("events", func(t *testing.T) {
+		eventsMu.Lock()
+		defer eventsMu.Unlock()
+		require.Equal(t, 1, events[ClientAuthenticated])
+		require.Positive(t, events[ClientPeerAdded])
+	})
+
+	t.Run("status", func(t *testing.T) {
+		status, err := statusc.Get[ClientStatus](ctx, "unix:"+statusSocket)
+		require.NoError(t, err)
+		require.Equal(t, ClientControlConnected, status.Control.State)
+		require.NotEmpty(t, status.DirectAddrs)
+
+		direct := status.Sources["direct"]
+		require.Len(t, direct.Peers, 1)
+		require.NotEmpty(t, direct.Routes)
+		for _, route := range direct.Routes {
+			require.NotEqual(t, "relay", route.Style)
+		}
+
+		relay := status.Sources["relay"]
+		require.NotEmpty(t, relay.Relays)
+		require.True(t, relay.Relays[0].Connected)
+	})
+
+	t.Run("server-status", func(t *testing.T) {
+		status, err := statusc.Get[control.Status](ctx, "unix:"+serverStatusSocket)
+		require.NoError(t, err)
+		require.Len(t, status.Clients, 2)
+		require.Len(t, status.Relays, 1)
+
+		idx := slices.IndexFunc(status.Forwards, func(f control.ForwardStatus) bool { return f.Forward == "relay" })
+		require.GreaterOrEqual(t, idx, 0)
+		require.Len(t, status.Forwards[idx].Destinations, 1)
+		require.Len(t, status.Forwards[idx].Sources, 1)
+		require.Len(t, status.Forwards[idx].Relays, 1)
+	})
+
+	t.Run("diagnose", func(t *testing.T) {
+		steps, err := Diagnose(ctx, 5*time.Second,
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientSource("relay", ":9991", model.RouteRelay),
+			ClientLogger(logger.With("test", "cl-diagnose")),
+		)
+		require.NoError(t, err)
+
+		checks := map[string]DiagnoseResult{}
+		for _, step := range steps {
+			require.NotEqual(t, DiagnoseFailed, step.Result, step)
+			checks[step.Check] = step.Result
+		}
+		require.Equal(t, DiagnoseOK, checks["control"])
+		require.Equal(t, DiagnoseOK, checks["relay"])
+		require.Equal(t, DiagnoseSkipped, checks["direct"])
+		require.Equal(t, DiagnoseOK, checks["connect"])
+
+		// destinations are checked like sources, while sources keep connecting to the actual destination
+		requestsDone := make(chan error, 1)
+		diagnoseDone := make(chan struct{})
+		go func() {
+			for {
+				select {
+				case <-diagnoseDone:
+					requestsDone <- nil
+					return
+				default:
+				}
+				resp, err := httpcl.Get("http://localhost:9991")
+				if err != nil {
+					requestsDone <- err
+					return
+				}
+				resp.Body.Close()
+			}
+		}()
+		steps, err = Diagnose(ctx, 5*time.Second,
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientDestination("relay", hts.Listener.Addr().String(), model.RouteRelay),
+			ClientLogger(logger.With("test", "cl-diagnose")),
+		)
+		close(diagnoseDone)
+		require.NoError(t, err)
+		require.NoError(t, <-requestsDone)
+
+		checks = map[string]DiagnoseResult{}
+		for _, step := range steps {
+			require.NotEqual(t, DiagnoseFailed, step.Result, step)
+			checks[step.Check] = step.Result
+		}
+		require.Equal(t, DiagnoseOK, checks["control"])
+		require.Equal(t, DiagnoseOK, checks["relay"])
+		require.Equal(t, DiagnoseSkipped, checks["direct"])
+		require.Equal(t, DiagnoseOK, checks["relayed"])
+		require.Equal(t, DiagnoseOK, checks["dial"])
+
+		steps, err = Diagnose(ctx, 5*time.Second,
+			ClientToken("bad-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientSource("relay", ":9991", model.RouteRelay),
+			ClientLogger(logger.With("test", "cl-diagnose")),
+		)
+		require.NoError(t, err)
+		require.Len(t, steps, 1)
+		require.Equal(t, DiagnoseFailed, steps[0].Result)
+		require.Equal(t, pb.Error_AuthenticationFailed, steps[0].Code)
+	})
+
+	t.Run("bench", func(t *testing.T) {
+		results, err := Bench(ctx, BenchConfig{Pings: 10, Duration: 100 * time.Millisecond},
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientLogger(logger.With("test", "cl-bench")),
+		)
+		require.NoError(t, err)
+		require.Len(t, results, 2)
+		for _, r := range results {
+			require.Empty(t, r.Error)
+			require.Equal(t, 10, r.Pings)
+			require.Positive(t, r.LatencyP50)
+			require.Positive(t, r.Download)
+			require.Positive(t, r.Upload)
+		}
+	})
+
+	t.Run("drain", func(t *testing.T) {
+		echo := echoListener(t)
+
+		clDrainDst, err := NewClient(
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientDestination("drain", echo.Addr().String(), model.RouteDirect),
+			ClientDrainTimeout(5*time.Second),
+			ClientLogger(logger.With("test", "cl-drain-dst")),
+		)
+		require.NoError(t, err)
+		clDrainSrc, err := NewClient(
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientSource("drain", ":9989", model.RouteDirect),
+			ClientLogger(logger.With("test", "cl-drain-src")),
+		)
+		require.NoError(t, err)
+
+		srcCtx, srcCancel := context.WithCancel(ctx)
+		defer srcCancel()
+		go clDrainSrc.Run(srcCtx)
+
+		dstCtx, dstCancel := context.WithCancel(ctx)
+		defer dstCancel()
+		dstDone := make(chan error, 1)
+		go func() { dstDone <- clDrainDst.Run(dstCtx) }()
+
+		require.Eventually(t, func() bool {
+			return len(clDrainSrc.Status().Sources["drain"].Routes) > 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		conn, err := net.Dial("tcp", "localhost:9989")
+		require.NoError(t, err)
+		defer conn.Close()
+
+		buf := make([]byte, 4)
+		_, err = conn.Write([]byte("ping"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+
+		dstCancel()
+		// the destination revokes its announcement
+		require.Eventually(t, func() bool {
+			status, err := statusc.Get[control.Status](ctx, "unix:"+serverStatusSocket)
+			require.NoError(t, err)
+			idx := slices.IndexFunc(status.Forwards, func(f control.ForwardStatus) bool { return f.Forward == "drain" })
+			return idx >= 0 && len(status.Forwards[idx].Destinations) == 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		// while the conn in flight still works
+		_, err = conn.Write([]byte("pong"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		require.Equal(t, "pong", string(buf))
+
+		select {
+		case err := <-dstDone:
+			require.Fail(t, "destination stopped while draining", err)
+		default:
+		}
+
+		require.NoError(t, conn.Close())
+		select {
+		case err := <-dstDone:
+			require.ErrorIs(t, err, context.Canceled)
+		case <-time.After(3 * time.Second):
+			require.Fail(t, "destination did not stop after draining")
+		}
+	})
+
+	t.Run("reap", func(t *testing.T) {
+		echo := echoListener(t)
+
+		clReapDst, err := NewClient(
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientDestination("reap", echo.Addr().String(), model.RouteDirect),
+			ClientDestinationTimeouts("reap", netc.JoinTimeouts{Idle: 300 * time.Millisecond}),
+			ClientDestination("reap-relay", echo.Addr().String(), model.RouteRelay),
+			ClientLogger(logger.With("test", "cl-reap-dst")),
+		)
+		require.NoError(t, err)
+		clReapSrc, err := NewClient(
+			ClientToken("test-token"),
+			ClientControlAddress("localhost:19190"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientSource("reap", ":9987", model.RouteDirect),
+			ClientSource("reap-relay", ":9986", model.RouteRelay),
+			ClientLogger(logger.With("test", "cl-reap-src")),
+		)
+		require.NoError(t, err)
+
+		reapCtx, reapCancel := context.WithCancel(ctx)
+		defer reapCancel()
+		go clReapDst.Run(reapCtx)
+		go clReapSrc.Run(reapCtx)
+
+		require.Eventually(t, func() bool {
+			status := clReapSrc.Status()
+			return len(status.Sources["reap"].Routes) > 0 && len(status.Sources["reap-relay"].Routes) > 0
+		}, 5*time.Second, 50*time.Millisecond)
+
+		for _, port := range []int{9987, 9986} {
+			conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("ping"))
+			require.NoError(t, err)
+			_, err = io.ReadFull(conn, make([]byte, 4))
+			require.NoError(t, err)
+
+			// the destination reaps the idle conn, and the relay the one past its max lifetime
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+			_, err = io.ReadAll(conn)
+			require.NoError(t, err)
+		}
+
+		require.Eventually(t, func() bool {
+			return clReapDst.Status().Destinations["reap"].Conns == client.ConnsStatus{ReapedIdle: 1}
+		}, 5*time.Second, 50*time.Millisecond)
+		require.Equal(t, client.ConnsStatus{}, clReapDst.Status().Destinations["reap-relay"].Conns)
+	})
+
 	fmt.Println("stopping all")
 	cancel()
 
 	g.Wait()
 }
+
+func TestE2EClientCertificate(t *testing.T) {
+	cert, cas, err := certc.SelfSigned("localhost")
+	require.NoError(t, err)
+
+	clientsCA, err := certc.NewRoot()
+	require.NoError(t, err)
+	clientsCAs, err := clientsCA.CertPool()
+	require.NoError(t, err)
+	clientCert, err := clientsCA.NewClient(certc.CertOpts{Domains: []string{"client-1.example.com"}})
+	require.NoError(t, err)
+	clientTLSCert, err := clientCert.TLSCert()
+	require.NoError(t, err)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	srv, err := NewServer(
+		// with client CAs, the certificate identity is checked instead of the token
+		ServerClientTokens("client-1.example.com"),
+		serverClientCAs(clientsCAs),
+		ServerClientIdentities("client-1.example.com"),
+		serverControlCertificate(cert),
+		ServerControlAddress(":19290"),
+		ServerRelayAddress(":19291"),
+		ServerLogger(logger.With("test", "server")),
+	)
+	require.NoError(t, err)
+
+	newClient := func(opts ...ClientOption) *Client {
+		cl, err := NewClient(append([]ClientOption{
+			ClientControlAddress("localhost:19290"),
+			clientControlCAs(cas),
+			ClientDirectAddress(":0"),
+			ClientDestination("cert", ":19292", model.RouteAny),
+			ClientLogger(logger.With("test", "client")),
+		}, opts...)...)
+		require.NoError(t, err)
+		return cl
+	}
+	clCert := newClient(clientControlCertificate(clientTLSCert))
+	clToken := newClient(ClientToken("client-1.example.com"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Run(ctx)
+	go clCert.Run(ctx)
+	tokenErr := make(chan error, 1)
+	go func() { tokenErr <- clToken.Run(ctx) }()
+
+	require.Eventually(t, func() bool {
+		return clCert.Status().Control.State == ClientControlConnected
+	}, 5*time.Second, 50*time.Millisecond)
+	// without a certificate, even the right token is not accepted
+	select {
+	case err := <-tokenErr:
+		require.Error(t, err)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "token client was not rejected")
+	}
+}
+
+func TestE2ETokenRotation(t *testing.T) {
+	cert, cas, err := certc.SelfSigned("localhost")
+	require.NoError(t, err)
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	dir := t.TempDir()
+	tokensFile := filepath.Join(dir, "tokens")
+	require.NoError(t, os.WriteFile(tokensFile, []byte("token-1\n"), 0600))
+	tokenFile := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-1\n"), 0600))
+
+	srv, err := NewServer(
+		ServerClientTokensFile(tokensFile),
+		serverControlCertificate(cert),
+		ServerControlAddress(":19390"),
+		ServerRelayAddress(":19391"),
+		ServerLogger(logger.With("test", "server")),
+	)
+	require.NoError(t, err)
+
+	var authenticated atomic.Int32
+	cl, err := NewClient(
+		ClientTokenFile(tokenFile),
+		ClientControlAddress("localhost:19390"),
+		clientControlCAs(cas),
+		ClientDirectAddress(":0"),
+		ClientDestination("rotate", ":19392", model.RouteAny),
+		ClientEvents(func(ev ClientEvent) {
+			if ev.Type == ClientAuthenticated {
+				authenticated.Add(1)
+			}
+		}),
+		ClientLogger(logger.With("test", "client")),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go srv.Run(ctx)
+	clErr := make(chan error, 1)
+	go func() { clErr <- cl.Run(ctx) }()
+
+	require.Eventually(t, func() bool { return authenticated.Load() == 1 }, 5*time.Second, 50*time.Millisecond)
+
+	// the client gets its new token first, then the old one is removed from the server
+	require.NoError(t, os.WriteFile(tokenFile, []byte("token-2\n"), 0600))
+	require.NoError(t, os.WriteFile(tokensFile, []byte("token-2\n"), 0600))
+
+	// the server disconnects the client once it notices, which then reconnects with the new token
+	var stopErr error
+	require.Eventually(t, func() bool {
+		select {
+		case stopErr = <-clErr:
+			return true
+		default:
+		}
+		return authenticated.Load() == 2 && cl.Status().Control.State == ClientControlConnected
+	}, 30*time.Second, 100*time.Millisecond)
+	require.NoError(t, stopErr, "client stopped")
+}
+
+func echoListener(t *testing.T) net.Listener {
+	echo, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { echo.Close() })
+	go func() {
+		for {
+			conn, err := echo.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return echo
+}
@@ -6,8 +6,11 @@ import (
 	"errors"
 	"maps"
 	"slices"
+	"sync"
+	"time"
 
 	"github.com/klev-dev/klevdb"
+	"github.com/klev-dev/klevdb/compact"
 	"github.com/klev-dev/kleverr"
 )
 
@@ -17,7 +20,10 @@ const (
 	OffsetNewest  = klevdb.OffsetNewest
 )
 
-var ErrNotFound = klevdb.ErrNotFound
+var (
+	ErrNotFound      = klevdb.ErrNotFound
+	ErrInvalidOffset = klevdb.ErrInvalidOffset
+)
 
 type Message[K comparable, V any] struct {
 	Offset int64
@@ -29,6 +35,7 @@ type Message[K comparable, V any] struct {
 type KV[K comparable, V any] interface {
 	Put(k K, v V) error
 	Del(k K) error
+	DelIf(k K, fn func(V) bool) (bool, error)
 
 	Get(k K) (V, error)
 	GetOrDefault(k K, v V) (V, error)
@@ -37,6 +44,9 @@ type KV[K comparable, V any] interface {
 	Consume(ctx context.Context, offset int64) ([]Message[K, V], int64, error)
 	Snapshot() ([]Message[K, V], int64, error) // TODO this could possible return too much data
 
+	Replace(values map[K]V) error
+	Compact(ctx context.Context, before time.Time) (int64, error)
+
 	Close() error
 }
 
@@ -50,14 +60,32 @@ func NewKV[K comparable, V any](dir string) (KV[K, V], error) {
 	if err != nil {
 		return nil, err
 	}
-	return &kv[K, V]{log}, nil
+	return &kv[K, V]{log: log}, nil
+}
+
+// NewReadonlyKV opens an existing KV for reading, failing if it is already opened for writing
+func NewReadonlyKV[K comparable, V any](dir string) (KV[K, V], error) {
+	log, err := klevdb.OpenTBlocking(dir, klevdb.Options{
+		KeyIndex: true,
+		Readonly: true,
+	}, klevdb.JsonCodec[K]{}, klevdb.JsonCodec[V]{})
+	if err != nil {
+		return nil, err
+	}
+	return &kv[K, V]{log: log}, nil
 }
 
 type kv[K comparable, V any] struct {
 	log klevdb.TBlockingLog[K, V]
+
+	// serializes writes, so conditional ones see no changes between their check and publish
+	writeMu sync.Mutex
 }
 
 func (l *kv[K, V]) Put(k K, v V) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
 	_, err := l.log.Publish([]klevdb.TMessage[K, V]{{
 		Key:   k,
 		Value: v,
@@ -66,6 +94,32 @@ func (l *kv[K, V]) Put(k K, v V) error {
 }
 
 func (l *kv[K, V]) Del(k K) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	return l.del(k)
+}
+
+// DelIf deletes k when its current value matches fn, reporting if it was deleted
+func (l *kv[K, V]) DelIf(k K, fn func(V) bool) (bool, error) {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	switch v, err := l.Get(k); {
+	case errors.Is(err, ErrNotFound):
+		return false, nil
+	case err != nil:
+		return false, err
+	case !fn(v):
+		return false, nil
+	}
+	if err := l.del(k); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (l *kv[K, V]) del(k K) error {
 	_, err := l.log.Publish([]klevdb.TMessage[K, V]{{
 		Key:        k,
 		ValueEmpty: true,
@@ -164,6 +218,56 @@ func (l *kv[K, V]) Snapshot() ([]Message[K, V], int64, error) {
 	}), maxOffset, nil
 }
 
+// Replace changes the content to values with a single publish, deleting any other keys
+func (l *kv[K, V]) Replace(values map[K]V) error {
+	l.writeMu.Lock()
+	defer l.writeMu.Unlock()
+
+	current, _, err := l.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	var msgs []klevdb.TMessage[K, V]
+	for _, msg := range current {
+		if _, ok := values[msg.Key]; !ok {
+			msgs = append(msgs, klevdb.TMessage[K, V]{Key: msg.Key, ValueEmpty: true})
+		}
+	}
+	for k, v := range values {
+		msgs = append(msgs, klevdb.TMessage[K, V]{Key: k, Value: v})
+	}
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	_, err = l.log.Publish(msgs)
+	return err
+}
+
+// Compact removes messages published before a time, which were either replaced by a later message
+// for the same key or are deletes. Consumers at an offset before the returned one might have missed
+// messages and should start from a snapshot. When nothing was removed, it returns OffsetInvalid.
+func (l *kv[K, V]) Compact(ctx context.Context, before time.Time) (int64, error) {
+	updates, _, err := compact.Updates(ctx, l.log.Raw(), before)
+	if err != nil {
+		return OffsetInvalid, err
+	}
+	deletes, _, err := compact.Deletes(ctx, l.log.Raw(), before)
+	if err != nil {
+		return OffsetInvalid, err
+	}
+
+	compacted := OffsetInvalid
+	for offset := range updates {
+		compacted = max(compacted, offset+1)
+	}
+	for offset := range deletes {
+		compacted = max(compacted, offset+1)
+	}
+	return compacted, nil
+}
+
 func (l *kv[K, V]) Close() error {
 	return l.log.Close()
 }
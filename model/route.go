@@ -39,3 +39,7 @@ func (r RouteOption) AllowDirect() bool {
 func (r RouteOption) AllowRelay() bool {
 	return r == RouteAny || r == RouteRelay
 }
+
+func (r RouteOption) String() string {
+	return r.string
+}
@@ -0,0 +1,128 @@
+package netc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+const (
+	// DialTimeout bounds a single attempt to resolve and connect to a server
+	DialTimeout = 10 * time.Second
+	// HappyEyeballsDelay is how long to wait on an address, before also trying the next one (RFC 8305)
+	HappyEyeballsDelay = 250 * time.Millisecond
+)
+
+// ResolveUDPAddrs looks up all addresses of a host:port, IPv6 and IPv4 interleaved (IPv6 first), as in RFC 8305.
+// An empty host resolves to localhost.
+func ResolveUDPAddrs(ctx context.Context, address string) ([]*net.UDPAddr, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, kleverr.Newf("cannot split address: %w", err)
+	}
+	if host == "" {
+		host = "localhost"
+	}
+
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		lport, lerr := net.DefaultResolver.LookupPort(ctx, "udp", portStr)
+		if lerr != nil {
+			return nil, kleverr.Newf("cannot resolve port: %w", lerr)
+		}
+		port = uint64(lport)
+	}
+
+	ips, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil, kleverr.Newf("cannot resolve host: %w", err)
+	}
+
+	var v6, v4 []netip.Addr
+	for _, ip := range ips {
+		if ip = ip.Unmap(); ip.Is4() {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+
+	addrs := make([]*net.UDPAddr, 0, len(ips))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			addrs = append(addrs, net.UDPAddrFromAddrPort(netip.AddrPortFrom(v6[i], uint16(port))))
+		}
+		if i < len(v4) {
+			addrs = append(addrs, net.UDPAddrFromAddrPort(netip.AddrPortFrom(v4[i], uint16(port))))
+		}
+	}
+	return addrs, nil
+}
+
+// DialHappyEyeballs dials addrs in order, starting the next attempt when the previous fails or after delay
+// passes, whichever is first. It returns the first connection to succeed, closing any later ones.
+func DialHappyEyeballs[C any](ctx context.Context, addrs []*net.UDPAddr, delay time.Duration,
+	dial func(ctx context.Context, addr *net.UDPAddr) (C, error), closeConn func(C)) (C, *net.UDPAddr, error) {
+
+	var zero C
+	if len(addrs) == 0 {
+		return zero, nil, kleverr.New("no addresses to dial")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn C
+		addr *net.UDPAddr
+		err  error
+	}
+	results := make(chan result, len(addrs))
+
+	var next, pending int
+	start := func() {
+		addr := addrs[next]
+		next++
+		pending++
+		go func() {
+			conn, err := dial(ctx, addr)
+			results <- result{conn, addr, err}
+		}()
+	}
+
+	start()
+	t := time.NewTimer(delay)
+	defer t.Stop()
+
+	var errs []error
+	for pending > 0 {
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				go func(pending int) {
+					for range pending {
+						if late := <-results; late.err == nil {
+							closeConn(late.conn)
+						}
+					}
+				}(pending)
+				return r.conn, r.addr, nil
+			}
+			errs = append(errs, r.err)
+		case <-t.C:
+		}
+
+		if next < len(addrs) {
+			start()
+			t.Reset(delay)
+		}
+	}
+
+	return zero, nil, kleverr.Newf("cannot dial any address: %w", errors.Join(errs...))
+}
@@ -0,0 +1,69 @@
+package netc
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveUDPAddrs(t *testing.T) {
+	addrs, err := ResolveUDPAddrs(context.Background(), "127.0.0.1:19190")
+	require.NoError(t, err)
+	require.Len(t, addrs, 1)
+	require.Equal(t, "127.0.0.1:19190", addrs[0].String())
+
+	addrs, err = ResolveUDPAddrs(context.Background(), "[::1]:19190")
+	require.NoError(t, err)
+	require.Equal(t, "[::1]:19190", addrs[0].String())
+
+	_, err = ResolveUDPAddrs(context.Background(), "localhost")
+	require.Error(t, err)
+}
+
+func TestDialHappyEyeballs(t *testing.T) {
+	addrs := []*net.UDPAddr{
+		{IP: net.ParseIP("::1"), Port: 1},
+		{IP: net.ParseIP("127.0.0.1"), Port: 2},
+		{IP: net.ParseIP("127.0.0.1"), Port: 3},
+	}
+
+	t.Run("slow first", func(t *testing.T) {
+		conn, addr, err := DialHappyEyeballs(context.Background(), addrs, 10*time.Millisecond,
+			func(ctx context.Context, addr *net.UDPAddr) (int, error) {
+				if addr.Port == 1 {
+					<-ctx.Done()
+					return 0, ctx.Err()
+				}
+				return addr.Port, nil
+			}, func(int) {})
+		require.NoError(t, err)
+		require.Equal(t, 2, conn)
+		require.Equal(t, addrs[1], addr)
+	})
+
+	t.Run("failing first", func(t *testing.T) {
+		start := time.Now()
+		conn, _, err := DialHappyEyeballs(context.Background(), addrs, time.Hour,
+			func(ctx context.Context, addr *net.UDPAddr) (int, error) {
+				if addr.Port < 3 {
+					return 0, errors.New("unreachable")
+				}
+				return addr.Port, nil
+			}, func(int) {})
+		require.NoError(t, err)
+		require.Equal(t, 3, conn)
+		require.Less(t, time.Since(start), time.Second)
+	})
+
+	t.Run("all failing", func(t *testing.T) {
+		_, _, err := DialHappyEyeballs(context.Background(), addrs, time.Millisecond,
+			func(ctx context.Context, addr *net.UDPAddr) (int, error) {
+				return 0, errors.New("unreachable")
+			}, func(int) {})
+		require.ErrorContains(t, err, "unreachable")
+	})
+}
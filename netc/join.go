@@ -2,22 +2,186 @@ package netc
 
 import (
 	"context"
+	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
 )
 
-func Join(ctx context.Context, l io.ReadWriteCloser, r io.ReadWriteCloser) error {
-	g, _ := errgroup.WithContext(ctx)
-	g.Go(func() error {
-		defer l.Close()
-		_, err := io.Copy(l, r)
-		return err
-	})
-	g.Go(func() error {
-		defer r.Close()
-		_, err := io.Copy(r, l)
-		return err
-	})
-	return g.Wait()
+// HalfClosedIdleTimeout is how long Join keeps the remaining direction of a half-closed join open without data,
+// unless JoinTimeouts.Idle is shorter
+const HalfClosedIdleTimeout = 2 * time.Minute
+
+var (
+	ErrJoinIdle     = errors.New("join idle timeout")
+	ErrJoinLifetime = errors.New("join max lifetime")
+)
+
+// JoinTimeouts limit how long Join keeps both ends open, zero disables a timeout
+type JoinTimeouts struct {
+	Idle        time.Duration // without data flowing in either direction
+	MaxLifetime time.Duration // since the join started
+}
+
+// Join copies between l and r in both directions. When one direction reaches EOF, the write side of its destination
+// is shut down (CloseWrite for tcp and unix conns, Close for quic streams), while the other direction keeps flowing.
+// Both are closed once both directions finish, either direction fails, ctx is done or one of the timeouts passes
+// (returning ErrJoinIdle or ErrJoinLifetime).
+func Join(ctx context.Context, l io.ReadWriteCloser, r io.ReadWriteCloser, timeouts JoinTimeouts) error {
+	return join(ctx, l, r, timeouts, HalfClosedIdleTimeout)
+}
+
+func join(ctx context.Context, l io.ReadWriteCloser, r io.ReadWriteCloser, timeouts JoinTimeouts, halfClosedTimeout time.Duration) error {
+	var active atomic.Int64
+	active.Store(time.Now().UnixNano())
+
+	var closeOnce sync.Once
+	var closeErr error
+	closeBoth := func(err error) {
+		closeOnce.Do(func() {
+			closeErr = err
+			closeFull(l)
+			closeFull(r)
+		})
+	}
+
+	halfClosed := make(chan struct{})
+	var halfOnce sync.Once
+	copyHalf := func(dst, src io.ReadWriteCloser) error {
+		if _, err := io.Copy(dst, &activeReader{src, &active}); err != nil {
+			closeBoth(err)
+			return err
+		}
+		if err := closeWrite(dst); err != nil {
+			closeBoth(err)
+			return err
+		}
+		halfOnce.Do(func() { close(halfClosed) })
+		return nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		var lifetime <-chan time.Time
+		if timeouts.MaxLifetime > 0 {
+			t := time.NewTimer(timeouts.MaxLifetime)
+			defer t.Stop()
+			lifetime = t.C
+		}
+
+		idleTimer := time.NewTimer(time.Hour)
+		defer idleTimer.Stop()
+
+		halfCh := halfClosed
+		idleTimeout := timeouts.Idle
+		for {
+			var idleCh <-chan time.Time
+			if idleTimeout > 0 {
+				wait := idleTimeout - time.Since(time.Unix(0, active.Load()))
+				if wait <= 0 {
+					closeBoth(ErrJoinIdle)
+					return
+				}
+				idleTimer.Reset(wait)
+				idleCh = idleTimer.C
+			}
+
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				closeBoth(ctx.Err())
+				return
+			case <-lifetime:
+				closeBoth(ErrJoinLifetime)
+				return
+			case <-halfCh:
+				halfCh = nil
+				if idleTimeout == 0 || idleTimeout > halfClosedTimeout {
+					idleTimeout = halfClosedTimeout
+				}
+			case <-idleCh:
+			}
+		}
+	}()
+
+	var g errgroup.Group
+	g.Go(func() error { return copyHalf(l, r) })
+	g.Go(func() error { return copyHalf(r, l) })
+	err := g.Wait()
+	close(done)
+	closeBoth(nil)
+
+	if closeErr != nil {
+		// the reason the join was cut short, instead of the errors from using the closed ends
+		return closeErr
+	}
+	return err
+}
+
+// JoinReaped counts the joins closed by their JoinTimeouts
+type JoinReaped struct {
+	idle     atomic.Uint64
+	lifetime atomic.Uint64
+}
+
+// Record counts err returned by Join, reporting if the join was closed by one of its timeouts
+func (r *JoinReaped) Record(err error) bool {
+	switch {
+	case errors.Is(err, ErrJoinIdle):
+		r.idle.Add(1)
+		return true
+	case errors.Is(err, ErrJoinLifetime):
+		r.lifetime.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+// Idle is the number of joins closed for being idle
+func (r *JoinReaped) Idle() uint64 {
+	return r.idle.Load()
+}
+
+// Lifetime is the number of joins closed at their max lifetime
+func (r *JoinReaped) Lifetime() uint64 {
+	return r.lifetime.Load()
+}
+
+type activeReader struct {
+	io.Reader
+	active *atomic.Int64
+}
+
+func (r *activeReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if n > 0 {
+		r.active.Store(time.Now().UnixNano())
+	}
+	return n, err
+}
+
+// closeWrite shuts down the write side of c, or closes it when it cannot be half-closed
+func closeWrite(c io.ReadWriteCloser) error {
+	switch c := c.(type) {
+	case interface{ CloseWrite() error }:
+		return c.CloseWrite()
+	case quic.Stream:
+		return c.Close() // only closes the send side
+	default:
+		return c.Close()
+	}
+}
+
+// closeFull closes both sides of c
+func closeFull(c io.ReadWriteCloser) {
+	if s, ok := c.(quic.Stream); ok {
+		s.CancelRead(0)
+	}
+	c.Close()
 }
@@ -0,0 +1,201 @@
+package netc
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/quic-go/quic-go"
+	"github.com/stretchr/testify/require"
+)
+
+type pairFunc func(t *testing.T) (io.ReadWriteCloser, io.ReadWriteCloser)
+
+var pairs = map[string]pairFunc{
+	"tcp":  tcpPair,
+	"unix": unixPair,
+	"quic": quicPair,
+}
+
+func TestJoinHalfClose(t *testing.T) {
+	for name, pair := range pairs {
+		t.Run(name, func(t *testing.T) {
+			t.Run("left-to-right", func(t *testing.T) {
+				l, r, joined := testJoin(t, pair, JoinTimeouts{}, time.Minute)
+				testExchange(t, l, r)
+				require.NoError(t, <-joined)
+			})
+			t.Run("right-to-left", func(t *testing.T) {
+				l, r, joined := testJoin(t, pair, JoinTimeouts{}, time.Minute)
+				testExchange(t, r, l)
+				require.NoError(t, <-joined)
+			})
+		})
+	}
+}
+
+func TestJoinHalfClosedIdle(t *testing.T) {
+	for name, pair := range pairs {
+		t.Run(name, func(t *testing.T) {
+			l, _, joined := testJoin(t, pair, JoinTimeouts{}, 50*time.Millisecond)
+			require.NoError(t, closeWrite(l))
+			requireJoined(t, joined, ErrJoinIdle)
+		})
+	}
+}
+
+func TestJoinTimeouts(t *testing.T) {
+	t.Run("idle", func(t *testing.T) {
+		l, r, joined := testJoin(t, tcpPair, JoinTimeouts{Idle: 200 * time.Millisecond}, time.Minute)
+		// traffic keeps the join open past the idle timeout
+		for range 4 {
+			time.Sleep(100 * time.Millisecond)
+			_, err := l.Write([]byte("ping"))
+			require.NoError(t, err)
+			_, err = io.ReadFull(r, make([]byte, 4))
+			require.NoError(t, err)
+		}
+		requireJoined(t, joined, ErrJoinIdle)
+	})
+
+	t.Run("lifetime", func(t *testing.T) {
+		l, r, joined := testJoin(t, tcpPair, JoinTimeouts{Idle: time.Minute, MaxLifetime: 200 * time.Millisecond}, time.Minute)
+		_, err := l.Write([]byte("ping"))
+		require.NoError(t, err)
+		_, err = io.ReadFull(r, make([]byte, 4))
+		require.NoError(t, err)
+		requireJoined(t, joined, ErrJoinLifetime)
+	})
+}
+
+func TestJoinReaped(t *testing.T) {
+	var reaped JoinReaped
+	require.True(t, reaped.Record(ErrJoinIdle))
+	require.True(t, reaped.Record(ErrJoinLifetime))
+	require.True(t, reaped.Record(ErrJoinLifetime))
+	require.False(t, reaped.Record(nil))
+	require.False(t, reaped.Record(context.Canceled))
+	require.Equal(t, uint64(1), reaped.Idle())
+	require.Equal(t, uint64(2), reaped.Lifetime())
+}
+
+func requireJoined(t *testing.T, joined <-chan error, expected error) {
+	select {
+	case err := <-joined:
+		require.ErrorIs(t, err, expected)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "join did not time out")
+	}
+}
+
+func TestJoinCancel(t *testing.T) {
+	ll, lr := tcpPair(t)
+	rl, rr := tcpPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	joined := make(chan error, 1)
+	go func() { joined <- join(ctx, lr, rl, JoinTimeouts{}, time.Minute) }()
+
+	cancel()
+	require.ErrorIs(t, <-joined, context.Canceled)
+
+	// both outer ends see the join closed
+	_, err := io.ReadAll(ll)
+	require.NoError(t, err)
+	_, err = io.ReadAll(rr)
+	require.NoError(t, err)
+}
+
+// testJoin joins the inner ends of two pairs, returning their outer ends
+func testJoin(t *testing.T, pair pairFunc, timeouts JoinTimeouts, halfClosedTimeout time.Duration) (io.ReadWriteCloser, io.ReadWriteCloser, <-chan error) {
+	ll, lr := pair(t)
+	rl, rr := pair(t)
+	joined := make(chan error, 1)
+	go func() { joined <- join(context.Background(), lr, rl, timeouts, halfClosedTimeout) }()
+	return ll, rr, joined
+}
+
+// testExchange sends a request from a, which it half-closes, and then reads the response from b until EOF
+func testExchange(t *testing.T, a, b io.ReadWriteCloser) {
+	_, err := a.Write([]byte("request"))
+	require.NoError(t, err)
+	require.NoError(t, closeWrite(a))
+
+	req, err := io.ReadAll(b)
+	require.NoError(t, err)
+	require.Equal(t, "request", string(req))
+
+	_, err = b.Write([]byte("response"))
+	require.NoError(t, err)
+	require.NoError(t, closeWrite(b))
+
+	resp, err := io.ReadAll(a)
+	require.NoError(t, err)
+	require.Equal(t, "response", string(resp))
+}
+
+func tcpPair(t *testing.T) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return streamPair(t, l)
+}
+
+func unixPair(t *testing.T) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	l, err := net.Listen("unix", t.TempDir()+"/join.sock")
+	require.NoError(t, err)
+	defer l.Close()
+	return streamPair(t, l)
+}
+
+func streamPair(t *testing.T, l net.Listener) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	dialed, err := net.Dial(l.Addr().Network(), l.Addr().String())
+	require.NoError(t, err)
+	accepted, err := l.Accept()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		dialed.Close()
+		accepted.Close()
+	})
+	return dialed, accepted
+}
+
+func quicPair(t *testing.T) (io.ReadWriteCloser, io.ReadWriteCloser) {
+	cert, cas, err := certc.SelfSigned("localhost")
+	require.NoError(t, err)
+
+	l, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"connet-test"},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	ctx := context.Background()
+	dialed, err := quic.DialAddr(ctx, l.Addr().String(), &tls.Config{
+		RootCAs:    cas,
+		ServerName: "localhost",
+		NextProtos: []string{"connet-test"},
+	}, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { dialed.CloseWithError(0, "done") })
+
+	accepted, err := l.Accept(ctx)
+	require.NoError(t, err)
+
+	opened, err := dialed.OpenStream()
+	require.NoError(t, err)
+	// the peer only sees a stream once data is sent on it
+	_, err = opened.Write([]byte{0})
+	require.NoError(t, err)
+
+	stream, err := accepted.AcceptStream(ctx)
+	require.NoError(t, err)
+	_, err = io.ReadFull(stream, make([]byte, 1))
+	require.NoError(t, err)
+
+	return opened, stream
+}
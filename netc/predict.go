@@ -0,0 +1,37 @@
+package netc
+
+import (
+	"net/netip"
+	"slices"
+)
+
+// PredictAddrs returns addrs, extended with public and the next n ports
+// a sequentially allocating NAT would assign after it. NATs which preserve
+// ports (e.g. public port matches one of the local ports) need no prediction.
+func PredictAddrs(addrs []netip.AddrPort, public netip.AddrPort, n int) []netip.AddrPort {
+	result := slices.Clone(addrs)
+	if !public.IsValid() {
+		return result
+	}
+	if !slices.Contains(result, public) {
+		result = append(result, public)
+	}
+
+	for _, addr := range addrs {
+		if addr.Port() == public.Port() {
+			return result
+		}
+	}
+
+	for i := 1; i <= n; i++ {
+		port := int(public.Port()) + i
+		if port > 65535 {
+			break
+		}
+		predicted := netip.AddrPortFrom(public.Addr(), uint16(port))
+		if !slices.Contains(result, predicted) {
+			result = append(result, predicted)
+		}
+	}
+	return result
+}
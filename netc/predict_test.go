@@ -0,0 +1,40 @@
+package netc
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPredictAddrs(t *testing.T) {
+	local := netip.MustParseAddrPort("192.168.1.2:19192")
+
+	t.Run("preserving", func(t *testing.T) {
+		public := netip.MustParseAddrPort("1.2.3.4:19192")
+		addrs := PredictAddrs([]netip.AddrPort{local, public}, public, 3)
+		require.Equal(t, []netip.AddrPort{local, public}, addrs)
+	})
+
+	t.Run("sequential", func(t *testing.T) {
+		public := netip.MustParseAddrPort("1.2.3.4:40000")
+		addrs := PredictAddrs([]netip.AddrPort{local}, public, 2)
+		require.Equal(t, []netip.AddrPort{
+			local,
+			public,
+			netip.MustParseAddrPort("1.2.3.4:40001"),
+			netip.MustParseAddrPort("1.2.3.4:40002"),
+		}, addrs)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		public := netip.MustParseAddrPort("1.2.3.4:65535")
+		addrs := PredictAddrs([]netip.AddrPort{local}, public, 2)
+		require.Equal(t, []netip.AddrPort{local, public}, addrs)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		addrs := PredictAddrs([]netip.AddrPort{local}, netip.AddrPort{}, 2)
+		require.Equal(t, []netip.AddrPort{local}, addrs)
+	})
+}
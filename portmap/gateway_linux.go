@@ -0,0 +1,42 @@
+package portmap
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/klev-dev/kleverr"
+)
+
+// discoverGateway finds the default ipv4 gateway in the kernel routing table
+func discoverGateway() (netip.Addr, error) {
+	f, err := os.Open("/proc/net/route")
+	if err != nil {
+		return netip.Addr{}, kleverr.Newf("cannot read routes: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[1] != "00000000" {
+			continue
+		}
+		gw, err := hex.DecodeString(fields[2])
+		if err != nil || len(gw) != 4 {
+			continue
+		}
+		var ip [4]byte
+		binary.LittleEndian.PutUint32(ip[:], binary.BigEndian.Uint32(gw))
+		if addr := netip.AddrFrom4(ip); !addr.IsUnspecified() {
+			return addr, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return netip.Addr{}, kleverr.Newf("cannot read routes: %w", err)
+	}
+	return netip.Addr{}, kleverr.New("no default gateway found")
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+
+package portmap
+
+import (
+	"net/netip"
+
+	"github.com/klev-dev/kleverr"
+)
+
+// discoverGateway is only implemented on linux, elsewhere the gateway needs to be configured
+func discoverGateway() (netip.Addr, error) {
+	return netip.Addr{}, kleverr.New("gateway discovery not supported, configure the gateway explicitly")
+}
@@ -0,0 +1,253 @@
+package portmap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+const (
+	natpmpPort    = "5351"
+	natpmpRetries = 3
+	natpmpTimeout = 250 * time.Millisecond
+)
+
+// gatewayAddr returns the NAT-PMP/PCP server address
+func (m *Mapper) gatewayAddr() (string, error) {
+	if m.gateway != "" {
+		if _, _, err := net.SplitHostPort(m.gateway); err != nil {
+			return net.JoinHostPort(m.gateway, natpmpPort), nil
+		}
+		return m.gateway, nil
+	}
+
+	gw, err := discoverGateway()
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(gw.String(), natpmpPort), nil
+}
+
+// gatewayRequest sends req to the gateway, retrying with increasing timeouts until
+// a response is accepted by check
+func (m *Mapper) gatewayRequest(ctx context.Context, req []byte, check func(resp []byte) bool) ([]byte, netip.Addr, error) {
+	addr, err := m.gatewayAddr()
+	if err != nil {
+		return nil, netip.Addr{}, err
+	}
+
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, netip.Addr{}, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	local := conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr()
+
+	buf := make([]byte, 1100)
+	timeout := natpmpTimeout
+	for range natpmpRetries {
+		if _, err := conn.Write(req); err != nil {
+			return nil, local, err
+		}
+
+		deadline := time.Now().Add(timeout)
+		conn.SetReadDeadline(deadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, local, ctx.Err()
+				}
+				if nerr, ok := err.(net.Error); ok && nerr.Timeout() {
+					break
+				}
+				return nil, local, err
+			}
+			if check(buf[:n]) {
+				return buf[:n], local, nil
+			}
+		}
+		timeout *= 2
+	}
+	return nil, local, kleverr.Newf("no response from gateway %s", addr)
+}
+
+// natpmp implements RFC 6886
+type natpmp struct {
+	m *Mapper
+}
+
+func (p *natpmp) name() string {
+	return "nat-pmp"
+}
+
+func (p *natpmp) mapPort(ctx context.Context, port uint16, lifetime time.Duration) (netip.AddrPort, time.Duration, error) {
+	extReq := []byte{0, 0}
+	extResp, _, err := p.m.gatewayRequest(ctx, extReq, func(resp []byte) bool {
+		return len(resp) >= 12 && resp[0] == 0 && resp[1] == 128
+	})
+	if err != nil {
+		return netip.AddrPort{}, 0, err
+	}
+	if code := binary.BigEndian.Uint16(extResp[2:4]); code != 0 {
+		return netip.AddrPort{}, 0, kleverr.Newf("external address request failed with code %d", code)
+	}
+	external := netip.AddrFrom4([4]byte(extResp[8:12]))
+
+	mapReq := make([]byte, 12)
+	mapReq[1] = 1 // map udp
+	binary.BigEndian.PutUint16(mapReq[4:6], port)
+	binary.BigEndian.PutUint16(mapReq[6:8], port)
+	binary.BigEndian.PutUint32(mapReq[8:12], uint32(lifetime.Seconds()))
+	mapResp, _, err := p.m.gatewayRequest(ctx, mapReq, func(resp []byte) bool {
+		return len(resp) >= 16 && resp[0] == 0 && resp[1] == 129 && binary.BigEndian.Uint16(resp[8:10]) == port
+	})
+	if err != nil {
+		return netip.AddrPort{}, 0, err
+	}
+	if code := binary.BigEndian.Uint16(mapResp[2:4]); code != 0 {
+		return netip.AddrPort{}, 0, kleverr.Newf("map request failed with code %d", code)
+	}
+
+	externalPort := binary.BigEndian.Uint16(mapResp[10:12])
+	grantedLifetime := time.Duration(binary.BigEndian.Uint32(mapResp[12:16])) * time.Second
+	return netip.AddrPortFrom(external, externalPort), grantedLifetime, nil
+}
+
+func (p *natpmp) unmapPort(ctx context.Context, port uint16) error {
+	req := make([]byte, 12)
+	req[1] = 1 // map udp, zero lifetime and external port means delete
+	binary.BigEndian.PutUint16(req[4:6], port)
+	_, _, err := p.m.gatewayRequest(ctx, req, func(resp []byte) bool {
+		return len(resp) >= 16 && resp[0] == 0 && resp[1] == 129
+	})
+	return err
+}
+
+// pcp implements the MAP opcode of RFC 6887
+type pcp struct {
+	m *Mapper
+
+	// the mapping nonce of each port, refreshes and deletes must repeat the one used to create it
+	nonces   map[uint16][12]byte
+	noncesMu sync.Mutex
+}
+
+func (p *pcp) nonce(port uint16) ([12]byte, error) {
+	p.noncesMu.Lock()
+	defer p.noncesMu.Unlock()
+
+	if nonce, ok := p.nonces[port]; ok {
+		return nonce, nil
+	}
+
+	var nonce [12]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nonce, err
+	}
+	if p.nonces == nil {
+		p.nonces = map[uint16][12]byte{}
+	}
+	p.nonces[port] = nonce
+	return nonce, nil
+}
+
+func (p *pcp) forgetNonce(port uint16) {
+	p.noncesMu.Lock()
+	defer p.noncesMu.Unlock()
+
+	delete(p.nonces, port)
+}
+
+func (p *pcp) name() string {
+	return "pcp"
+}
+
+func (p *pcp) request(ctx context.Context, port uint16, lifetime time.Duration) ([]byte, error) {
+	nonce, err := p.nonce(port)
+	if err != nil {
+		return nil, err
+	}
+
+	addr, err := p.m.gatewayAddr()
+	if err != nil {
+		return nil, err
+	}
+	local, err := localAddrTo(ctx, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	req := make([]byte, 60)
+	req[0] = 2 // version
+	req[1] = 1 // map
+	binary.BigEndian.PutUint32(req[4:8], uint32(lifetime.Seconds()))
+	clientIP := local.As16()
+	copy(req[8:24], clientIP[:])
+	copy(req[24:36], nonce[:])
+	req[36] = 17 // udp
+	binary.BigEndian.PutUint16(req[40:42], port)
+	binary.BigEndian.PutUint16(req[42:44], port)
+	if local.Is4() {
+		unspecified := netip.IPv4Unspecified().As16()
+		copy(req[44:60], unspecified[:])
+	}
+
+	resp, _, err := p.m.gatewayRequest(ctx, req, func(resp []byte) bool {
+		if len(resp) < 4 || resp[1] != 0x81 {
+			return false
+		}
+		// an unsupported version response might not carry the map data
+		return resp[3] != 0 || (len(resp) >= 60 && [12]byte(resp[24:36]) == nonce)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp[0] != 2 {
+		return nil, kleverr.Newf("unsupported version %d", resp[0])
+	}
+	if code := resp[3]; code != 0 {
+		return nil, kleverr.Newf("map request failed with code %d", code)
+	}
+	return resp, nil
+}
+
+func (p *pcp) mapPort(ctx context.Context, port uint16, lifetime time.Duration) (netip.AddrPort, time.Duration, error) {
+	resp, err := p.request(ctx, port, lifetime)
+	if err != nil {
+		return netip.AddrPort{}, 0, err
+	}
+
+	grantedLifetime := time.Duration(binary.BigEndian.Uint32(resp[4:8])) * time.Second
+	externalPort := binary.BigEndian.Uint16(resp[42:44])
+	external := netip.AddrFrom16([16]byte(resp[44:60])).Unmap()
+	return netip.AddrPortFrom(external, externalPort), grantedLifetime, nil
+}
+
+func (p *pcp) unmapPort(ctx context.Context, port uint16) error {
+	defer p.forgetNonce(port)
+	_, err := p.request(ctx, port, 0)
+	return err
+}
+
+// localAddrTo returns the local address used to reach addr
+func localAddrTo(ctx context.Context, addr string) (netip.Addr, error) {
+	conn, err := (&net.Dialer{}).DialContext(ctx, "udp", addr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).AddrPort().Addr().Unmap(), nil
+}
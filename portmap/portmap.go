@@ -0,0 +1,157 @@
+package portmap
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"time"
+
+	"github.com/connet-dev/connet/netc"
+	"github.com/connet-dev/connet/notify"
+	"github.com/klev-dev/kleverr"
+)
+
+type Config struct {
+	Port     uint16        // the local udp port to map
+	Gateway  string        // NAT-PMP/PCP gateway host[:port], discovered from the routing table if empty
+	SSDPAddr string        // UPnP discovery address, defaults to 239.255.255.250:1900
+	Lifetime time.Duration // requested mapping lifetime, defaults to 2h
+	Logger   *slog.Logger
+}
+
+// Mapper asks the local gateway to forward an external port to Port, using PCP, NAT-PMP or UPnP-IGD
+// (whichever works first), and keeps renewing the mapping until stopped.
+type Mapper struct {
+	port      uint16
+	gateway   string
+	ssdpAddr  string
+	lifetime  time.Duration
+	protocols []protocol
+	external  *notify.V[netip.AddrPort]
+	logger    *slog.Logger
+}
+
+type protocol interface {
+	name() string
+	mapPort(ctx context.Context, port uint16, lifetime time.Duration) (netip.AddrPort, time.Duration, error)
+	unmapPort(ctx context.Context, port uint16) error
+}
+
+func New(cfg Config) (*Mapper, error) {
+	if cfg.Port == 0 {
+		return nil, kleverr.New("missing port to map")
+	}
+	if cfg.SSDPAddr == "" {
+		cfg.SSDPAddr = "239.255.255.250:1900"
+	}
+	if cfg.Lifetime == 0 {
+		cfg.Lifetime = 2 * time.Hour
+	}
+
+	m := &Mapper{
+		port:     cfg.Port,
+		gateway:  cfg.Gateway,
+		ssdpAddr: cfg.SSDPAddr,
+		lifetime: cfg.Lifetime,
+		external: notify.New(netip.AddrPort{}),
+		logger:   cfg.Logger.With("portmap", cfg.Port),
+	}
+	m.protocols = []protocol{&pcp{m: m}, &natpmp{m}, &upnp{m}}
+	return m, nil
+}
+
+// Listen calls f with the currently mapped external address, or an invalid address when there is no mapping
+func (m *Mapper) Listen(ctx context.Context, f func(netip.AddrPort) error) error {
+	return m.external.Listen(ctx, f)
+}
+
+func (m *Mapper) Run(ctx context.Context) error {
+	var active protocol
+	defer func() {
+		if active == nil {
+			return
+		}
+		unmapCtx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := active.unmapPort(unmapCtx, m.port); err != nil {
+			m.logger.Debug("could not remove mapping", "protocol", active.name(), "err", err)
+		}
+	}()
+
+	boff := time.Second
+	for {
+		addr, lifetime, proto, err := m.mapPort(ctx, active)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return err
+			}
+			m.logger.Debug("could not map port", "err", err)
+			active = nil
+			m.setExternal(netip.AddrPort{})
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(boff):
+				boff = netc.NextBackoffCustom(boff, time.Second, 5*time.Minute)
+			}
+			continue
+		}
+		boff = time.Second
+
+		if active == nil || active.name() != proto.name() {
+			m.logger.Info("mapped port", "protocol", proto.name(), "external", addr, "lifetime", lifetime)
+		}
+		active = proto
+		m.setExternal(addr)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(renewInterval(lifetime)):
+		}
+	}
+}
+
+// minRenewInterval keeps short lifetimes granted by gateways from renewing the mapping in a tight loop
+const minRenewInterval = 30 * time.Second
+
+// renewInterval is halfway through the granted lifetime, but not sooner than minRenewInterval
+func renewInterval(lifetime time.Duration) time.Duration {
+	return max(lifetime/2, minRenewInterval)
+}
+
+func (m *Mapper) setExternal(addr netip.AddrPort) {
+	m.external.UpdateOpt(func(current netip.AddrPort) (netip.AddrPort, bool) {
+		return addr, current != addr
+	})
+}
+
+// mapPort tries the last working protocol first, then all others in order
+func (m *Mapper) mapPort(ctx context.Context, last protocol) (netip.AddrPort, time.Duration, protocol, error) {
+	protocols := m.protocols
+	if last != nil {
+		protocols = append([]protocol{last}, slices.DeleteFunc(slices.Clone(protocols), func(p protocol) bool {
+			return p == last
+		})...)
+	}
+
+	var errs []error
+	for _, proto := range protocols {
+		addr, lifetime, err := proto.mapPort(ctx, m.port, m.lifetime)
+		if err == nil && lifetime <= 0 {
+			err = kleverr.New("gateway granted no lifetime")
+		}
+		if err == nil {
+			return addr, lifetime, proto, nil
+		}
+		if ctx.Err() != nil {
+			return netip.AddrPort{}, 0, nil, ctx.Err()
+		}
+		m.logger.Debug("port mapping failed", "protocol", proto.name(), "err", err)
+		errs = append(errs, kleverr.Newf("%s: %w", proto.name(), err))
+	}
+	return netip.AddrPort{}, 0, nil, errors.Join(errs...)
+}
@@ -0,0 +1,348 @@
+package portmap
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var testExternal = netip.MustParseAddr("203.0.113.7")
+
+// fakeGateway answers NAT-PMP/PCP requests on a local udp port using handle
+func fakeGateway(t *testing.T, handle func(req []byte) []byte) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 1100)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if resp := handle(buf[:n]); resp != nil {
+				conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String()
+}
+
+// closedPort returns a local udp address nothing listens on
+func closedPort(t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := conn.LocalAddr().String()
+	require.NoError(t, conn.Close())
+	return addr
+}
+
+func runMapper(t *testing.T, cfg Config) (netip.AddrPort, func()) {
+	cfg.Port = 19192
+	cfg.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	m, err := New(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- m.Run(ctx) }()
+
+	addrCh := make(chan netip.AddrPort, 1)
+	go m.Listen(ctx, func(addr netip.AddrPort) error {
+		if addr.IsValid() {
+			select {
+			case addrCh <- addr:
+			default:
+			}
+		}
+		return nil
+	})
+
+	var addr netip.AddrPort
+	select {
+	case addr = <-addrCh:
+	case err := <-done:
+		require.FailNow(t, "mapper stopped", "err: %v", err)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "mapping timed out")
+	}
+
+	return addr, func() {
+		cancel()
+		require.ErrorIs(t, <-done, context.Canceled)
+	}
+}
+
+func TestPCP(t *testing.T) {
+	var unmapped atomic.Bool
+	gw := fakeGateway(t, func(req []byte) []byte {
+		if len(req) != 60 || req[0] != 2 || req[1] != 1 {
+			return nil
+		}
+		lifetime := binary.BigEndian.Uint32(req[4:8])
+		if lifetime == 0 {
+			unmapped.Store(true)
+		}
+
+		resp := make([]byte, 60)
+		copy(resp, req)
+		resp[1] = 0x81
+		resp[3] = 0
+		binary.BigEndian.PutUint32(resp[4:8], lifetime)
+		binary.BigEndian.PutUint16(resp[42:44], 29192)
+		ext := testExternal.As16()
+		copy(resp[44:60], ext[:])
+		return resp
+	})
+
+	addr, stop := runMapper(t, Config{Gateway: gw, Lifetime: time.Minute})
+	require.Equal(t, netip.AddrPortFrom(testExternal, 29192), addr)
+
+	stop()
+	require.True(t, unmapped.Load())
+}
+
+func TestPCPNonce(t *testing.T) {
+	var mu sync.Mutex
+	var nonces [][12]byte
+	gw := fakeGateway(t, func(req []byte) []byte {
+		if len(req) != 60 || req[0] != 2 || req[1] != 1 {
+			return nil
+		}
+		mu.Lock()
+		nonces = append(nonces, [12]byte(req[24:36]))
+		mu.Unlock()
+
+		resp := make([]byte, 60)
+		copy(resp, req)
+		resp[1] = 0x81
+		resp[3] = 0
+		binary.BigEndian.PutUint16(resp[42:44], 29192)
+		ext := testExternal.As16()
+		copy(resp[44:60], ext[:])
+		return resp
+	})
+
+	m, err := New(Config{Gateway: gw, Port: 19192, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, err)
+	p := &pcp{m: m}
+
+	ctx := context.Background()
+	for range 2 {
+		_, _, err := p.mapPort(ctx, 19192, time.Minute)
+		require.NoError(t, err)
+	}
+	require.NoError(t, p.unmapPort(ctx, 19192))
+	_, _, err = p.mapPort(ctx, 19192, time.Minute)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, nonces, 4)
+	// the renewal and the delete repeat the nonce which created the mapping
+	require.Equal(t, nonces[0], nonces[1])
+	require.Equal(t, nonces[0], nonces[2])
+	// a new mapping after the delete uses a fresh one
+	require.NotEqual(t, nonces[0], nonces[3])
+}
+
+func TestNATPMP(t *testing.T) {
+	var unmapped atomic.Bool
+	gw := fakeGateway(t, func(req []byte) []byte {
+		switch {
+		case req[0] != 0:
+			// respond to PCP as a NAT-PMP only gateway would
+			return []byte{0, 128 + (req[1] & 0x7f), 0, 1, 0, 0, 0, 0}
+		case req[1] == 0:
+			resp := make([]byte, 12)
+			resp[1] = 128
+			ext := testExternal.As4()
+			copy(resp[8:12], ext[:])
+			return resp
+		case req[1] == 1 && len(req) == 12:
+			lifetime := binary.BigEndian.Uint32(req[8:12])
+			if lifetime == 0 {
+				unmapped.Store(true)
+			}
+			resp := make([]byte, 16)
+			resp[1] = 129
+			copy(resp[8:10], req[4:6])
+			binary.BigEndian.PutUint16(resp[10:12], 39192)
+			binary.BigEndian.PutUint32(resp[12:16], lifetime)
+			return resp
+		}
+		return nil
+	})
+
+	addr, stop := runMapper(t, Config{Gateway: gw, Lifetime: time.Minute})
+	require.Equal(t, netip.AddrPortFrom(testExternal, 39192), addr)
+
+	stop()
+	require.True(t, unmapped.Load())
+}
+
+// fakeIGD serves an UPnP-IGD description and answers its control actions using handle, returning the ssdp address
+func fakeIGD(t *testing.T, handle func(w http.ResponseWriter, action string, body string)) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/desc.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+<device>
+  <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+  <deviceList><device>
+    <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+    <deviceList><device>
+      <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+      <serviceList><service>
+        <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+        <controlURL>/ctl/IPConn</controlURL>
+      </service></serviceList>
+    </device></deviceList>
+  </device></deviceList>
+</device>
+</root>`)
+	})
+	mux.HandleFunc("/ctl/IPConn", func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		action := r.Header.Get("SOAPAction")
+		switch {
+		case strings.HasSuffix(action, `#GetExternalIPAddress"`):
+			fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+				`<u:GetExternalIPAddressResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewExternalIPAddress>%s</NewExternalIPAddress></u:GetExternalIPAddressResponse></s:Body></s:Envelope>`, testExternal)
+		default:
+			handle(w, action, string(body))
+		}
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	return fakeGateway(t, func(req []byte) []byte {
+		if !strings.HasPrefix(string(req), "M-SEARCH") {
+			return nil
+		}
+		return []byte(fmt.Sprintf("HTTP/1.1 200 OK\r\nST: urn:schemas-upnp-org:device:InternetGatewayDevice:1\r\nLOCATION: %s/desc.xml\r\n\r\n", srv.URL))
+	})
+}
+
+func TestUPnP(t *testing.T) {
+	var added, deleted atomic.Bool
+	ssdp := fakeIGD(t, func(w http.ResponseWriter, action string, body string) {
+		switch {
+		case strings.HasSuffix(action, `#AddPortMapping"`):
+			if strings.Contains(body, "<NewExternalPort>19192</NewExternalPort>") &&
+				strings.Contains(body, "<NewInternalClient>127.0.0.1</NewInternalClient>") {
+				added.Store(true)
+			}
+		case strings.HasSuffix(action, `#DeletePortMapping"`):
+			deleted.Store(true)
+		default:
+			http.Error(w, "unknown action", http.StatusInternalServerError)
+		}
+	})
+
+	addr, stop := runMapper(t, Config{Gateway: closedPort(t), SSDPAddr: ssdp, Lifetime: time.Minute})
+	require.Equal(t, netip.AddrPortFrom(testExternal, 19192), addr)
+	require.True(t, added.Load())
+
+	stop()
+	require.True(t, deleted.Load())
+}
+
+func TestUPnPPermanentLease(t *testing.T) {
+	var leases []string
+	var leasesMu sync.Mutex
+	ssdp := fakeIGD(t, func(w http.ResponseWriter, action string, body string) {
+		switch {
+		case strings.HasSuffix(action, `#AddPortMapping"`):
+			lease := body[strings.Index(body, "<NewLeaseDuration>")+len("<NewLeaseDuration>") : strings.Index(body, "</NewLeaseDuration>")]
+			leasesMu.Lock()
+			leases = append(leases, lease)
+			leasesMu.Unlock()
+			if lease != "0" {
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+					`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+					`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>725</errorCode>`+
+					`<errorDescription>OnlyPermanentLeasesSupported</errorDescription></UPnPError>`+
+					`</detail></s:Fault></s:Body></s:Envelope>`)
+			}
+		case strings.HasSuffix(action, `#GetSpecificPortMappingEntry"`):
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+				`<u:GetSpecificPortMappingEntryResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewLeaseDuration>0</NewLeaseDuration></u:GetSpecificPortMappingEntryResponse></s:Body></s:Envelope>`)
+		}
+	})
+
+	m, err := New(Config{Port: 19192, SSDPAddr: ssdp, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, err)
+	p := &upnp{m}
+
+	addr, lifetime, err := p.mapPort(context.Background(), 19192, time.Minute)
+	require.NoError(t, err)
+	require.Equal(t, netip.AddrPortFrom(testExternal, 19192), addr)
+	// permanent mappings are checked again as often as the requested lifetime
+	require.Equal(t, time.Minute, lifetime)
+	require.Equal(t, []string{"60", "0"}, leases)
+}
+
+func TestUPnPGrantedLease(t *testing.T) {
+	ssdp := fakeIGD(t, func(w http.ResponseWriter, action string, body string) {
+		if strings.HasSuffix(action, `#GetSpecificPortMappingEntry"`) {
+			fmt.Fprint(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>`+
+				`<u:GetSpecificPortMappingEntryResponse xmlns:u="urn:schemas-upnp-org:service:WANIPConnection:1">`+
+				`<NewLeaseDuration>300</NewLeaseDuration></u:GetSpecificPortMappingEntryResponse></s:Body></s:Envelope>`)
+		}
+	})
+
+	m, err := New(Config{Port: 19192, SSDPAddr: ssdp, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, err)
+	p := &upnp{m}
+
+	_, lifetime, err := p.mapPort(context.Background(), 19192, time.Hour)
+	require.NoError(t, err)
+	require.Equal(t, 5*time.Minute, lifetime)
+}
+
+type fakeProtocol struct {
+	lifetime time.Duration
+}
+
+func (p *fakeProtocol) name() string { return "fake" }
+
+func (p *fakeProtocol) mapPort(ctx context.Context, port uint16, lifetime time.Duration) (netip.AddrPort, time.Duration, error) {
+	return netip.AddrPortFrom(testExternal, port), p.lifetime, nil
+}
+
+func (p *fakeProtocol) unmapPort(ctx context.Context, port uint16) error { return nil }
+
+func TestLifetime(t *testing.T) {
+	m, err := New(Config{Port: 19192, Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	require.NoError(t, err)
+
+	// a mapping without lifetime is not usable
+	m.protocols = []protocol{&fakeProtocol{}}
+	_, _, _, err = m.mapPort(context.Background(), nil)
+	require.Error(t, err)
+
+	m.protocols = []protocol{&fakeProtocol{lifetime: 2 * time.Second}}
+	_, lifetime, _, err := m.mapPort(context.Background(), nil)
+	require.NoError(t, err)
+	require.Equal(t, minRenewInterval, renewInterval(lifetime))
+
+	require.Equal(t, time.Hour, renewInterval(2*time.Hour))
+}
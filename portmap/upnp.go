@@ -0,0 +1,325 @@
+package portmap
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+const upnpDiscoverTimeout = 2 * time.Second
+
+// upnp implements port mapping through the WANIPConnection/WANPPPConnection services of an UPnP-IGD
+type upnp struct {
+	m *Mapper
+}
+
+type upnpService struct {
+	serviceType string
+	controlURL  string
+	local       netip.Addr
+}
+
+func (p *upnp) name() string {
+	return "upnp"
+}
+
+func (p *upnp) mapPort(ctx context.Context, port uint16, lifetime time.Duration) (netip.AddrPort, time.Duration, error) {
+	svc, err := p.discover(ctx)
+	if err != nil {
+		return netip.AddrPort{}, 0, err
+	}
+
+	extResp, err := svc.call(ctx, "GetExternalIPAddress", nil)
+	if err != nil {
+		return netip.AddrPort{}, 0, err
+	}
+	external, err := netip.ParseAddr(strings.TrimSpace(extResp["NewExternalIPAddress"]))
+	if err != nil {
+		return netip.AddrPort{}, 0, kleverr.Newf("invalid external address: %w", err)
+	}
+
+	lease := int(lifetime.Seconds())
+	err = svc.addPortMapping(ctx, port, lease)
+	var uerr *upnpError
+	if errors.As(err, &uerr) && uerr.code == upnpOnlyPermanentLeasesSupported {
+		lease = 0
+		err = svc.addPortMapping(ctx, port, lease)
+	}
+	if err != nil {
+		return netip.AddrPort{}, 0, err
+	}
+
+	// the gateway might have granted a different lease than requested, use it if it tells
+	entryResp, err := svc.call(ctx, "GetSpecificPortMappingEntry", []upnpArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(port))},
+		{"NewProtocol", "UDP"},
+	})
+	if err == nil {
+		if granted, err := strconv.Atoi(strings.TrimSpace(entryResp["NewLeaseDuration"])); err == nil {
+			lease = granted
+		}
+	}
+
+	if lease == 0 {
+		// permanent mappings do not expire, but are still checked as often as the requested lifetime,
+		// in case the gateway restarted or the external address changed
+		return netip.AddrPortFrom(external, port), lifetime, nil
+	}
+	return netip.AddrPortFrom(external, port), time.Duration(lease) * time.Second, nil
+}
+
+// upnpOnlyPermanentLeasesSupported is returned by gateways which do not support expiring mappings
+const upnpOnlyPermanentLeasesSupported = 725
+
+func (s *upnpService) addPortMapping(ctx context.Context, port uint16, lease int) error {
+	_, err := s.call(ctx, "AddPortMapping", []upnpArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(port))},
+		{"NewProtocol", "UDP"},
+		{"NewInternalPort", strconv.Itoa(int(port))},
+		{"NewInternalClient", s.local.String()},
+		{"NewEnabled", "1"},
+		{"NewPortMappingDescription", "connet"},
+		{"NewLeaseDuration", strconv.Itoa(lease)},
+	})
+	return err
+}
+
+func (p *upnp) unmapPort(ctx context.Context, port uint16) error {
+	svc, err := p.discover(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.call(ctx, "DeletePortMapping", []upnpArg{
+		{"NewRemoteHost", ""},
+		{"NewExternalPort", strconv.Itoa(int(port))},
+		{"NewProtocol", "UDP"},
+	})
+	return err
+}
+
+// discover finds the gateway through SSDP and reads its description to find a connection service
+func (p *upnp) discover(ctx context.Context) (*upnpService, error) {
+	addr, err := net.ResolveUDPAddr("udp", p.m.ssdpAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	var errs []error
+	for _, st := range []string{
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:2",
+		"urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+	} {
+		req := fmt.Sprintf("M-SEARCH * HTTP/1.1\r\nHOST: %s\r\nST: %s\r\nMAN: \"ssdp:discover\"\r\nMX: 2\r\n\r\n", p.m.ssdpAddr, st)
+		if _, err := conn.WriteToUDP([]byte(req), addr); err != nil {
+			return nil, err
+		}
+
+		conn.SetReadDeadline(time.Now().Add(upnpDiscoverTimeout))
+		buf := make([]byte, 2048)
+		for {
+			n, from, err := conn.ReadFromUDPAddrPort(buf)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				errs = append(errs, kleverr.Newf("%s: %w", st, err))
+				break
+			}
+
+			resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(buf[:n])), nil)
+			if err != nil {
+				continue
+			}
+			location := resp.Header.Get("Location")
+			if location == "" {
+				continue
+			}
+
+			svc, err := p.describe(ctx, location)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if local, err := localAddrTo(ctx, from.String()); err == nil {
+				svc.local = local
+			} else {
+				return nil, err
+			}
+			return svc, nil
+		}
+	}
+	return nil, kleverr.Newf("no internet gateway found: %w", errors.Join(errs...))
+}
+
+type upnpDevice struct {
+	Services []struct {
+		ServiceType string `xml:"serviceType"`
+		ControlURL  string `xml:"controlURL"`
+	} `xml:"serviceList>service"`
+	Devices []upnpDevice `xml:"deviceList>device"`
+}
+
+func (d upnpDevice) find() (string, string, bool) {
+	for _, svc := range d.Services {
+		if strings.Contains(svc.ServiceType, ":WANIPConnection:") || strings.Contains(svc.ServiceType, ":WANPPPConnection:") {
+			return svc.ServiceType, svc.ControlURL, true
+		}
+	}
+	for _, dev := range d.Devices {
+		if typ, ctrl, ok := dev.find(); ok {
+			return typ, ctrl, ok
+		}
+	}
+	return "", "", false
+}
+
+func (p *upnp) describe(ctx context.Context, location string) (*upnpService, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, kleverr.Newf("unexpected description status: %s", resp.Status)
+	}
+
+	var root struct {
+		URLBase string     `xml:"URLBase"`
+		Device  upnpDevice `xml:"device"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&root); err != nil {
+		return nil, kleverr.Newf("cannot decode description: %w", err)
+	}
+
+	serviceType, controlURL, ok := root.Device.find()
+	if !ok {
+		return nil, kleverr.Newf("no connection service at %s", location)
+	}
+
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+	if root.URLBase != "" {
+		if base, err = url.Parse(root.URLBase); err != nil {
+			return nil, err
+		}
+	}
+	ctrl, err := base.Parse(controlURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &upnpService{serviceType: serviceType, controlURL: ctrl.String()}, nil
+}
+
+type upnpArg struct {
+	name  string
+	value string
+}
+
+// call invokes a SOAP action on the service, returning the response arguments
+func (s *upnpService) call(ctx context.Context, action string, args []upnpArg) (map[string]string, error) {
+	var body bytes.Buffer
+	body.WriteString(`<?xml version="1.0"?>`)
+	body.WriteString(`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`)
+	fmt.Fprintf(&body, `<u:%s xmlns:u="%s">`, action, s.serviceType)
+	for _, arg := range args {
+		fmt.Fprintf(&body, "<%s>", arg.name)
+		xml.EscapeText(&body, []byte(arg.value))
+		fmt.Fprintf(&body, "</%s>", arg.name)
+	}
+	fmt.Fprintf(&body, `</u:%s></s:Body></s:Envelope>`, action)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.controlURL, &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", `text/xml; charset="utf-8"`)
+	req.Header.Set("SOAPAction", fmt.Sprintf(`"%s#%s"`, s.serviceType, action))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the response arguments (or the fault details) are the leaf elements of the body
+	result := map[string]string{}
+	dec := xml.NewDecoder(bytes.NewReader(respBody))
+	var current string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			if resp.StatusCode != http.StatusOK {
+				return nil, kleverr.Newf("%s failed: %s", action, resp.Status)
+			}
+			return nil, kleverr.Newf("cannot decode %s response: %w", action, err)
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			current = t.Name.Local
+		case xml.CharData:
+			if current != "" {
+				result[current] += string(t)
+			}
+		case xml.EndElement:
+			current = ""
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code, err := strconv.Atoi(strings.TrimSpace(result["errorCode"])); err == nil {
+			return nil, &upnpError{action: action, code: code, description: strings.TrimSpace(result["errorDescription"])}
+		}
+		return nil, kleverr.Newf("%s failed: %s", action, resp.Status)
+	}
+	return result, nil
+}
+
+// upnpError is the UPnPError detail of a SOAP fault
+type upnpError struct {
+	action      string
+	code        int
+	description string
+}
+
+func (e *upnpError) Error() string {
+	return fmt.Sprintf("%s failed: %d %s", e.action, e.code, e.description)
+}
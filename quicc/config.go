@@ -0,0 +1,77 @@
+package quicc
+
+import (
+	"net"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+	"github.com/quic-go/quic-go"
+)
+
+// DefaultKeepAlivePeriod keeps connections (and nat mappings) alive, unless Config sets another period
+const DefaultKeepAlivePeriod = 25 * time.Second
+
+// Config tunes the quic connections and udp socket of clients, control and relay servers.
+// Zero values keep the quic-go (or operating system) defaults.
+type Config struct {
+	MaxIdleTimeout  time.Duration
+	KeepAlivePeriod time.Duration // DefaultKeepAlivePeriod when zero, negative disables keepalives
+
+	InitialStreamReceiveWindow     uint64
+	MaxStreamReceiveWindow         uint64
+	InitialConnectionReceiveWindow uint64
+	MaxConnectionReceiveWindow     uint64
+
+	MaxIncomingStreams int64
+
+	EnableDatagrams bool
+
+	UDPReadBuffer  int // bytes
+	UDPWriteBuffer int // bytes
+}
+
+// QUIC returns a new quic.Config, for a single listen or dial
+func (c Config) QUIC() *quic.Config {
+	keepAlive := c.KeepAlivePeriod
+	switch {
+	case keepAlive == 0:
+		keepAlive = DefaultKeepAlivePeriod
+	case keepAlive < 0:
+		keepAlive = 0
+	}
+
+	return &quic.Config{
+		MaxIdleTimeout:  c.MaxIdleTimeout,
+		KeepAlivePeriod: keepAlive,
+
+		InitialStreamReceiveWindow:     c.InitialStreamReceiveWindow,
+		MaxStreamReceiveWindow:         c.MaxStreamReceiveWindow,
+		InitialConnectionReceiveWindow: c.InitialConnectionReceiveWindow,
+		MaxConnectionReceiveWindow:     c.MaxConnectionReceiveWindow,
+
+		MaxIncomingStreams: c.MaxIncomingStreams,
+
+		EnableDatagrams: c.EnableDatagrams,
+	}
+}
+
+// ListenUDP opens the udp socket for a quic.Transport, with the configured buffer sizes
+func (c Config) ListenUDP(addr *net.UDPAddr) (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, kleverr.Ret(err)
+	}
+	if c.UDPReadBuffer > 0 {
+		if err := conn.SetReadBuffer(c.UDPReadBuffer); err != nil {
+			conn.Close()
+			return nil, kleverr.Newf("cannot set udp read buffer: %w", err)
+		}
+	}
+	if c.UDPWriteBuffer > 0 {
+		if err := conn.SetWriteBuffer(c.UDPWriteBuffer); err != nil {
+			conn.Close()
+			return nil, kleverr.Newf("cannot set udp write buffer: %w", err)
+		}
+	}
+	return conn, nil
+}
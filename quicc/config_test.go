@@ -0,0 +1,36 @@
+package quicc
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAlive(t *testing.T) {
+	require.Equal(t, DefaultKeepAlivePeriod, Config{}.QUIC().KeepAlivePeriod)
+	require.Equal(t, 10*time.Second, Config{KeepAlivePeriod: 10 * time.Second}.QUIC().KeepAlivePeriod)
+	require.Zero(t, Config{KeepAlivePeriod: -1}.QUIC().KeepAlivePeriod)
+}
+
+func TestQUIC(t *testing.T) {
+	conf := Config{
+		MaxIdleTimeout:             time.Minute,
+		MaxStreamReceiveWindow:     1 << 20,
+		MaxConnectionReceiveWindow: 4 << 20,
+		MaxIncomingStreams:         10,
+		EnableDatagrams:            true,
+	}.QUIC()
+	require.Equal(t, time.Minute, conf.MaxIdleTimeout)
+	require.Equal(t, uint64(1<<20), conf.MaxStreamReceiveWindow)
+	require.Equal(t, uint64(4<<20), conf.MaxConnectionReceiveWindow)
+	require.Equal(t, int64(10), conf.MaxIncomingStreams)
+	require.True(t, conf.EnableDatagrams)
+}
+
+func TestListenUDP(t *testing.T) {
+	conn, err := Config{UDPReadBuffer: 1 << 16, UDPWriteBuffer: 1 << 16}.ListenUDP(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+}
@@ -8,13 +8,14 @@ import (
 	"maps"
 	"slices"
 	"sync"
-	"time"
+	"sync/atomic"
 
 	"github.com/connet-dev/connet/certc"
 	"github.com/connet-dev/connet/model"
 	"github.com/connet-dev/connet/netc"
 	"github.com/connet-dev/connet/pb"
 	"github.com/connet-dev/connet/pbc"
+	"github.com/connet-dev/connet/quicc"
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
@@ -32,6 +33,10 @@ func newClientsServer(cfg Config) (*clientsServer, error) {
 			ClientAuth: tls.RequireAndVerifyClientCert,
 			NextProtos: []string{"connet-relay"},
 		},
+		quicConf: cfg.QUIC,
+
+		timeouts:        cfg.Timeouts,
+		forwardTimeouts: cfg.ForwardTimeouts,
 
 		forwards: map[model.Forward]*forwardClients{},
 
@@ -40,12 +45,19 @@ func newClientsServer(cfg Config) (*clientsServer, error) {
 }
 
 type clientsServer struct {
-	tlsConf *tls.Config
-	auth    func(serverName string, certs []*x509.Certificate) *clientAuth
+	tlsConf  *tls.Config
+	quicConf quicc.Config
+	auth     func(serverName string, certs []*x509.Certificate) *clientAuth
+
+	timeouts        netc.JoinTimeouts
+	forwardTimeouts map[model.Forward]netc.JoinTimeouts
 
 	forwards  map[model.Forward]*forwardClients
 	forwardMu sync.RWMutex
 
+	// reaped counts over all forwards, as forwardClients are removed when empty
+	reaped netc.JoinReaped
+
 	logger *slog.Logger
 }
 
@@ -54,6 +66,9 @@ type forwardClients struct {
 	destinations map[certc.Key]*clientConn
 	sources      map[certc.Key]*clientConn
 	mu           sync.RWMutex
+
+	active atomic.Int64
+	reaped netc.JoinReaped
 }
 
 func (d *forwardClients) get() []*clientConn {
@@ -85,6 +100,13 @@ func (d *forwardClients) empty() bool {
 	return (len(d.destinations) + len(d.sources)) == 0
 }
 
+func (s *clientsServer) joinTimeouts(fwd model.Forward) netc.JoinTimeouts {
+	if timeouts, ok := s.forwardTimeouts[fwd]; ok {
+		return timeouts
+	}
+	return s.timeouts
+}
+
 func (s *clientsServer) getByForward(fwd model.Forward) *forwardClients {
 	s.forwardMu.RLock()
 	dst := s.forwards[fwd]
@@ -157,9 +179,7 @@ func (s *clientsServer) removeSource(fcs *forwardClients, conn *clientConn) {
 }
 
 func (s *clientsServer) run(ctx context.Context, transport *quic.Transport) error {
-	l, err := transport.Listen(s.tlsConf, &quic.Config{
-		KeepAlivePeriod: 25 * time.Second,
-	})
+	l, err := transport.Listen(s.tlsConf, s.quicConf.QUIC())
 	if err != nil {
 		return kleverr.Ret(err)
 	}
@@ -278,20 +298,27 @@ func (c *clientConn) runSourceStream(ctx context.Context, stream quic.Stream, fc
 
 func (c *clientConn) connect(ctx context.Context, stream quic.Stream, fcs *forwardClients) error {
 	dests := fcs.get()
+	var destErr *pb.Error
 	for _, dest := range dests {
-		if err := c.connectDestination(ctx, stream, dest); err != nil {
+		if err := c.connectDestination(ctx, stream, dest, fcs); err != nil {
 			c.logger.Debug("could not dial destination", "err", err)
+			if perr := pb.GetError(err); perr != nil {
+				// the destination answered, pass its error to the source as is
+				destErr = perr
+			}
 		} else {
 			// connect was success
 			return nil
 		}
 	}
 
-	err := pb.NewError(pb.Error_DestinationNotFound, "could not dial destinations: %d", len(dests))
-	return pb.Write(stream, &pbc.Response{Error: err})
+	if destErr == nil {
+		destErr = pb.NewError(pb.Error_DestinationNotFound, "could not dial destinations: %d", len(dests))
+	}
+	return pb.Write(stream, &pbc.Response{Error: destErr})
 }
 
-func (c *clientConn) connectDestination(ctx context.Context, srcStream quic.Stream, dest *clientConn) error {
+func (c *clientConn) connectDestination(ctx context.Context, srcStream quic.Stream, dest *clientConn, fcs *forwardClients) error {
 	dstStream, err := dest.conn.OpenStreamSync(ctx)
 	if err != nil {
 		return kleverr.Newf("could not open stream: %w", err)
@@ -311,9 +338,18 @@ func (c *clientConn) connectDestination(ctx context.Context, srcStream quic.Stre
 		return kleverr.Newf("could not write response: %w", err)
 	}
 
+	fcs.active.Add(1)
+	defer fcs.active.Add(-1)
+
+	timeouts := c.server.joinTimeouts(c.fwd)
 	c.logger.Debug("joining conns", "forward", c.fwd)
-	err = netc.Join(ctx, srcStream, dstStream)
+	err = netc.Join(ctx, srcStream, dstStream, timeouts)
 	c.logger.Debug("disconnected conns", "forward", c.fwd, "err", err)
+	if fcs.reaped.Record(err) {
+		c.server.reaped.Record(err)
+		c.logger.Info("reaped conn", "forward", c.fwd, "reason", err,
+			"idle-timeout", timeouts.Idle, "max-lifetime", timeouts.MaxLifetime)
+	}
 	return nil
 }
 
@@ -0,0 +1,47 @@
+package relay
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/netc"
+	"github.com/connet-dev/connet/selfhosted"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForwardTimeoutsTenant(t *testing.T) {
+	tokensPath := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(tokensPath, []byte("#format=attributes\ntenant-token tenant=team-a\nglobal-token\n"), 0600))
+	auth, err := selfhosted.NewClientAuthenticatorFile(tokensPath, slog.Default())
+	require.NoError(t, err)
+
+	defaults := netc.JoinTimeouts{Idle: time.Minute}
+	tenant := netc.JoinTimeouts{Idle: time.Hour}
+	global := netc.JoinTimeouts{Idle: time.Second}
+	srv, err := newClientsServer(Config{
+		Timeouts: defaults,
+		ForwardTimeouts: map[model.Forward]netc.JoinTimeouts{
+			model.NewForward("@team-a/serviceX"): tenant,
+			model.NewForward("serviceX"):         global,
+		},
+		Logger: slog.Default(),
+	})
+	require.NoError(t, err)
+
+	// the relay sees the forwards as control names them, after resolving the tenant of the client
+	serverForward := func(token string, fwd string) model.Forward {
+		clAuth, err := auth.Authenticate(token)
+		require.NoError(t, err)
+		serverFwd, err := clAuth.Validate(model.NewForward(fwd), model.Destination)
+		require.NoError(t, err)
+		return serverFwd
+	}
+
+	require.Equal(t, tenant, srv.joinTimeouts(serverForward("tenant-token", "serviceX")))
+	require.Equal(t, global, srv.joinTimeouts(serverForward("global-token", "serviceX")))
+	require.Equal(t, defaults, srv.joinTimeouts(serverForward("tenant-token", "serviceY")))
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/connet-dev/connet/netc"
 	"github.com/connet-dev/connet/pb"
 	"github.com/connet-dev/connet/pbr"
+	"github.com/connet-dev/connet/quicc"
 	"github.com/klev-dev/klevdb"
 	"github.com/klev-dev/kleverr"
 	"github.com/quic-go/quic-go"
@@ -27,9 +28,11 @@ type controlClient struct {
 	hostport model.HostPort
 	root     *certc.Cert
 
-	controlAddr    *net.UDPAddr
+	controlAddr    string
 	controlToken   string
 	controlTlsConf *tls.Config
+	controlCAs     func() *x509.CertPool
+	quicConf       quicc.Config
 
 	config  logc.KV[ConfigKey, ConfigValue]
 	clients logc.KV[ClientKey, ClientValue]
@@ -88,17 +91,24 @@ func newControlClient(cfg Config) (*controlClient, error) {
 		return nil, err
 	}
 
+	controlTlsConf := &tls.Config{
+		ServerName: cfg.ControlHost,
+		RootCAs:    cfg.ControlCAs,
+		NextProtos: []string{"connet-relays"},
+	}
+	if cfg.ControlCert != nil {
+		controlTlsConf.Certificates = []tls.Certificate{*cfg.ControlCert}
+	}
+
 	return &controlClient{
 		hostport: cfg.Hostport,
 		root:     root,
 
-		controlAddr:  cfg.ControlAddr,
-		controlToken: cfg.ControlToken,
-		controlTlsConf: &tls.Config{
-			ServerName: cfg.ControlHost,
-			RootCAs:    cfg.ControlCAs,
-			NextProtos: []string{"connet-relays"},
-		},
+		controlAddr:    cfg.ControlAddr,
+		controlToken:   cfg.ControlToken,
+		controlTlsConf: controlTlsConf,
+		controlCAs:     cfg.GetControlCAs,
+		quicConf:       cfg.QUIC,
 
 		config:  config,
 		clients: clients,
@@ -188,15 +198,38 @@ func (s *controlClient) run(ctx context.Context, transport *quic.Transport) erro
 
 var retConnect = kleverr.Ret1[quic.Connection]
 
+// dial resolves the control server address again on each call, connecting to the first of its addresses to respond
+func (s *controlClient) dial(ctx context.Context, transport *quic.Transport) (quic.Connection, error) {
+	ctx, cancel := context.WithTimeout(ctx, netc.DialTimeout)
+	defer cancel()
+
+	addrs, err := netc.ResolveUDPAddrs(ctx, s.controlAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConf := s.controlTlsConf
+	if s.controlCAs != nil {
+		tlsConf = tlsConf.Clone()
+		tlsConf.RootCAs = s.controlCAs()
+	}
+
+	conn, _, err := netc.DialHappyEyeballs(ctx, addrs, netc.HappyEyeballsDelay,
+		func(ctx context.Context, addr *net.UDPAddr) (quic.Connection, error) {
+			return transport.Dial(ctx, addr, tlsConf, s.quicConf.QUIC())
+		}, func(conn quic.Connection) {
+			conn.CloseWithError(0, "connected through another address")
+		})
+	return conn, err
+}
+
 func (s *controlClient) connect(ctx context.Context, transport *quic.Transport) (quic.Connection, error) {
 	reconnConfig, err := s.config.GetOrDefault(configControlReconnect, ConfigValue{})
 	if err != nil {
 		return retConnect(err)
 	}
 
-	conn, err := transport.Dial(ctx, s.controlAddr, s.controlTlsConf, &quic.Config{
-		KeepAlivePeriod: 25 * time.Second,
-	})
+	conn, err := s.dial(ctx, transport)
 	if err != nil {
 		return retConnect(err)
 	}
@@ -313,6 +346,17 @@ func (s *controlClient) runClientsStream(ctx context.Context, conn quic.Connecti
 				return err
 			}
 
+			if resp.Restart {
+				s.logger.Info("relay fell behind control, restarting clients", "changes", len(resp.Changes))
+				if err := s.restartClients(resp); err != nil {
+					return err
+				}
+				if err := s.setClientsStreamOffset(resp.Offset); err != nil {
+					return err
+				}
+				continue
+			}
+
 			for _, change := range resp.Changes {
 				key := ClientKey{
 					Forward: model.ForwardFromPB(change.Forward),
@@ -347,6 +391,28 @@ func (s *controlClient) runClientsStream(ctx context.Context, conn quic.Connecti
 	return g.Wait()
 }
 
+// restartClients replaces all clients with the ones in the snapshot, in a single change. Servers then
+// follow through the clients log.
+func (s *controlClient) restartClients(resp *pbr.ClientsResp) error {
+	values := map[ClientKey]ClientValue{}
+	for _, change := range resp.Changes {
+		if change.Change != pbr.ChangeType_ChangePut {
+			continue
+		}
+		cert, err := x509.ParseCertificate(change.Certificate)
+		if err != nil {
+			return err
+		}
+		key := ClientKey{
+			Forward: model.ForwardFromPB(change.Forward),
+			Role:    model.RoleFromPB(change.Role),
+			Key:     certc.NewKeyString(change.CertificateKey),
+		}
+		values[key] = ClientValue{cert}
+	}
+	return s.clients.Replace(values)
+}
+
 func (s *controlClient) runClientsLog(ctx context.Context) error {
 	for {
 		offset, err := s.getClientsLogOffset()
@@ -428,18 +494,25 @@ func (s *controlClient) runServersStream(ctx context.Context, conn quic.Connecti
 
 			var msgs []logc.Message[ServerKey, ServerValue]
 			var nextOffset int64
+			var restart bool
 			if req.Offset == logc.OffsetOldest {
 				msgs, nextOffset, err = s.servers.Snapshot()
 				s.logger.Debug("sending initial control changes", "offset", nextOffset, "changes", len(msgs))
 			} else {
 				msgs, nextOffset, err = s.servers.Consume(ctx, req.Offset)
-				s.logger.Debug("sending delta control changes", "offset", nextOffset, "changes", len(msgs))
+				if errors.Is(err, logc.ErrInvalidOffset) {
+					msgs, nextOffset, err = s.servers.Snapshot()
+					restart = true
+					s.logger.Debug("sending restart control changes", "offset", nextOffset, "changes", len(msgs))
+				} else {
+					s.logger.Debug("sending delta control changes", "offset", nextOffset, "changes", len(msgs))
+				}
 			}
 			if err != nil {
 				return err
 			}
 
-			resp := &pbr.ServersResp{Offset: nextOffset}
+			resp := &pbr.ServersResp{Offset: nextOffset, Restart: restart}
 
 			for _, msg := range msgs {
 				var change = &pbr.ServersResp_Change{
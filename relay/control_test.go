@@ -0,0 +1,124 @@
+package relay
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/certc"
+	"github.com/connet-dev/connet/control"
+	"github.com/connet-dev/connet/logc"
+	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/selfhosted"
+	"github.com/stretchr/testify/require"
+)
+
+// controlStores exposes the relay clients of the control server, to change them without real clients
+type controlStores struct {
+	control.Stores
+	relayClients logc.KV[control.RelayClientKey, control.RelayClientValue]
+}
+
+func (s *controlStores) RelayClients() (logc.KV[control.RelayClientKey, control.RelayClientValue], error) {
+	return s.relayClients, nil
+}
+
+func TestRelayRestartAfterCompaction(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	cert, cas, err := certc.SelfSigned("localhost")
+	require.NoError(t, err)
+
+	ctrlStores := control.NewFileStores(t.TempDir())
+	relayClients, err := ctrlStores.RelayClients()
+	require.NoError(t, err)
+
+	ctrl, err := control.NewServer(control.Config{
+		Addr:       &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 19290},
+		Cert:       cert,
+		ClientAuth: selfhosted.NewClientAuthenticator("client-token"),
+		RelayAuth:  selfhosted.NewRelayAuthenticator("relay-token"),
+		Stores:     &controlStores{ctrlStores, relayClients},
+		Logger:     logger,
+
+		RelayClientsRetention: 50 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	relay, err := NewServer(Config{
+		Addr:     &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 19291},
+		Hostport: model.HostPort{Host: "localhost", Port: 19291},
+		Logger:   logger,
+		Stores:   NewFileStores(t.TempDir()),
+
+		ControlAddr:  "127.0.0.1:19290",
+		ControlHost:  "localhost",
+		ControlToken: "relay-token",
+		ControlCAs:   cas,
+	})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ctrl.Run(ctx)
+
+	clientKey := func(name string) (control.RelayClientKey, control.RelayClientValue, ClientKey) {
+		root, err := certc.NewRoot()
+		require.NoError(t, err)
+		clientCert, err := root.Cert()
+		require.NoError(t, err)
+		fwd := model.NewForward(name)
+		return control.RelayClientKey{Forward: fwd, Role: model.Destination, Key: certc.NewKey(clientCert)},
+			control.RelayClientValue{Cert: clientCert},
+			ClientKey{Forward: fwd, Role: model.Destination, Key: certc.NewKey(clientCert)}
+	}
+	hasClient := func(key ClientKey) bool {
+		_, err := relay.control.clients.Get(key)
+		if errors.Is(err, logc.ErrNotFound) {
+			return false
+		}
+		require.NoError(t, err)
+		return true
+	}
+	serverClients := func(fwd model.Forward) map[serverClientKey]ClientValue {
+		sv, err := relay.control.servers.GetOrDefault(ServerKey{fwd}, ServerValue{})
+		require.NoError(t, err)
+		return sv.Clients
+	}
+
+	ctrlA, valA, relayA := clientKey("a")
+	ctrlB, valB, relayB := clientKey("b")
+
+	relayCtx, relayCancel := context.WithCancel(ctx)
+	relayDone := make(chan error)
+	go func() { relayDone <- relay.Run(relayCtx) }()
+
+	require.NoError(t, relayClients.Put(ctrlA, valA))
+	require.Eventually(t, func() bool { return hasClient(relayA) }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool { return len(serverClients(relayA.Forward)) == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// the relay is offline, while a is removed and compacted away
+	relayCancel()
+	<-relayDone
+
+	require.NoError(t, relayClients.Del(ctrlA))
+	require.NoError(t, relayClients.Put(ctrlB, valB))
+	time.Sleep(200 * time.Millisecond)
+
+	msgs, _, err := relayClients.Snapshot()
+	require.NoError(t, err)
+	require.Len(t, msgs, 1)
+
+	relayCtx, relayCancel = context.WithCancel(ctx)
+	defer relayCancel()
+	go func() { relayDone <- relay.Run(relayCtx) }()
+
+	require.Eventually(t, func() bool { return hasClient(relayB) && !hasClient(relayA) }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		return len(serverClients(relayA.Forward)) == 0 && len(serverClients(relayB.Forward)) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
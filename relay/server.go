@@ -8,7 +8,9 @@ import (
 	"net"
 
 	"github.com/connet-dev/connet/model"
-	"github.com/klev-dev/kleverr"
+	"github.com/connet-dev/connet/netc"
+	"github.com/connet-dev/connet/quicc"
+	"github.com/connet-dev/connet/statusc"
 	"github.com/quic-go/quic-go"
 	"golang.org/x/sync/errgroup"
 )
@@ -19,10 +21,27 @@ type Config struct {
 	Logger   *slog.Logger
 	Stores   Stores
 
-	ControlAddr  *net.UDPAddr
+	ControlAddr  string // host:port, resolved again on each connect
 	ControlHost  string
 	ControlToken string
 	ControlCAs   *x509.CertPool
+	// ControlCert is optional, for control servers requiring relays to present a certificate
+	ControlCert *tls.Certificate
+
+	// GetControlCAs optionally returns the ControlCAs on each connect, e.g. when the control certificate is reloaded
+	GetControlCAs func() *x509.CertPool
+
+	// QUIC tunes the connections to control and clients, and the udp socket
+	QUIC quicc.Config
+
+	// Timeouts reap the conns joined between sources and destinations, unless overridden in ForwardTimeouts.
+	// ForwardTimeouts are keyed by the server side forward names, so tenant forwards are '@<tenant>/<forward>'.
+	Timeouts        netc.JoinTimeouts
+	ForwardTimeouts map[model.Forward]netc.JoinTimeouts
+
+	// StatusAddr optionally serves the relay Status as json on GET /status, at a tcp address or a unix socket
+	// (as unix:<path>)
+	StatusAddr string
 }
 
 func NewServer(cfg Config) (*Server, error) {
@@ -37,7 +56,9 @@ func NewServer(cfg Config) (*Server, error) {
 	}
 
 	s := &Server{
-		addr: cfg.Addr,
+		addr:       cfg.Addr,
+		quicConf:   cfg.QUIC,
+		statusAddr: cfg.StatusAddr,
 
 		control: control,
 		clients: clients,
@@ -54,7 +75,9 @@ func NewServer(cfg Config) (*Server, error) {
 }
 
 type Server struct {
-	addr *net.UDPAddr
+	addr       *net.UDPAddr
+	quicConf   quicc.Config
+	statusAddr string
 
 	control *controlClient
 	clients *clientsServer
@@ -64,16 +87,15 @@ type Server struct {
 
 func (s *Server) Run(ctx context.Context) error {
 	s.logger.Debug("start udp listener")
-	udpConn, err := net.ListenUDP("udp", s.addr)
+	udpConn, err := s.quicConf.ListenUDP(s.addr)
 	if err != nil {
-		return kleverr.Ret(err)
+		return err
 	}
 	defer udpConn.Close()
 
 	s.logger.Debug("start quic listener")
 	transport := &quic.Transport{
 		Conn: udpConn,
-		// TODO review other options
 	}
 	defer transport.Close()
 
@@ -82,5 +104,9 @@ func (s *Server) Run(ctx context.Context) error {
 	g.Go(func() error { return s.control.run(ctx, transport) })
 	g.Go(func() error { return s.clients.run(ctx, transport) })
 
+	if s.statusAddr != "" {
+		g.Go(func() error { return statusc.Run(ctx, s.statusAddr, s.Status, s.logger) })
+	}
+
 	return g.Wait()
 }
@@ -0,0 +1,55 @@
+package relay
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Status is a snapshot of the forwards with clients connected to the relay, and the conns joined for them
+type Status struct {
+	Forwards       []ForwardStatus `json:"forwards"`
+	ReapedIdle     uint64          `json:"reaped_idle"`
+	ReapedLifetime uint64          `json:"reaped_lifetime"`
+}
+
+// ForwardStatus counts the clients connected for a forward and the conns joined between them.
+// Its reaped counters restart when the forward has no more clients, while the ones in Status do not.
+type ForwardStatus struct {
+	Forward        string `json:"forward"`
+	Destinations   int    `json:"destinations"`
+	Sources        int    `json:"sources"`
+	Active         int64  `json:"active"`
+	ReapedIdle     uint64 `json:"reaped_idle"`
+	ReapedLifetime uint64 `json:"reaped_lifetime"`
+}
+
+func (s *Server) Status() (Status, error) {
+	return s.clients.status(), nil
+}
+
+func (s *clientsServer) status() Status {
+	status := Status{
+		Forwards:       []ForwardStatus{},
+		ReapedIdle:     s.reaped.Idle(),
+		ReapedLifetime: s.reaped.Lifetime(),
+	}
+
+	s.forwardMu.RLock()
+	defer s.forwardMu.RUnlock()
+
+	for fwd, fcs := range s.forwards {
+		fcs.mu.RLock()
+		status.Forwards = append(status.Forwards, ForwardStatus{
+			Forward:        fwd.String(),
+			Destinations:   len(fcs.destinations),
+			Sources:        len(fcs.sources),
+			Active:         fcs.active.Load(),
+			ReapedIdle:     fcs.reaped.Idle(),
+			ReapedLifetime: fcs.reaped.Lifetime(),
+		})
+		fcs.mu.RUnlock()
+	}
+	slices.SortFunc(status.Forwards, func(l, r ForwardStatus) int { return cmp.Compare(l.Forward, r.Forward) })
+
+	return status
+}
@@ -1,36 +1,94 @@
 package selfhosted
 
 import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+
 	"github.com/connet-dev/connet/control"
 	"github.com/connet-dev/connet/model"
 	"github.com/klev-dev/kleverr"
 )
 
 func NewClientAuthenticator(tokens ...string) control.ClientAuthenticator {
-	s := &clientsAuthenticator{map[string]struct{}{}}
-	for _, t := range tokens {
-		s.tokens[t] = struct{}{}
+	return &clientsAuthenticator{tokens: newTokenSet(plainTokens(tokens))}
+}
+
+// NewClientAuthenticatorFile loads tokens from path, and reloads them whenever the file changes
+func NewClientAuthenticatorFile(path string, logger *slog.Logger) (control.ClientAuthenticator, error) {
+	f, err := newTokensFile(path, logger)
+	if err != nil {
+		return nil, err
 	}
-	return s
+	return &clientsAuthenticator{tokens: f.tokens, file: f}, nil
 }
 
 type clientsAuthenticator struct {
-	tokens map[string]struct{}
+	tokens *tokenSet
+	file   *tokensFile
 }
 
 func (s *clientsAuthenticator) Authenticate(token string) (control.ClientAuthentication, error) {
-	if _, ok := s.tokens[token]; ok {
-		return &clientAuthentication{token}, nil
+	t, err := s.tokens.authenticate(token)
+	if err != nil {
+		return nil, kleverr.Newf("invalid token: %w", err)
+	}
+	return &clientAuthentication{token, t.Tenant}, nil
+}
+
+func (s *clientsAuthenticator) Run(ctx context.Context) error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.run(ctx)
+}
+
+// NewClientCertAuthenticator accepts client certificates whose identity (see control.CertIdentity) is one of identities
+func NewClientCertAuthenticator(identities ...string) control.ClientCertAuthenticator {
+	return &clientCertAuthenticator{identities: newTokenSet(plainTokens(identities))}
+}
+
+// NewClientCertAuthenticatorFile loads identities from path, in the format of tokens files, and reloads them whenever
+// the file changes
+func NewClientCertAuthenticatorFile(path string, logger *slog.Logger) (control.ClientCertAuthenticator, error) {
+	f, err := newTokensFile(path, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &clientCertAuthenticator{identities: f.tokens, file: f}, nil
+}
+
+type clientCertAuthenticator struct {
+	identities *tokenSet
+	file       *tokensFile
+}
+
+func (s *clientCertAuthenticator) AuthenticateCertificate(cert *x509.Certificate) (control.ClientAuthentication, error) {
+	identity, err := control.CertIdentity(cert)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.identities.authenticate(identity)
+	if err != nil {
+		return nil, kleverr.Newf("invalid certificate identity '%s': %w", identity, err)
+	}
+	return &clientAuthentication{identity, t.Tenant}, nil
+}
+
+func (s *clientCertAuthenticator) Run(ctx context.Context) error {
+	if s.file == nil {
+		return nil
 	}
-	return nil, kleverr.Newf("invalid token: %s", token)
+	return s.file.run(ctx)
 }
 
 type clientAuthentication struct {
-	token string
+	token  string
+	tenant string
 }
 
 func (a *clientAuthentication) Validate(fwd model.Forward, role model.Role) (model.Forward, error) {
-	return fwd, nil
+	return tenantForward(a.tenant, fwd)
 }
 
 func (a *clientAuthentication) MarshalBinary() (data []byte, err error) {
@@ -0,0 +1,512 @@
+package selfhosted
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/connet-dev/connet/control"
+	"github.com/connet-dev/connet/model"
+	"github.com/klev-dev/kleverr"
+)
+
+const (
+	// allowed clock difference when checking exp and nbf
+	jwtLeeway = time.Minute
+	// minimum time between JWKS reloads caused by an unknown key id
+	jwksReloadInterval = time.Minute
+	// smallest rsa key accepted in a key set
+	jwksMinRSABits = 2048
+)
+
+type JWTConfig struct {
+	JWKS     string        // file path or http(s) url of the key set, discovered from the issuer if empty
+	Issuer   string        // expected iss claim, if set
+	Audience string        // expected to be present in the aud claim, if set
+	Refresh  time.Duration // how often to reload the key set, defaults to 1h
+	Logger   *slog.Logger
+}
+
+// NewJWTAuthenticator validates client tokens as signed JWTs. Tokens must carry sub and exp claims, and can restrict
+// which forwards the client can use as a destination or a source with the `destinations` and `sources` claims, where
+// "*" means any forward. When neither is present, the client can use any forward. A `tenant` claim
+// isolates the client's forwards from other tenants.
+func NewJWTAuthenticator(cfg JWTConfig) (control.ClientAuthenticator, error) {
+	if cfg.JWKS == "" && cfg.Issuer == "" {
+		return nil, kleverr.New("missing jwks or issuer")
+	}
+	if cfg.Refresh == 0 {
+		cfg.Refresh = time.Hour
+	}
+
+	a := &jwtAuthenticator{
+		jwksURL:  cfg.JWKS,
+		issuer:   cfg.Issuer,
+		audience: cfg.Audience,
+		refresh:  cfg.Refresh,
+		logger:   cfg.Logger.With("jwks", cfg.JWKS),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := a.load(ctx); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+type jwtAuthenticator struct {
+	jwksURL  string
+	issuer   string
+	audience string
+	refresh  time.Duration
+	logger   *slog.Logger
+
+	keys       map[string]crypto.PublicKey
+	keysLoaded time.Time
+	keysMu     sync.RWMutex
+
+	// reloads of unknown keys wait for each other, and are attempted at most once per jwksReloadInterval
+	reloadAttempted time.Time
+	reloadMu        sync.Mutex
+}
+
+type jwtClaims struct {
+	Subject      string      `json:"sub"`
+	Issuer       string      `json:"iss"`
+	Audience     jwtAudience `json:"aud"`
+	ExpiresAt    float64     `json:"exp"`
+	NotBefore    float64     `json:"nbf"`
+	Destinations []string    `json:"destinations"`
+	Sources      []string    `json:"sources"`
+	Tenant       string      `json:"tenant"`
+}
+
+// jwtAudience is either a single string or a list of strings
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var multi []string
+	if err := json.Unmarshal(b, &multi); err != nil {
+		return err
+	}
+	*a = multi
+	return nil
+}
+
+func (a *jwtAuthenticator) Authenticate(token string) (control.ClientAuthentication, error) {
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, kleverr.Newf("invalid token: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Subject == "":
+		return nil, kleverr.New("invalid token: missing sub")
+	case claims.ExpiresAt == 0:
+		return nil, kleverr.New("invalid token: missing exp")
+	case now.After(unixTime(claims.ExpiresAt).Add(jwtLeeway)):
+		return nil, kleverr.New("invalid token: expired")
+	case claims.NotBefore != 0 && now.Add(jwtLeeway).Before(unixTime(claims.NotBefore)):
+		return nil, kleverr.New("invalid token: not yet valid")
+	case a.issuer != "" && claims.Issuer != a.issuer:
+		return nil, kleverr.Newf("invalid token: unexpected issuer '%s'", claims.Issuer)
+	case a.audience != "" && !slices.Contains(claims.Audience, a.audience):
+		return nil, kleverr.New("invalid token: unexpected audience")
+	case claims.Tenant != "":
+		if err := validateTenant(claims.Tenant); err != nil {
+			return nil, kleverr.Newf("invalid token: %w", err)
+		}
+	}
+
+	return &jwtAuthentication{claims}, nil
+}
+
+func unixTime(secs float64) time.Time {
+	return time.Unix(0, int64(secs*float64(time.Second)))
+}
+
+// verify checks the token signature and returns its claims
+func (a *jwtAuthenticator) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, kleverr.New("malformed token")
+	}
+
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, kleverr.Newf("malformed header: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return nil, kleverr.Newf("malformed header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, kleverr.Newf("malformed signature: %w", err)
+	}
+
+	key, err := a.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, kleverr.Newf("malformed payload: %w", err)
+	}
+	claims := &jwtClaims{}
+	if err := json.Unmarshal(payload, claims); err != nil {
+		return nil, kleverr.Newf("malformed payload: %w", err)
+	}
+	return claims, nil
+}
+
+// jwtCurves is the curve each ecdsa algorithm is defined with (RFC 7518, section 3.4)
+var jwtCurves = map[string]elliptic.Curve{
+	"ES256": elliptic.P256(),
+	"ES384": elliptic.P384(),
+	"ES512": elliptic.P521(),
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed []byte, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512", "ES512":
+		hash = crypto.SHA512
+	case "EdDSA":
+	default:
+		return kleverr.Newf("unsupported algorithm '%s'", alg)
+	}
+
+	var digest []byte
+	if hash != 0 {
+		h := hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return kleverr.Newf("algorithm '%s' does not match rsa key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return kleverr.Newf("invalid signature: %w", err)
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if curve, ok := jwtCurves[alg]; !ok || k.Curve != curve || len(signature) != 2*size {
+			return kleverr.Newf("algorithm '%s' does not match ecdsa key", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return kleverr.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if alg != "EdDSA" {
+			return kleverr.Newf("algorithm '%s' does not match ed25519 key", alg)
+		}
+		if !ed25519.Verify(k, signed, signature) {
+			return kleverr.New("invalid signature")
+		}
+	default:
+		return kleverr.Newf("unsupported key type %T", key)
+	}
+	return nil
+}
+
+// key finds the key by its id, reloading the key set if it is unknown (but not too often)
+func (a *jwtAuthenticator) key(kid string) (crypto.PublicKey, error) {
+	if key, ok := a.loadedKey(kid); ok {
+		return key, nil
+	}
+
+	a.reloadMu.Lock()
+	defer a.reloadMu.Unlock()
+
+	// another caller might have reloaded the keys while this one was waiting
+	if key, ok := a.loadedKey(kid); ok {
+		return key, nil
+	}
+
+	a.keysMu.RLock()
+	loaded := a.keysLoaded
+	a.keysMu.RUnlock()
+	if time.Since(loaded) <= jwksReloadInterval || time.Since(a.reloadAttempted) <= jwksReloadInterval {
+		return nil, kleverr.Newf("unknown key '%s'", kid)
+	}
+
+	// recorded before loading, so failing reloads are limited too
+	a.reloadAttempted = time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := a.load(ctx); err != nil {
+		a.logger.Warn("cannot reload jwks", "err", err)
+	}
+
+	if key, ok := a.loadedKey(kid); ok {
+		return key, nil
+	}
+	return nil, kleverr.Newf("unknown key '%s'", kid)
+}
+
+func (a *jwtAuthenticator) loadedKey(kid string) (crypto.PublicKey, bool) {
+	a.keysMu.RLock()
+	defer a.keysMu.RUnlock()
+
+	key, ok := a.keys[kid]
+	return key, ok
+}
+
+func (a *jwtAuthenticator) Run(ctx context.Context) error {
+	t := time.NewTicker(a.refresh)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if err := a.load(ctx); err != nil {
+			a.logger.Warn("cannot reload jwks, keeping previous", "err", err)
+		}
+	}
+}
+
+func (a *jwtAuthenticator) load(ctx context.Context) error {
+	jwksURL := a.jwksURL
+	if jwksURL == "" {
+		discovered, err := discoverJWKS(ctx, a.issuer)
+		if err != nil {
+			return err
+		}
+		jwksURL = discovered
+	}
+
+	data, err := readLocation(ctx, jwksURL)
+	if err != nil {
+		return err
+	}
+	keys, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	a.keysMu.Lock()
+	defer a.keysMu.Unlock()
+
+	a.keys = keys
+	a.keysLoaded = time.Now()
+	a.logger.Debug("loaded jwks", "keys", len(keys))
+	return nil
+}
+
+// discoverJWKS finds the key set url through the OpenID provider configuration of the issuer
+func discoverJWKS(ctx context.Context, issuer string) (string, error) {
+	data, err := readLocation(ctx, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	var cfg struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return "", kleverr.Newf("cannot decode openid configuration: %w", err)
+	}
+	if cfg.JWKSURI == "" {
+		return "", kleverr.New("missing jwks_uri in openid configuration")
+	}
+	return cfg.JWKSURI, nil
+}
+
+// readLocation reads an http(s) url or a local file
+func readLocation(ctx context.Context, location string) ([]byte, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.ReadFile(location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, kleverr.Newf("unexpected status fetching %s: %s", location, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, kleverr.Newf("cannot decode jwks: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, kleverr.Newf("invalid key '%s': %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(e) == 0 || len(e) > 4 {
+			return nil, kleverr.New("invalid exponent")
+		}
+		key := &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+		if key.N.BitLen() < jwksMinRSABits {
+			return nil, kleverr.Newf("rsa key too small, %d bits, at least %d required", key.N.BitLen(), jwksMinRSABits)
+		}
+		return key, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, kleverr.Newf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) != size || len(y) != size {
+			return nil, kleverr.New("invalid point size")
+		}
+		// validates the point is on the curve
+		if _, err := ecdhCurve.NewPublicKey(bytes.Join([][]byte{{4}, x, y}, nil)); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, kleverr.Newf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, kleverr.New("invalid key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, kleverr.Newf("unsupported key type '%s'", k.Kty)
+	}
+}
+
+type jwtAuthentication struct {
+	claims *jwtClaims
+}
+
+func (a *jwtAuthentication) Validate(fwd model.Forward, role model.Role) (model.Forward, error) {
+	if a.claims.Destinations == nil && a.claims.Sources == nil {
+		return tenantForward(a.claims.Tenant, fwd)
+	}
+
+	var allowed []string
+	switch role {
+	case model.Destination:
+		allowed = a.claims.Destinations
+	case model.Source:
+		allowed = a.claims.Sources
+	default:
+		return model.Forward{}, kleverr.Newf("unknown role: %s", role)
+	}
+	if slices.Contains(allowed, "*") || slices.Contains(allowed, fwd.String()) {
+		return tenantForward(a.claims.Tenant, fwd)
+	}
+	return model.Forward{}, kleverr.Newf("%s is not allowed as a %s for %s", fwd, role, a.claims.Subject)
+}
+
+func (a *jwtAuthentication) MarshalBinary() (data []byte, err error) {
+	return []byte(a.claims.Subject), nil
+}
@@ -0,0 +1,277 @@
+package selfhosted
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/stretchr/testify/require"
+)
+
+var b64 = base64.RawURLEncoding
+
+type testSigner struct {
+	kid  string
+	alg  string
+	jwk  map[string]string
+	sign func(data []byte) []byte
+}
+
+func newTestSigners(t *testing.T) []testSigner {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	edPub, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	return []testSigner{
+		{
+			kid: "rsa", alg: "RS256",
+			jwk: map[string]string{
+				"kty": "RSA", "kid": "rsa", "use": "sig",
+				"n": b64.EncodeToString(rsaKey.N.Bytes()),
+				"e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+			},
+			sign: func(data []byte) []byte {
+				digest := sha256.Sum256(data)
+				sig, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+				require.NoError(t, err)
+				return sig
+			},
+		},
+		{
+			kid: "ec", alg: "ES256",
+			jwk: map[string]string{
+				"kty": "EC", "kid": "ec", "crv": "P-256",
+				"x": b64.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+				"y": b64.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+			},
+			sign: func(data []byte) []byte {
+				digest := sha256.Sum256(data)
+				r, s, err := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+				require.NoError(t, err)
+				return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+			},
+		},
+		{
+			kid: "ed", alg: "EdDSA",
+			jwk: map[string]string{
+				"kty": "OKP", "kid": "ed", "crv": "Ed25519",
+				"x": b64.EncodeToString(edPub),
+			},
+			sign: func(data []byte) []byte {
+				return ed25519.Sign(edKey, data)
+			},
+		},
+	}
+}
+
+func (s testSigner) token(t *testing.T, claims map[string]any) string {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "kid": s.kid, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	signed := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+	return signed + "." + b64.EncodeToString(s.sign([]byte(signed)))
+}
+
+func testJWKS(t *testing.T, signers []testSigner) []byte {
+	var keys []map[string]string
+	for _, s := range signers {
+		keys = append(keys, s.jwk)
+	}
+	data, err := json.Marshal(map[string]any{"keys": keys})
+	require.NoError(t, err)
+	return data
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	signers := newTestSigners(t)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksPath, testJWKS(t, signers), 0600))
+
+	auth, err := NewJWTAuthenticator(JWTConfig{
+		JWKS:     jwksPath,
+		Issuer:   "https://idp.example.com",
+		Audience: "connet",
+		Logger:   slog.Default(),
+	})
+	require.NoError(t, err)
+
+	valid := func() map[string]any {
+		return map[string]any{
+			"sub": "client-1",
+			"iss": "https://idp.example.com",
+			"aud": []string{"other", "connet"},
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+	}
+
+	for _, s := range signers {
+		t.Run(s.alg, func(t *testing.T) {
+			ca, err := auth.Authenticate(s.token(t, valid()))
+			require.NoError(t, err)
+			sub, err := ca.MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, []byte("client-1"), sub)
+		})
+	}
+
+	t.Run("invalid", func(t *testing.T) {
+		s := signers[0]
+		for name, change := range map[string]func(c map[string]any){
+			"expired":  func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+			"no exp":   func(c map[string]any) { delete(c, "exp") },
+			"no sub":   func(c map[string]any) { delete(c, "sub") },
+			"issuer":   func(c map[string]any) { c["iss"] = "https://other.example.com" },
+			"audience": func(c map[string]any) { c["aud"] = "other" },
+			"nbf":      func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+		} {
+			claims := valid()
+			change(claims)
+			_, err := auth.Authenticate(s.token(t, claims))
+			require.Error(t, err, name)
+		}
+
+		token := s.token(t, valid())
+		_, err := auth.Authenticate(token[:len(token)-4] + "AAAA")
+		require.ErrorContains(t, err, "invalid signature")
+
+		other := s
+		other.kid = "unknown"
+		_, err = auth.Authenticate(other.token(t, valid()))
+		require.ErrorContains(t, err, "unknown key")
+
+		wrongAlg := signers[1]
+		wrongAlg.kid = "rsa"
+		_, err = auth.Authenticate(wrongAlg.token(t, valid()))
+		require.ErrorContains(t, err, "does not match rsa key")
+	})
+
+	t.Run("curve", func(t *testing.T) {
+		// ES256 signed with a P-384 key, which only ES384 can use
+		p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		require.NoError(t, err)
+		signed := []byte("header.payload")
+		digest := sha256.Sum256(signed)
+		r, s, err := ecdsa.Sign(rand.Reader, p384Key, digest[:])
+		require.NoError(t, err)
+		signature := append(r.FillBytes(make([]byte, 48)), s.FillBytes(make([]byte, 48))...)
+
+		err = verifySignature("ES256", &p384Key.PublicKey, signed, signature)
+		require.ErrorContains(t, err, "does not match ecdsa key")
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		claims := valid()
+		claims["destinations"] = []string{"a"}
+		claims["sources"] = []string{"*"}
+		ca, err := auth.Authenticate(signers[0].token(t, claims))
+		require.NoError(t, err)
+
+		_, err = ca.Validate(model.NewForward("a"), model.Destination)
+		require.NoError(t, err)
+		_, err = ca.Validate(model.NewForward("b"), model.Destination)
+		require.Error(t, err)
+		_, err = ca.Validate(model.NewForward("b"), model.Source)
+		require.NoError(t, err)
+	})
+}
+
+func TestJWTAuthenticatorDiscovery(t *testing.T) {
+	signers := newTestSigners(t)
+
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"issuer": "%s", "jwks_uri": "%s/keys"}`, srv.URL, srv.URL)
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(testJWKS(t, signers[2:]))
+	})
+
+	auth, err := NewJWTAuthenticator(JWTConfig{Issuer: srv.URL, Logger: slog.Default()})
+	require.NoError(t, err)
+
+	_, err = auth.Authenticate(signers[2].token(t, map[string]any{
+		"sub": "client-1",
+		"iss": srv.URL,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}))
+	require.NoError(t, err)
+}
+
+func TestJWTAuthenticatorReload(t *testing.T) {
+	signers := newTestSigners(t)
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) > 1 {
+			time.Sleep(50 * time.Millisecond)
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write(testJWKS(t, signers[:1]))
+	}))
+	t.Cleanup(srv.Close)
+
+	ca, err := NewJWTAuthenticator(JWTConfig{JWKS: srv.URL, Logger: slog.Default()})
+	require.NoError(t, err)
+	auth := ca.(*jwtAuthenticator)
+	auth.keysLoaded = time.Time{}
+
+	token := signers[1].token(t, map[string]any{"sub": "client-1", "exp": time.Now().Add(time.Hour).Unix()})
+
+	// concurrent unknown keys are collapsed into a single reload
+	errs := make(chan error, 10)
+	for range cap(errs) {
+		go func() {
+			_, err := auth.Authenticate(token)
+			errs <- err
+		}()
+	}
+	for range cap(errs) {
+		require.ErrorContains(t, <-errs, "unknown key 'ec'")
+	}
+	require.Equal(t, int32(2), requests.Load())
+
+	// the failed reload still counts against the reload interval
+	_, err = auth.Authenticate(token)
+	require.ErrorContains(t, err, "unknown key 'ec'")
+	require.Equal(t, int32(2), requests.Load())
+}
+
+func TestParseJWKSSmallRSA(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+
+	data, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": "rsa",
+		"n": b64.EncodeToString(rsaKey.N.Bytes()),
+		"e": b64.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes()),
+	}}})
+	require.NoError(t, err)
+
+	_, err = parseJWKS(data)
+	require.ErrorContains(t, err, "rsa key too small")
+}
@@ -1,36 +1,94 @@
 package selfhosted
 
 import (
+	"context"
+	"crypto/x509"
+	"log/slog"
+
 	"github.com/connet-dev/connet/control"
 	"github.com/connet-dev/connet/model"
 	"github.com/klev-dev/kleverr"
 )
 
 func NewRelayAuthenticator(tokens ...string) control.RelayAuthenticator {
-	s := &relayAuthenticator{map[string]struct{}{}}
-	for _, t := range tokens {
-		s.tokens[t] = struct{}{}
+	return &relayAuthenticator{tokens: newTokenSet(plainTokens(tokens))}
+}
+
+// NewRelayAuthenticatorFile loads tokens from path, and reloads them whenever the file changes
+func NewRelayAuthenticatorFile(path string, logger *slog.Logger) (control.RelayAuthenticator, error) {
+	f, err := newTokensFile(path, logger)
+	if err != nil {
+		return nil, err
 	}
-	return s
+	return &relayAuthenticator{tokens: f.tokens, file: f}, nil
 }
 
 type relayAuthenticator struct {
-	tokens map[string]struct{}
+	tokens *tokenSet
+	file   *tokensFile
 }
 
 func (s *relayAuthenticator) Authenticate(token string) (control.RelayAuthentication, error) {
-	if _, ok := s.tokens[token]; ok {
-		return &relayAuthentication{token}, nil
+	t, err := s.tokens.authenticate(token)
+	if err != nil {
+		return nil, kleverr.Newf("invalid token: %w", err)
+	}
+	return &relayAuthentication{token, t.Tenant}, nil
+}
+
+func (s *relayAuthenticator) Run(ctx context.Context) error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.run(ctx)
+}
+
+// NewRelayCertAuthenticator accepts relay certificates whose identity (see control.CertIdentity) is one of identities
+func NewRelayCertAuthenticator(identities ...string) control.RelayCertAuthenticator {
+	return &relayCertAuthenticator{identities: newTokenSet(plainTokens(identities))}
+}
+
+// NewRelayCertAuthenticatorFile loads identities from path, in the format of tokens files, and reloads them whenever
+// the file changes
+func NewRelayCertAuthenticatorFile(path string, logger *slog.Logger) (control.RelayCertAuthenticator, error) {
+	f, err := newTokensFile(path, logger)
+	if err != nil {
+		return nil, err
+	}
+	return &relayCertAuthenticator{identities: f.tokens, file: f}, nil
+}
+
+type relayCertAuthenticator struct {
+	identities *tokenSet
+	file       *tokensFile
+}
+
+func (s *relayCertAuthenticator) AuthenticateCertificate(cert *x509.Certificate) (control.RelayAuthentication, error) {
+	identity, err := control.CertIdentity(cert)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.identities.authenticate(identity)
+	if err != nil {
+		return nil, kleverr.Newf("invalid certificate identity '%s': %w", identity, err)
+	}
+	return &relayAuthentication{identity, t.Tenant}, nil
+}
+
+func (s *relayCertAuthenticator) Run(ctx context.Context) error {
+	if s.file == nil {
+		return nil
 	}
-	return nil, kleverr.Newf("invalid token: %s", token)
+	return s.file.run(ctx)
 }
 
 type relayAuthentication struct {
-	token string
+	token  string
+	tenant string
 }
 
 func (r *relayAuthentication) Allow(fwd model.Forward) bool {
-	return true
+	return inTenant(r.tenant, fwd)
 }
 
 func (r *relayAuthentication) MarshalBinary() (data []byte, err error) {
@@ -0,0 +1,44 @@
+package selfhosted
+
+import (
+	"strings"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/klev-dev/kleverr"
+)
+
+const (
+	// marks the forwards of tenants on the server side, followed by the tenant and the separator
+	tenantMark = "@"
+	// separates the tenant from the forward name on the server side
+	tenantSeparator = "/"
+)
+
+func validateTenant(tenant string) error {
+	if tenant == "" || strings.HasPrefix(tenant, tenantMark) || strings.Contains(tenant, tenantSeparator) {
+		return kleverr.Newf("invalid tenant '%s'", tenant)
+	}
+	return nil
+}
+
+// tenantForward gives the forward its server side name, so forwards with the same name in different tenants
+// do not see each other. Tenant forwards become '@<tenant>/<forward>'. Clients without a tenant use forward names
+// as they are, except for names starting with the mark, which is doubled. Since tenants cannot start with the mark,
+// no client can name (and join) a forward of another tenant, and any name stays usable.
+func tenantForward(tenant string, fwd model.Forward) (model.Forward, error) {
+	if tenant == "" {
+		if strings.HasPrefix(fwd.String(), tenantMark) {
+			return model.NewForward(tenantMark + fwd.String()), nil
+		}
+		return fwd, nil
+	}
+	return model.NewForward(tenantMark + tenant + tenantSeparator + fwd.String()), nil
+}
+
+// inTenant checks if a (server side) forward belongs to the tenant. Without a tenant, all forwards do.
+func inTenant(tenant string, fwd model.Forward) bool {
+	if tenant == "" {
+		return true
+	}
+	return strings.HasPrefix(fwd.String(), tenantMark+tenant+tenantSeparator)
+}
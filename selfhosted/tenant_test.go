@@ -0,0 +1,68 @@
+package selfhosted
+
+import (
+	"testing"
+
+	"github.com/connet-dev/connet/model"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenants(t *testing.T) {
+	clients := &clientsAuthenticator{tokens: newTokenSet([]Token{
+		{Value: "a", Tenant: "team-a"},
+		{Value: "b", Tenant: "team-b"},
+		{Value: "global"},
+	})}
+	validate := func(token string, name string) (model.Forward, error) {
+		auth, err := clients.Authenticate(token)
+		require.NoError(t, err)
+		return auth.Validate(model.NewForward(name), model.Destination)
+	}
+
+	fwdA, err := validate("a", "db")
+	require.NoError(t, err)
+	fwdB, err := validate("b", "db")
+	require.NoError(t, err)
+	require.NotEqual(t, fwdA, fwdB)
+	require.Equal(t, model.NewForward("@team-a/db"), fwdA)
+
+	// tenant clients can use the separator, and stay in their tenant
+	fwdSep, err := validate("a", "team-b/db")
+	require.NoError(t, err)
+	require.Equal(t, model.NewForward("@team-a/team-b/db"), fwdSep)
+
+	fwdGlobal, err := validate("global", "db")
+	require.NoError(t, err)
+	require.Equal(t, model.NewForward("db"), fwdGlobal)
+
+	// global names are kept as they are, so existing names with the separator keep working
+	fwdGlobalSep, err := validate("global", "team-a/db")
+	require.NoError(t, err)
+	require.Equal(t, model.NewForward("team-a/db"), fwdGlobalSep)
+
+	// global names cannot reach forwards of a tenant, even when naming them by their server side name
+	fwdGlobalMark, err := validate("global", "@team-a/db")
+	require.NoError(t, err)
+	require.NotEqual(t, fwdA, fwdGlobalMark)
+
+	relays := &relayAuthenticator{tokens: newTokenSet([]Token{
+		{Value: "a", Tenant: "team-a"},
+		{Value: "global"},
+	})}
+	relayA, err := relays.Authenticate("a")
+	require.NoError(t, err)
+	require.True(t, relayA.Allow(fwdA))
+	require.False(t, relayA.Allow(fwdB))
+	require.False(t, relayA.Allow(fwdGlobal))
+	require.False(t, relayA.Allow(fwdGlobalSep))
+	require.False(t, relayA.Allow(fwdGlobalMark))
+
+	relayGlobal, err := relays.Authenticate("global")
+	require.NoError(t, err)
+	require.True(t, relayGlobal.Allow(fwdA))
+	require.True(t, relayGlobal.Allow(fwdB))
+
+	for _, tenant := range []string{"", "@team-a", "team/a"} {
+		require.Error(t, validateTenant(tenant), tenant)
+	}
+}
@@ -0,0 +1,204 @@
+package selfhosted
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+// how often to check tokens files for changes
+const tokensFileCheckInterval = 5 * time.Second
+
+// Token is a secret used to authenticate, optionally valid only until Expires. Tokens with a Tenant
+// only see forwards within that tenant.
+type Token struct {
+	Value   string
+	Expires time.Time
+	Tenant  string
+}
+
+func (t Token) expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// tokensAttributesHeader must be the first line of a tokens file for it to use the attributes format
+const tokensAttributesHeader = "#format=attributes"
+
+// ParseTokens reads one token per line. By default, each non-empty line is a token as is, including any
+// whitespace or leading #. When the first line is tokensAttributesHeader, each line is in the form of
+// `<token> [expires=<RFC3339 time>] [tenant=<name>]`, with empty lines and lines starting with # ignored,
+// and lines which do not parse failing the whole file.
+func ParseTokens(r io.Reader) ([]Token, error) {
+	var tokens []Token
+	scanner := bufio.NewScanner(r)
+	attributes := false
+	for line := 1; scanner.Scan(); line++ {
+		text := scanner.Text()
+		switch {
+		case line == 1 && text == tokensAttributesHeader:
+			attributes = true
+		case attributes:
+			token, ok, err := parseTokenAttributes(text)
+			if err != nil {
+				return nil, kleverr.Newf("line %d: %w", line, err)
+			} else if ok {
+				tokens = append(tokens, token)
+			}
+		case text != "":
+			tokens = append(tokens, Token{Value: text})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, kleverr.Newf("cannot read tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// parseTokenAttributes parses a line of the attributes format, returning false for empty and comment lines
+func parseTokenAttributes(text string) (Token, bool, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return Token{}, false, nil
+	}
+
+	token := Token{Value: fields[0]}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return Token{}, false, kleverr.Newf("invalid attribute '%s', expected key=value", field)
+		}
+		switch key {
+		case "expires":
+			expires, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return Token{}, false, kleverr.Newf("invalid expires: %w", err)
+			}
+			token.Expires = expires
+		case "tenant":
+			if err := validateTenant(value); err != nil {
+				return Token{}, false, err
+			}
+			token.Tenant = value
+		default:
+			return Token{}, false, kleverr.Newf("unknown attribute '%s'", key)
+		}
+	}
+	return token, true, nil
+}
+
+// LoadTokens reads tokens from a file, see ParseTokens for the format
+func LoadTokens(path string) ([]Token, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, kleverr.Newf("cannot open tokens file: %w", err)
+	}
+	defer f.Close()
+
+	return ParseTokens(f)
+}
+
+func plainTokens(values []string) []Token {
+	tokens := make([]Token, len(values))
+	for i, v := range values {
+		tokens[i] = Token{Value: v}
+	}
+	return tokens
+}
+
+// tokenSet is a set of tokens which can be replaced atomically
+type tokenSet struct {
+	tokens atomic.Pointer[map[string]Token]
+}
+
+func newTokenSet(tokens []Token) *tokenSet {
+	s := &tokenSet{}
+	s.set(tokens)
+	return s
+}
+
+func (s *tokenSet) set(tokens []Token) {
+	m := make(map[string]Token, len(tokens))
+	for _, t := range tokens {
+		m[t.Value] = t
+	}
+	s.tokens.Store(&m)
+}
+
+func (s *tokenSet) authenticate(token string) (Token, error) {
+	t, ok := (*s.tokens.Load())[token]
+	switch {
+	case !ok:
+		return Token{}, kleverr.New("unknown token")
+	case t.expired(time.Now()):
+		return Token{}, kleverr.Newf("token expired at %s", t.Expires.Format(time.RFC3339))
+	}
+	return t, nil
+}
+
+// tokensFile reloads a tokenSet whenever its file changes
+type tokensFile struct {
+	path    string
+	tokens  *tokenSet
+	logger  *slog.Logger
+	modTime time.Time
+	size    int64
+}
+
+func newTokensFile(path string, logger *slog.Logger) (*tokensFile, error) {
+	f := &tokensFile{path: path, logger: logger.With("tokens-file", path)}
+	stat, err := os.Stat(path)
+	if err != nil {
+		return nil, kleverr.Newf("cannot stat tokens file: %w", err)
+	}
+	tokens, err := LoadTokens(path)
+	if err != nil {
+		return nil, err
+	}
+	f.tokens = newTokenSet(tokens)
+	f.modTime, f.size = stat.ModTime(), stat.Size()
+	return f, nil
+}
+
+func (f *tokensFile) run(ctx context.Context) error {
+	t := time.NewTicker(tokensFileCheckInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+
+		if err := f.reload(); err != nil {
+			f.logger.Warn("cannot reload tokens, keeping previous", "err", err)
+		}
+	}
+}
+
+// reload reads the file again if its modification time or size changed
+func (f *tokensFile) reload() error {
+	stat, err := os.Stat(f.path)
+	if err != nil {
+		return kleverr.Newf("cannot stat tokens file: %w", err)
+	}
+	if stat.ModTime().Equal(f.modTime) && stat.Size() == f.size {
+		return nil
+	}
+
+	tokens, err := LoadTokens(f.path)
+	if err != nil {
+		return err
+	}
+	f.tokens.set(tokens)
+	f.modTime, f.size = stat.ModTime(), stat.Size()
+	f.logger.Info("reloaded tokens", "len", len(tokens))
+	return nil
+}
@@ -0,0 +1,98 @@
+package selfhosted
+
+import (
+	"crypto/x509"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTokens(t *testing.T) {
+	// without the header, each line is a token as is
+	tokens, err := ParseTokens(strings.NewReader("token-1\n#token-2\ntoken 3 expires=2024-01-02T03:04:05Z\n\n"))
+	require.NoError(t, err)
+	require.Equal(t, []Token{
+		{Value: "token-1"},
+		{Value: "#token-2"},
+		{Value: "token 3 expires=2024-01-02T03:04:05Z"},
+	}, tokens)
+
+	tokens, err = ParseTokens(strings.NewReader(`#format=attributes
+# comment
+token-1
+token-2 expires=2024-01-02T03:04:05Z
+token-3 tenant=team-a
+`))
+	require.NoError(t, err)
+	require.Equal(t, []Token{
+		{Value: "token-1"},
+		{Value: "token-2", Expires: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{Value: "token-3", Tenant: "team-a"},
+	}, tokens)
+
+	_, err = ParseTokens(strings.NewReader("#format=attributes\ntoken-1 expires=tomorrow"))
+	require.ErrorContains(t, err, "line 2: invalid expires")
+
+	_, err = ParseTokens(strings.NewReader("#format=attributes\ntoken-1 color=blue"))
+	require.ErrorContains(t, err, "unknown attribute 'color'")
+
+	_, err = ParseTokens(strings.NewReader("#format=attributes\ntoken with spaces"))
+	require.ErrorContains(t, err, "invalid attribute 'with'")
+}
+
+func TestTokensExpire(t *testing.T) {
+	auth := &clientsAuthenticator{tokens: newTokenSet([]Token{
+		{Value: "valid", Expires: time.Now().Add(time.Hour)},
+		{Value: "expired", Expires: time.Now().Add(-time.Hour)},
+	})}
+
+	_, err := auth.Authenticate("valid")
+	require.NoError(t, err)
+	_, err = auth.Authenticate("expired")
+	require.ErrorContains(t, err, "token expired")
+	_, err = auth.Authenticate("unknown")
+	require.ErrorContains(t, err, "unknown token")
+}
+
+func TestCertIdentities(t *testing.T) {
+	auth := NewClientCertAuthenticator("client.example.com")
+
+	_, err := auth.AuthenticateCertificate(&x509.Certificate{DNSNames: []string{"client.example.com"}})
+	require.NoError(t, err)
+	_, err = auth.AuthenticateCertificate(&x509.Certificate{DNSNames: []string{"other.example.com"}})
+	require.ErrorContains(t, err, "invalid certificate identity 'other.example.com'")
+
+	// identities are not tokens
+	_, err = NewClientAuthenticator("client-token").Authenticate("client.example.com")
+	require.ErrorContains(t, err, "unknown token")
+}
+
+func TestTokensFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	require.NoError(t, os.WriteFile(path, []byte("token-1\n"), 0600))
+
+	f, err := newTokensFile(path, slog.Default())
+	require.NoError(t, err)
+	_, err = f.tokens.authenticate("token-1")
+	require.NoError(t, err)
+	_, err = f.tokens.authenticate("token-2")
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte("token-2\ntoken-3\n"), 0600))
+	require.NoError(t, f.reload())
+	_, err = f.tokens.authenticate("token-1")
+	require.Error(t, err)
+	_, err = f.tokens.authenticate("token-2")
+	require.NoError(t, err)
+
+	// a broken file keeps the previous tokens
+	require.NoError(t, os.WriteFile(path, []byte("#format=attributes\ntoken-4 expires=never\n"), 0600))
+	require.Error(t, f.reload())
+	_, err = f.tokens.authenticate("token-2")
+	require.NoError(t, err)
+}
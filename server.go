@@ -9,8 +9,11 @@ import (
 	"os"
 	"path/filepath"
 
+	"github.com/connet-dev/connet/certc"
 	"github.com/connet-dev/connet/control"
 	"github.com/connet-dev/connet/model"
+	"github.com/connet-dev/connet/netc"
+	"github.com/connet-dev/connet/quicc"
 	"github.com/connet-dev/connet/relay"
 	"github.com/connet-dev/connet/selfhosted"
 	"github.com/klev-dev/kleverr"
@@ -58,33 +61,80 @@ func NewServer(opts ...ServerOption) (*Server, error) {
 		}
 	}
 
+	if cfg.clientTokensFile != "" {
+		auth, err := selfhosted.NewClientAuthenticatorFile(cfg.clientTokensFile, cfg.logger)
+		if err != nil {
+			return nil, err
+		}
+		cfg.clientAuth = auth
+	}
+
+	if cfg.clientIdentitiesFile != "" {
+		auth, err := selfhosted.NewClientCertAuthenticatorFile(cfg.clientIdentitiesFile, cfg.logger)
+		if err != nil {
+			return nil, err
+		}
+		cfg.clientCertAuth = auth
+	}
+
+	var controlCertFile *certc.CertFile
+	if cfg.controlCertFile != "" {
+		certFile, err := certc.NewCertFile(cfg.controlCertFile, cfg.controlKeyFile, cfg.logger)
+		if err != nil {
+			return nil, kleverr.Newf("control cert cannot be loaded: %w", err)
+		}
+		controlCertFile = certFile
+	}
+
 	relayControlToken := model.GenServerName("relay")
 
-	control, err := control.NewServer(control.Config{
-		Addr:       cfg.controlAddr,
-		Cert:       cfg.controlCert,
-		ClientAuth: cfg.clientAuth,
-		RelayAuth:  selfhosted.NewRelayAuthenticator(relayControlToken),
-		Logger:     cfg.logger,
-		Stores:     control.NewFileStores(filepath.Join(cfg.dir, "control")),
-	})
+	controlCfg := control.Config{
+		Addr:           cfg.controlAddr,
+		Cert:           cfg.controlCert,
+		ClientAuth:     cfg.clientAuth,
+		ClientCAs:      cfg.clientCAs,
+		ClientCertAuth: cfg.clientCertAuth,
+		RelayAuth:      selfhosted.NewRelayAuthenticator(relayControlToken),
+		Logger:         cfg.logger,
+		Stores:         control.NewFileStores(filepath.Join(cfg.dir, "control")),
+		StatusAddr:     cfg.statusAddr,
+		QUIC:           cfg.quicConf,
+	}
+	if controlCertFile != nil {
+		controlCfg.CertSource = controlCertFile
+	}
+	control, err := control.NewServer(controlCfg)
 	if err != nil {
 		return nil, err
 	}
 
-	controlCAs := x509.NewCertPool()
-	controlCAs.AddCert(cfg.controlCert.Leaf)
-	relay, err := relay.NewServer(relay.Config{
+	relayCfg := relay.Config{
 		Addr:     cfg.relayAddr,
 		Hostport: model.HostPort{Host: cfg.relayHostname, Port: cfg.relayAddr.AddrPort().Port()},
 		Logger:   cfg.logger,
 		Stores:   relay.NewFileStores(filepath.Join(cfg.dir, "relay")),
 
-		ControlAddr:  cfg.controlAddr,
+		ControlAddr:  cfg.controlAddr.String(),
 		ControlHost:  "localhost",
 		ControlToken: relayControlToken,
-		ControlCAs:   controlCAs,
-	})
+
+		QUIC: cfg.quicConf,
+
+		Timeouts:        cfg.relayTimeouts,
+		ForwardTimeouts: cfg.relayForwardTimeouts,
+	}
+	if controlCertFile != nil {
+		// the embedded relay trusts whatever certificate control currently serves
+		relayCfg.GetControlCAs = func() *x509.CertPool {
+			controlCAs := x509.NewCertPool()
+			controlCAs.AddCert(controlCertFile.Certificate().Leaf)
+			return controlCAs
+		}
+	} else {
+		relayCfg.ControlCAs = x509.NewCertPool()
+		relayCfg.ControlCAs.AddCert(cfg.controlCert.Leaf)
+	}
+	relay, err := relay.NewServer(relayCfg)
 	if err != nil {
 		return nil, err
 	}
@@ -109,16 +159,26 @@ func (s *Server) Run(ctx context.Context) error {
 }
 
 type serverConfig struct {
-	clientAuth control.ClientAuthenticator
-
-	controlAddr *net.UDPAddr
-	controlCert tls.Certificate
-
-	relayAddr     *net.UDPAddr
-	relayHostname string
-
-	dir    string
-	logger *slog.Logger
+	clientAuth           control.ClientAuthenticator
+	clientTokensFile     string
+	clientCAs            *x509.CertPool
+	clientCertAuth       control.ClientCertAuthenticator
+	clientIdentitiesFile string
+
+	controlAddr     *net.UDPAddr
+	controlCert     tls.Certificate
+	controlCertFile string
+	controlKeyFile  string
+
+	relayAddr            *net.UDPAddr
+	relayHostname        string
+	relayTimeouts        netc.JoinTimeouts
+	relayForwardTimeouts map[model.Forward]netc.JoinTimeouts
+
+	dir        string
+	statusAddr string
+	quicConf   quicc.Config
+	logger     *slog.Logger
 }
 
 type ServerOption func(*serverConfig) error
@@ -130,6 +190,14 @@ func ServerClientTokens(tokens ...string) ServerOption {
 	}
 }
 
+// ServerClientTokensFile loads the client tokens from a file, reloading it on changes
+func ServerClientTokensFile(path string) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.clientTokensFile = path
+		return nil
+	}
+}
+
 func ServerControlAddress(address string) ServerOption {
 	return func(cfg *serverConfig) error {
 		addr, err := net.ResolveUDPAddr("udp", address)
@@ -143,22 +211,64 @@ func ServerControlAddress(address string) ServerOption {
 	}
 }
 
+// ServerControlCertificate loads the control certificate from files, reloading it on changes
 func ServerControlCertificate(certFile, keyFile string) ServerOption {
 	return func(cfg *serverConfig) error {
-		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		cfg.controlCertFile = certFile
+		cfg.controlKeyFile = keyFile
+
+		return nil
+	}
+}
+
+func serverControlCertificate(cert tls.Certificate) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.controlCert = cert
+
+		return nil
+	}
+}
+
+// ServerClientCAs requires clients to authenticate with a certificate signed by one of the CAs in certFile.
+// The identity of the certificate is then checked against ServerClientIdentities (or ServerClientIdentitiesFile)
+// instead of the client tokens. The embedded relay keeps using its token.
+func ServerClientCAs(certFile string) ServerOption {
+	return func(cfg *serverConfig) error {
+		casData, err := os.ReadFile(certFile)
 		if err != nil {
-			return kleverr.Newf("control cert cannot be loaded: %w", err)
+			return kleverr.Newf("cannot read certs file: %w", err)
 		}
 
-		cfg.controlCert = cert
+		cas := x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(casData) {
+			return kleverr.Newf("no certificates found in %s", certFile)
+		}
+
+		cfg.clientCAs = cas
 
 		return nil
 	}
 }
 
-func serverControlCertificate(cert tls.Certificate) ServerOption {
+// ServerClientIdentities sets the certificate identities (see control.CertIdentity) accepted with ServerClientCAs
+func ServerClientIdentities(identities ...string) ServerOption {
 	return func(cfg *serverConfig) error {
-		cfg.controlCert = cert
+		cfg.clientCertAuth = selfhosted.NewClientCertAuthenticator(identities...)
+		return nil
+	}
+}
+
+// ServerClientIdentitiesFile loads the accepted certificate identities from a file, reloading it on changes
+func ServerClientIdentitiesFile(path string) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.clientIdentitiesFile = path
+		return nil
+	}
+}
+
+func serverClientCAs(cas *x509.CertPool) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.clientCAs = cas
 
 		return nil
 	}
@@ -184,6 +294,28 @@ func ServerRelayHostname(hostname string) ServerOption {
 	}
 }
 
+// ServerRelayTimeouts closes the conns joined by the relay when they are idle or reach their max lifetime,
+// unless the forward has its own ServerRelayForwardTimeouts
+func ServerRelayTimeouts(timeouts netc.JoinTimeouts) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.relayTimeouts = timeouts
+		return nil
+	}
+}
+
+// ServerRelayForwardTimeouts closes the conns joined by the relay for the forward name when they are idle
+// or reach their max lifetime. The name is the server side one: '@<tenant>/<forward>' for forwards of tenant
+// clients, and the name doubling a leading '@' (e.g. '@@fwd' for '@fwd') for clients without a tenant.
+func ServerRelayForwardTimeouts(name string, timeouts netc.JoinTimeouts) ServerOption {
+	return func(cfg *serverConfig) error {
+		if cfg.relayForwardTimeouts == nil {
+			cfg.relayForwardTimeouts = map[model.Forward]netc.JoinTimeouts{}
+		}
+		cfg.relayForwardTimeouts[model.NewForward(name)] = timeouts
+		return nil
+	}
+}
+
 func ServerStoreDir(dir string) ServerOption {
 	return func(cfg *serverConfig) error {
 		cfg.dir = dir
@@ -202,6 +334,22 @@ func serverStoreDirTemp() ServerOption {
 	}
 }
 
+// ServerStatusAddress serves the control status as json on GET /status, at a tcp address or a unix socket (as unix:<path>)
+func ServerStatusAddress(address string) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.statusAddr = address
+		return nil
+	}
+}
+
+// ServerQUICConfig tunes the quic connections and udp sockets of both the control and the relay server
+func ServerQUICConfig(quicConf quicc.Config) ServerOption {
+	return func(cfg *serverConfig) error {
+		cfg.quicConf = quicConf
+		return nil
+	}
+}
+
 func ServerLogger(logger *slog.Logger) ServerOption {
 	return func(cfg *serverConfig) error {
 		cfg.logger = logger
@@ -0,0 +1,105 @@
+package statusc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/klev-dev/kleverr"
+)
+
+// Run serves the result of status as json on GET /status, at a tcp address or a unix socket (as unix:<path>)
+func Run[T any](ctx context.Context, addr string, status func() (T, error), logger *slog.Logger) error {
+	l, err := listen(addr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		s, err := status()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(s); err != nil {
+			logger.Debug("cannot write status", "err", err)
+		}
+	})
+
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+
+	logger.Debug("serving status", "addr", l.Addr())
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return kleverr.Ret(err)
+	}
+	return ctx.Err()
+}
+
+// Get fetches the status served by Run at addr
+func Get[T any](ctx context.Context, addr string) (T, error) {
+	var s T
+
+	transport := &http.Transport{}
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		}
+		addr = "connet"
+	} else if host, port, err := net.SplitHostPort(addr); err == nil && host == "" {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	cl := &http.Client{Transport: transport}
+	defer cl.CloseIdleConnections()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/status", addr), nil)
+	if err != nil {
+		return s, kleverr.Ret(err)
+	}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return s, kleverr.Newf("cannot get status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return s, kleverr.Newf("cannot get status: %s", resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return s, kleverr.Newf("cannot decode status: %w", err)
+	}
+	return s, nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, kleverr.Newf("cannot remove status socket: %w", err)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, kleverr.Newf("cannot listen for status: %w", err)
+		}
+		return l, nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, kleverr.Newf("cannot listen for status: %w", err)
+	}
+	return l, nil
+}